@@ -0,0 +1,52 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Calendar dates. Dates like an inspection's due date are stored as YYYY-MM-DD, so they
+ * compare as strings, and "today" is the transaction's date in UTC on every endorsing peer.
+ */
+
+package ccutil
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Layout of the stored dates, YYYY-MM-DD
+const DATE_FORMAT string = "2006-01-02"
+
+// TxTime returns the transaction timestamp in UTC, which is the same on every endorsing peer
+func TxTime(APIstub shim.ChaincodeStubInterface) (time.Time, error) {
+	ts, err := APIstub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, Internal(fmt.Sprintf("Unable to get transaction timestamp: %s", err))
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
+
+// CheckInspectionDue returns a Conflict when the vehicle's inspection was due before the transaction date
+func CheckInspectionDue(vin string, nextDueDate string, txTime time.Time) error {
+	if nextDueDate < txTime.Format(DATE_FORMAT) {
+		return Conflict(fmt.Sprintf("Technical inspection of the vehicle %s lapsed on %s", vin, nextDueDate))
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Error model shared by the lyl, vehicle_register and sale_application contracts.
+ * Every error response carries an HTTP-like status and, as its message, a JSON body
+ * with a machine-readable code, e.g.
+ * {"code":"NOT_FOUND","message":"Couldn't find the asset ASSET42","status":404}
+ */
+
+package ccutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Error is the JSON body of an error response
+type Error struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Field   string      `json:"field,omitempty"` //offending input field, when there is one
+	Status  int32       `json:"status"`
+	Details interface{} `json:"details,omitempty"` //e.g. the invalid rows of a bulk import
+}
+
+// Error codes
+const ARGUMENT_COUNT string = "ARGUMENT_COUNT"
+const INVALID_INPUT string = "INVALID_INPUT"
+const UNKNOWN_FUNCTION string = "UNKNOWN_FUNCTION"
+const FORBIDDEN string = "FORBIDDEN"
+const NOT_FOUND string = "NOT_FOUND"
+const CONFLICT string = "CONFLICT"
+const INTERNAL string = "INTERNAL"
+const DEPENDENCY_FAILED string = "DEPENDENCY_FAILED"
+
+// Error codes with their statuses and descriptions, as published by getMetadata
+var ErrorCodes = []Error{
+	{Code: ARGUMENT_COUNT, Status: 400, Message: "The function got a wrong number of arguments"},
+	{Code: INVALID_INPUT, Status: 400, Message: "An argument or input field is missing or invalid"},
+	{Code: UNKNOWN_FUNCTION, Status: 400, Message: "The contract has no such function"},
+	{Code: FORBIDDEN, Status: 403, Message: "The caller may not do this"},
+	{Code: NOT_FOUND, Status: 404, Message: "The record doesn't exist"},
+	{Code: CONFLICT, Status: 409, Message: "The record's state doesn't allow this"},
+	{Code: INTERNAL, Status: 500, Message: "Reading or writing the ledger failed"},
+	{Code: DEPENDENCY_FAILED, Status: 502, Message: "A call to another contract failed"},
+}
+
+func NewError(status int32, code string, message string, field string) *Error {
+	return &Error{Code: code, Message: message, Field: field, Status: status}
+}
+
+// The function got a wrong number of arguments, e.g. ArgumentCount(5, 6) for "Expecting 5 or 6"
+func ArgumentCount(expected ...int) *Error {
+	counts := make([]string, len(expected))
+	for i, count := range expected {
+		counts[i] = fmt.Sprint(count)
+	}
+	return NewError(400, ARGUMENT_COUNT, "Incorrect number of arguments. Expecting "+strings.Join(counts, " or "), "")
+}
+
+// The contract has no such function, the message lists the functions it has
+func UnknownFunction(function string, available []string) *Error {
+	return NewError(400, UNKNOWN_FUNCTION, "Received unknown function "+function+". Available functions: "+strings.Join(available, ", "), "")
+}
+
+func InvalidInput(field string, message string) *Error {
+	return NewError(400, INVALID_INPUT, message, field)
+}
+
+func Forbidden(message string) *Error {
+	return NewError(403, FORBIDDEN, message, "")
+}
+
+func NotFound(message string) *Error {
+	return NewError(404, NOT_FOUND, message, "")
+}
+
+func Conflict(message string) *Error {
+	return NewError(409, CONFLICT, message, "")
+}
+
+func Internal(message string) *Error {
+	return NewError(500, INTERNAL, message, "")
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Response returns the error response. Its status tells the gateway how to map it.
+func (e *Error) Response() sc.Response {
+	body, err := json.Marshal(e)
+	if err != nil {
+		body = []byte(e.Message)
+	}
+	return sc.Response{Status: e.Status, Message: string(body)}
+}
+
+// ErrorResponse returns the response for any error, errors not made by this package are internal
+func ErrorResponse(err error) sc.Response {
+	if e, ok := err.(*Error); ok {
+		return e.Response()
+	}
+	return Internal(err.Error()).Response()
+}
+
+// ParseError reads the error of a failed response, e.g. of another contract called with InvokeChaincode
+func ParseError(response sc.Response) *Error {
+	e := Error{}
+	if json.Unmarshal([]byte(response.Message), &e) != nil || e.Code == "" {
+		return NewError(response.Status, INTERNAL, response.Message, "")
+	}
+	return &e
+}
+
+// DependencyFailed wraps the error response of another contract
+func DependencyFailed(message string, response sc.Response) *Error {
+	return NewError(502, DEPENDENCY_FAILED, message+": "+ParseError(response).Message, "")
+}
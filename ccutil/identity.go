@@ -0,0 +1,58 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * The caller of a transaction as the contracts record it on the records they write.
+ */
+
+package ccutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// CallerOrganisation returns the caller's organisation: its MSP ID without the "MSP" suffix (e.g. SEB for SEBMSP)
+func CallerOrganisation(APIstub shim.ChaincodeStubInterface) (string, error) {
+	mspID, err := cid.GetMSPID(APIstub)
+	if err != nil {
+		return "", Internal(fmt.Sprintf("Unable to identify the caller: %s", err))
+	}
+	return strings.TrimSuffix(mspID, "MSP"), nil
+}
+
+// CreatorIdentity returns the identity of the transaction creator: MSP ID and certificate subject, e.g. SEBMSP::CN=User1,OU=client
+func CreatorIdentity(APIstub shim.ChaincodeStubInterface) (string, error) {
+	identity, err := cid.New(APIstub)
+	if err != nil {
+		return "", Internal(fmt.Sprintf("Unable to identify the caller: %s", err))
+	}
+	mspID, err := identity.GetMSPID()
+	if err != nil {
+		return "", Internal(fmt.Sprintf("Unable to identify the caller: %s", err))
+	}
+	cert, err := identity.GetX509Certificate()
+	if err != nil || cert == nil {
+		return mspID, nil
+	}
+	return mspID + "::" + cert.Subject.String(), nil
+}
@@ -0,0 +1,79 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Record identifiers generated by the contracts. An id is a type prefix followed by the base32
+ * of a hash, e.g. LEP7K2QH4ZD3M6XBWNA. Every peer endorsing the transaction derives the same id
+ * from the transaction id; an id derived from the caller's idempotency key instead is the same
+ * in every transaction, so a resubmitted call finds the record its first submission created.
+ */
+
+package ccutil
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Base32 characters after the prefix, 80 bits of the hash
+const ID_LENGTH int = 16
+
+// Longest idempotency key a caller may pass
+const MAX_IDEMPOTENCY_KEY_LENGTH int = 128
+
+// NewID returns the n-th id with the prefix generated by the transaction, n from 0
+func NewID(APIstub shim.ChaincodeStubInterface, prefix string, n int) string {
+	return hashID(prefix, "tx", APIstub.GetTxID(), strconv.Itoa(n))
+}
+
+/*
+ * IdempotentID returns the id with the prefix of the record the caller creates with the idempotency key.
+ * The caller is its MSP ID and certificate id, so a renewed certificate of the same identity keeps its ids.
+ */
+func IdempotentID(APIstub shim.ChaincodeStubInterface, prefix string, idempotencyKey string) (string, error) {
+	if strings.TrimSpace(idempotencyKey) == "" || len(idempotencyKey) > MAX_IDEMPOTENCY_KEY_LENGTH {
+		return "", InvalidInput("idempotencyKey", fmt.Sprintf("The idempotency key must have 1 to %d characters", MAX_IDEMPOTENCY_KEY_LENGTH))
+	}
+	mspID, err := cid.GetMSPID(APIstub)
+	if err != nil {
+		return "", Internal(fmt.Sprintf("Unable to identify the caller: %s", err))
+	}
+	callerID, err := cid.GetID(APIstub)
+	if err != nil {
+		return "", Internal(fmt.Sprintf("Unable to identify the caller: %s", err))
+	}
+	// the same key of another caller gives another id
+	return hashID(prefix, "key", mspID, callerID, idempotencyKey), nil
+}
+
+func hashID(prefix string, parts ...string) string {
+	hash := sha256.New()
+	hash.Write([]byte(prefix))
+	for _, part := range parts {
+		// length prefixed, so no two lists of parts hash alike
+		hash.Write([]byte(strconv.Itoa(len(part)) + ":" + part))
+	}
+	return prefix + base32.StdEncoding.EncodeToString(hash.Sum(nil))[:ID_LENGTH]
+}
@@ -0,0 +1,140 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Namespaced records. Every record lives under a composite key of its object type, so the
+ * keys of different record types can't collide, and is read back only as the docType its
+ * schema declares. The contracts wrap these in their typed helpers, e.g. getAsset and putAsset.
+ */
+
+package ccutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Key returns the composite key of the record of the object type with the attributes
+func (s Schemas) Key(APIstub shim.ChaincodeStubInterface, objectType string, attributes ...string) (string, error) {
+	if _, found := s[objectType]; !found || objectType == "" {
+		return "", Internal("No schema for the object type " + objectType)
+	}
+	key, err := APIstub.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return "", InvalidInput("", fmt.Sprintf("Invalid %s key %s: %s", objectType, strings.Join(attributes, " "), err))
+	}
+	return key, nil
+}
+
+/*
+ * Get returns the stored record of the object type, or nil when there is none.
+ * A record of another docType under the key is an error, it is never returned as this one.
+ */
+func (s Schemas) Get(APIstub shim.ChaincodeStubInterface, objectType string, attributes ...string) ([]byte, error) {
+	key, err := s.Key(APIstub, objectType, attributes...)
+	if err != nil {
+		return nil, err
+	}
+	recordAsBytes, err := APIstub.GetState(key)
+	if err != nil {
+		return nil, Internal(fmt.Sprintf("Get ledger state failed: %s", err))
+	}
+	if len(recordAsBytes) == 0 {
+		return nil, nil
+	}
+	var stamp struct {
+		DocType string `json:"docType"`
+	}
+	docType := s[objectType].DocType
+	if json.Unmarshal(recordAsBytes, &stamp) != nil || stamp.DocType != docType {
+		return nil, Internal(fmt.Sprintf("The record %s isn't a %s", strings.Join(attributes, " "), docType))
+	}
+	return recordAsBytes, nil
+}
+
+// Load unmarshals the stored record of the object type into record, NotFound when there is none
+func (s Schemas) Load(APIstub shim.ChaincodeStubInterface, objectType string, record interface{}, attributes ...string) error {
+	recordAsBytes, err := s.Get(APIstub, objectType, attributes...)
+	if err != nil {
+		return err
+	}
+	docType := s[objectType].DocType
+	if recordAsBytes == nil {
+		return NotFound(fmt.Sprintf("Couldn't find the %s %s", docType, strings.Join(attributes, " ")))
+	}
+	if err = json.Unmarshal(recordAsBytes, record); err != nil {
+		return Internal(fmt.Sprintf("Unable to unmarshal %s data received from the ledger", docType))
+	}
+	return nil
+}
+
+// Save writes the record of the object type stamped with its docType and schema version, and returns the stored JSON
+func (s Schemas) Save(APIstub shim.ChaincodeStubInterface, objectType string, record interface{}, attributes ...string) ([]byte, error) {
+	key, err := s.Key(APIstub, objectType, attributes...)
+	if err != nil {
+		return nil, err
+	}
+	schema := s[objectType]
+	recordAsBytes, err := json.Marshal(record)
+	if err != nil {
+		return nil, Internal(fmt.Sprintf("Marshal failed for %s: %s", schema.DocType, err))
+	}
+	if recordAsBytes, err = schema.stamp(recordAsBytes); err != nil {
+		return nil, err
+	}
+	if err = APIstub.PutState(key, recordAsBytes); err != nil {
+		return nil, Internal(fmt.Sprintf("Put ledger state failed: %s", err))
+	}
+	return recordAsBytes, nil
+}
+
+/*
+ * List returns the stored records of the object type whose key starts with the attributes, in key order.
+ * Like Get, a record of another docType under the object type is an error.
+ */
+func (s Schemas) List(APIstub shim.ChaincodeStubInterface, objectType string, attributes ...string) ([][]byte, error) {
+	if _, found := s[objectType]; !found || objectType == "" {
+		return nil, Internal("No schema for the object type " + objectType)
+	}
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, Internal(fmt.Sprintf("Get ledger state failed: %s", err))
+	}
+	defer resultsIterator.Close()
+
+	docType := s[objectType].DocType
+	records := [][]byte{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, Internal(fmt.Sprintf("Get ledger state failed: %s", err))
+		}
+		var stamp struct {
+			DocType string `json:"docType"`
+		}
+		if json.Unmarshal(queryResponse.Value, &stamp) != nil || stamp.DocType != docType {
+			return nil, Internal(fmt.Sprintf("The record %s isn't a %s", queryResponse.Key, docType))
+		}
+		records = append(records, queryResponse.Value)
+	}
+	return records, nil
+}
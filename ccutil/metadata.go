@@ -0,0 +1,170 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Contract metadata for client developers: the functions with their argument schemas and
+ * the error codes. JSON Schemas are generated from the Go structures the arguments are
+ * unmarshalled into, structures are listed once under definitions and referenced with $ref.
+ * Fields the contracts always set themselves are tagged metadata:"readOnly" and marked
+ * readOnly in their schema, fields only some functions set are listed by the argument.
+ */
+
+package ccutil
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const METADATA_FUNCTION string = "getMetadata"
+
+// Structure tag marking a field the contracts set, never taken from the caller
+const METADATA_TAG string = "metadata"
+const READ_ONLY string = "readOnly"
+
+type Metadata struct {
+	Name        string                 `json:"name"`
+	Version     string                 `json:"version"`
+	Functions   []FunctionMetadata     `json:"functions"`
+	Definitions map[string]interface{} `json:"definitions"`
+	ErrorCodes  []Error                `json:"errorCodes"`
+}
+
+type FunctionMetadata struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Args        []ArgMetadata          `json:"args"`
+	Roles       []string               `json:"roles,omitempty"`
+	DevOnly     bool                   `json:"devOnly,omitempty"`
+	Returns     map[string]interface{} `json:"returns,omitempty"`
+}
+
+type ArgMetadata struct {
+	Name        string                 `json:"name"`
+	Type        string                 `json:"type"`
+	Optional    bool                   `json:"optional,omitempty"`
+	Description string                 `json:"description"`
+	Schema      map[string]interface{} `json:"schema,omitempty"`
+	ReadOnly    []string               `json:"readOnly,omitempty"` //fields of the schema the function sets itself
+}
+
+// WithMetadata registers the getMetadata function describing the contract
+func (r *Router) WithMetadata(name string, version string) *Router {
+	return r.Add(Route{Function: METADATA_FUNCTION, Description: "Returns the contract's functions, their argument schemas and the error codes",
+		Returns: Metadata{},
+		Handler: func(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+			metadataAsBytes, err := json.Marshal(r.Metadata(name, version))
+			if err != nil {
+				return Internal("Marshal failed for metadata: " + err.Error()).Response()
+			}
+			return sc.Response{Status: shim.OK, Payload: metadataAsBytes}
+		}})
+}
+
+func (r *Router) Metadata(name string, version string) Metadata {
+	generator := schemaGenerator{definitions: map[string]interface{}{}}
+	metadata := Metadata{Name: name, Version: version, ErrorCodes: ErrorCodes}
+	for _, route := range r.Routes() {
+		function := FunctionMetadata{Name: route.Function, Description: route.Description, Args: []ArgMetadata{}, Roles: route.Roles, DevOnly: route.DevOnly}
+		for _, arg := range route.Args {
+			argMetadata := ArgMetadata{Name: arg.Name, Type: arg.Type, Optional: arg.Optional, Description: arg.Description, ReadOnly: arg.ReadOnly}
+			if arg.Schema != nil {
+				argMetadata.Schema = generator.schema(reflect.TypeOf(arg.Schema))
+			}
+			function.Args = append(function.Args, argMetadata)
+		}
+		if route.Returns != nil {
+			function.Returns = generator.schema(reflect.TypeOf(route.Returns))
+		}
+		metadata.Functions = append(metadata.Functions, function)
+	}
+	metadata.Definitions = generator.definitions
+	return metadata
+}
+
+// JSON Schema of a Go type as encoding/json reads and writes it
+type schemaGenerator struct {
+	definitions map[string]interface{}
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		// any JSON value
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, defined := g.definitions[t.Name()]; !defined {
+			// placeholder first, a structure may refer to itself
+			g.definitions[t.Name()] = nil
+			g.definitions[t.Name()] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+		name := tag[0]
+		if name == "" {
+			name = field.Name
+		}
+		property := g.schema(field.Type)
+		if field.Tag.Get(METADATA_TAG) == READ_ONLY {
+			property[READ_ONLY] = true
+		}
+		properties[name] = property
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
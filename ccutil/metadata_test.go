@@ -0,0 +1,48 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package ccutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testOrder struct {
+	OrderId   string   `json:"orderId"`
+	Item      string   `json:"item"`
+	Lines     []string `json:"lines,omitempty" metadata:"readOnly"`
+	CreatedBy string   `json:"createdBy,omitempty" metadata:"readOnly"`
+}
+
+func TestMetadataReadOnly(t *testing.T) {
+	router := NewRouter().Add(Route{Function: "placeOrder", Description: "Places the order",
+		Args: []Arg{{Name: "order", Type: JSON_ARG, Description: "Order", Schema: testOrder{}, ReadOnly: []string{"orderId"}}}})
+
+	metadata := router.Metadata("orders", "1.0")
+	properties := metadata.Definitions["testOrder"].(map[string]interface{})["properties"].(map[string]interface{})
+	for name, want := range map[string]bool{"orderId": false, "item": false, "lines": true, "createdBy": true} {
+		if readOnly := properties[name].(map[string]interface{})[READ_ONLY] == true; readOnly != want {
+			t.Errorf("%s: got readOnly %v, want %v", name, readOnly, want)
+		}
+	}
+	if args := metadata.Functions[0].Args; !reflect.DeepEqual(args[0].ReadOnly, []string{"orderId"}) {
+		t.Errorf("got the read-only fields %v, want orderId", args[0].ReadOnly)
+	}
+}
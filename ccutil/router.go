@@ -0,0 +1,233 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Declarative routing of Invoke calls. A contract registers its functions with their
+ * argument schemas and allowed caller roles; every call then passes the middleware chain
+ * (logging, panic recovery, access control and argument validation) before its handler.
+ */
+
+package ccutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Argument types
+const STRING_ARG string = "string"
+const JSON_ARG string = "json"
+
+// Certificate attribute carrying the caller's role
+const ROLE_ATTRIBUTE string = "role"
+
+// Environment variable of the chaincode process enabling the dev-only functions, e.g.
+// CHAINCODE_DEV_MODE=true CORE_CHAINCODE_ID_NAME=lyl:1.0 ./lyl on a peer in dev mode
+const DEV_MODE_ENV string = "CHAINCODE_DEV_MODE"
+
+type Handler func(APIstub shim.ChaincodeStubInterface, args []string) sc.Response
+
+// Middleware wraps the handler of a route
+type Middleware func(route *Route, next Handler) Handler
+
+// Arg describes one positional argument. Optional arguments come after the mandatory ones.
+type Arg struct {
+	Name        string
+	Type        string
+	Optional    bool
+	Description string
+	Schema      interface{} //value of the type a JSON argument is unmarshalled into, for getMetadata
+	ReadOnly    []string    //fields of the JSON argument the function sets itself, for getMetadata
+}
+
+type Route struct {
+	Function    string
+	Description string
+	Args        []Arg
+	Roles       []string    //caller must have one of these roles, anyone may call when empty
+	DevOnly     bool        //only callable when the chaincode runs in dev mode, see DEV_MODE_ENV
+	Returns     interface{} //value of the type of the returned JSON payload, for getMetadata
+	Handler     Handler
+}
+
+type Router struct {
+	routes     map[string]*Route
+	functions  []string
+	middleware []Middleware
+}
+
+// Middleware used by NewRouter, outermost first
+var DefaultMiddleware = []Middleware{Logging, Recovery, AccessControl, ValidateArgs}
+
+func NewRouter() *Router {
+	return &Router{routes: map[string]*Route{}, middleware: DefaultMiddleware}
+}
+
+// Use replaces the middleware chain, outermost first
+func (r *Router) Use(middleware ...Middleware) *Router {
+	r.middleware = middleware
+	return r
+}
+
+// Add registers a route. Registering a function twice is a programming error.
+func (r *Router) Add(route Route) *Router {
+	if _, exists := r.routes[route.Function]; exists {
+		panic("Function " + route.Function + " is registered twice")
+	}
+	r.routes[route.Function] = &route
+	r.functions = append(r.functions, route.Function)
+	return r
+}
+
+// Routes returns the registered routes in registration order
+func (r *Router) Routes() []Route {
+	routes := make([]Route, len(r.functions))
+	for i, function := range r.functions {
+		routes[i] = *r.routes[function]
+	}
+	return routes
+}
+
+// Functions returns the registered function names in registration order
+func (r *Router) Functions() []string {
+	return append([]string{}, r.functions...)
+}
+
+func (r *Router) Invoke(APIstub shim.ChaincodeStubInterface) sc.Response {
+
+	function, args := APIstub.GetFunctionAndParameters()
+	route, found := r.routes[function]
+	if !found {
+		return UnknownFunction(function, r.functions).Response()
+	}
+
+	handler := route.Handler
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](route, handler)
+	}
+	return handler(APIstub, args)
+}
+
+// Logging prints every call with its outcome and duration
+func Logging(route *Route, next Handler) Handler {
+	return func(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+		start := time.Now()
+		fmt.Printf("running %s() tx %s\n", route.Function, APIstub.GetTxID())
+		response := next(APIstub, args)
+		fmt.Printf("%s() tx %s returned %d in %s\n", route.Function, APIstub.GetTxID(), response.Status, time.Since(start))
+		if response.Status >= shim.ERRORTHRESHOLD {
+			fmt.Printf("%s() failed: %s\n", route.Function, response.Message)
+		}
+		return response
+	}
+}
+
+// Recovery turns a panic in the handler into an internal error response
+func Recovery(route *Route, next Handler) Handler {
+	return func(APIstub shim.ChaincodeStubInterface, args []string) (response sc.Response) {
+		defer func() {
+			if p := recover(); p != nil {
+				fmt.Printf("%s() panicked: %v\n%s", route.Function, p, debug.Stack())
+				response = Internal(fmt.Sprintf("%s failed: %v", route.Function, p)).Response()
+			}
+		}()
+		return next(APIstub, args)
+	}
+}
+
+// AccessControl rejects callers without one of the roles of the route, and dev-only calls outside dev mode
+func AccessControl(route *Route, next Handler) Handler {
+	if len(route.Roles) == 0 && !route.DevOnly {
+		return next
+	}
+	return func(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+		if route.DevOnly && !DevMode() {
+			return Forbidden(route.Function + " is only available in dev mode, " + DEV_MODE_ENV + "=true").Response()
+		}
+		if len(route.Roles) > 0 {
+			if _, err := AssertRole(APIstub, route.Roles...); err != nil {
+				return ErrorResponse(err)
+			}
+		}
+		return next(APIstub, args)
+	}
+}
+
+// DevMode tells whether the chaincode process was started with DEV_MODE_ENV set to true
+func DevMode() bool {
+	devMode, _ := strconv.ParseBool(os.Getenv(DEV_MODE_ENV))
+	return devMode
+}
+
+// ValidateArgs checks the number of arguments and that JSON arguments are well-formed
+func ValidateArgs(route *Route, next Handler) Handler {
+	return func(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+		if err := checkArgs(route.Args, args); err != nil {
+			return ErrorResponse(err)
+		}
+		return next(APIstub, args)
+	}
+}
+
+func checkArgs(schema []Arg, args []string) error {
+	mandatory := 0
+	for _, arg := range schema {
+		if !arg.Optional {
+			mandatory++
+		}
+	}
+	if len(args) < mandatory || len(args) > len(schema) {
+		counts := []int{}
+		for count := mandatory; count <= len(schema); count++ {
+			counts = append(counts, count)
+		}
+		return ArgumentCount(counts...)
+	}
+	for i, value := range args {
+		if schema[i].Type == JSON_ARG && !json.Valid([]byte(value)) {
+			return InvalidInput(schema[i].Name, schema[i].Name+" must be a JSON document")
+		}
+	}
+	return nil
+}
+
+// AssertRole returns the caller's role if it is one of the given roles
+func AssertRole(APIstub shim.ChaincodeStubInterface, roles ...string) (string, error) {
+	role, found, err := cid.GetAttributeValue(APIstub, ROLE_ATTRIBUTE)
+	if err != nil {
+		return "", Internal(fmt.Sprintf("Unable to identify the caller: %s", err))
+	}
+	if found {
+		for _, allowed := range roles {
+			if role == allowed {
+				return role, nil
+			}
+		}
+	}
+	return "", Forbidden(fmt.Sprintf("Caller must have one of the roles %s", strings.Join(roles, ", ")))
+}
@@ -0,0 +1,428 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Versioned records. Every JSON object a contract stores is stamped with its docType and
+ * schemaVersion, and records of older versions are upcast to the current one as they are
+ * read, so the contracts only ever see the current schema. The migrate function rewrites the
+ * stored records to the current schema in batches. A contract declares its records by key:
+ * composite keys by object type, simple keys under "". Records kept under simple keys before
+ * their keys were namespaced are moved to composite keys by migrate, see DocSchema.MovedTo.
+ *
+ * Changing a record's fields means raising its Version and adding the upcaster from the
+ * previous version, e.g. for a price turned from a string into a number of cents:
+ *   Upcasters: []ccutil.Upcaster{nil, func(record map[string]interface{}) error {...}}
+ */
+
+package ccutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const MIGRATE_FUNCTION string = "migrate"
+
+// Fields stamped on every stored record
+const DOC_TYPE_FIELD string = "docType"
+const SCHEMA_VERSION_FIELD string = "schemaVersion"
+
+// Upcaster turns a record of one schema version into the next version
+type Upcaster func(record map[string]interface{}) error
+
+type DocSchema struct {
+	DocType   string
+	Version   int         //current version, records written before versioning are version 0
+	Upcasters []Upcaster  //Upcasters[v] upcasts version v to v+1, nil when only the stamp changes
+	Type      interface{} //value of the Go type of the record, upcast records are re-marshalled through it
+	MovedTo   string      //only of the simple keys: object type whose composite keys migrate moves the records to
+}
+
+// Schemas of a contract's records: composite keys by object type, simple keys under ""
+type Schemas map[string]DocSchema
+
+// ObjectTypes returns the object types of the composite keys in alphabetical order
+func (s Schemas) ObjectTypes() []string {
+	objectTypes := []string{}
+	for objectType := range s {
+		if objectType != "" {
+			objectTypes = append(objectTypes, objectType)
+		}
+	}
+	sort.Strings(objectTypes)
+	return objectTypes
+}
+
+func (s Schemas) forKey(key string) (DocSchema, bool) {
+	objectType := ""
+	if strings.HasPrefix(key, "\x00") {
+		end := strings.Index(key[1:], "\x00")
+		if end < 0 {
+			return DocSchema{}, false
+		}
+		objectType = key[1 : end+1]
+	}
+	return s.schema(objectType)
+}
+
+// schema of the object type, the simple keys whose records are moved have the schema of their new object type
+func (s Schemas) schema(objectType string) (DocSchema, bool) {
+	schema, found := s[objectType]
+	if found && objectType == "" && schema.MovedTo != "" {
+		schema, found = s[schema.MovedTo]
+	}
+	return schema, found
+}
+
+/*
+ * WithSchemas versions the contract's records: the Versioning middleware stamps writes and
+ * upcasts reads, and the migrate function rewrites stored records to the current schemas.
+ */
+func (r *Router) WithSchemas(schemas Schemas) *Router {
+	r.middleware = append(append([]Middleware{}, r.middleware...), Versioning(schemas))
+	migration := migration{schemas: schemas}
+	return r.Add(Route{Function: MIGRATE_FUNCTION, Handler: migration.migrate,
+		Description: "Rewrites a batch of stored records to the current schema versions, returns the bookmark of the next batch",
+		Roles:       []string{ADMIN_ROLE},
+		Returns:     MigrationResult{},
+		Args: []Arg{
+			{Name: "batchSize", Type: STRING_ARG, Optional: true, Description: fmt.Sprintf("Records read per call, 1 to %d, %d by default", MAX_PAGE_SIZE, DEFAULT_PAGE_SIZE)},
+			{Name: "bookmark", Type: STRING_ARG, Optional: true, Description: "Bookmark returned by the previous call"},
+		}})
+}
+
+// Versioning hands the handler a stub that stamps the records it writes and upcasts the records it reads
+func Versioning(schemas Schemas) Middleware {
+	return func(route *Route, next Handler) Handler {
+		return func(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+			return next(&versionedStub{ChaincodeStubInterface: APIstub, schemas: schemas}, args)
+		}
+	}
+}
+
+/*
+ * stamp sets the record's docType and schemaVersion, in front of its other fields. A record already
+ * stamped with an older version is upcast; one of another docType or of a newer version is refused.
+ */
+func (s DocSchema) stamp(value []byte) ([]byte, error) {
+	record := map[string]json.RawMessage{}
+	if json.Unmarshal(value, &record) != nil {
+		// not a JSON object, stored as it is
+		return value, nil
+	}
+	docType, _ := json.Marshal(s.DocType)
+	version := []byte(strconv.Itoa(s.Version))
+	storedType, hasDocType := record[DOC_TYPE_FIELD]
+	storedVersion, hasVersion := record[SCHEMA_VERSION_FIELD]
+	if hasDocType && !bytes.Equal(storedType, docType) {
+		return nil, InvalidInput(DOC_TYPE_FIELD, fmt.Sprintf("A %s can't be written as a %s", storedType, s.DocType))
+	}
+	if hasVersion {
+		if _, err := strconv.Atoi(string(storedVersion)); err != nil {
+			return nil, InvalidInput(SCHEMA_VERSION_FIELD, fmt.Sprintf("Invalid %s %s of a %s", SCHEMA_VERSION_FIELD, storedVersion, s.DocType))
+		}
+	}
+	if hasDocType || hasVersion {
+		if hasDocType && bytes.Equal(storedVersion, version) {
+			return value, nil
+		}
+		// older versions are brought up to date, newer ones refused
+		upcast, _, err := s.upcast(value)
+		return upcast, err
+	}
+
+	stamped := bytes.Buffer{}
+	stamped.WriteString(`{"` + DOC_TYPE_FIELD + `":`)
+	stamped.Write(docType)
+	stamped.WriteString(`,"` + SCHEMA_VERSION_FIELD + `":`)
+	stamped.Write(version)
+	fields := bytes.TrimSpace(bytes.TrimSpace(value)[1:])
+	if fields[0] != '}' {
+		stamped.WriteByte(',')
+	}
+	stamped.Write(fields)
+	return stamped.Bytes(), nil
+}
+
+// upcast returns the record in the current schema version, and whether it had to change
+func (s DocSchema) upcast(value []byte) ([]byte, bool, error) {
+	record := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	if decoder.Decode(&record) != nil {
+		return value, false, nil
+	}
+	version := 0
+	if number, isNumber := record[SCHEMA_VERSION_FIELD].(json.Number); isNumber {
+		parsed, err := strconv.Atoi(number.String())
+		if err != nil {
+			return nil, false, Internal(fmt.Sprintf("Invalid %s %s of a %s", SCHEMA_VERSION_FIELD, number, s.DocType))
+		}
+		version = parsed
+	}
+	if docType, stamped := record[DOC_TYPE_FIELD]; stamped && docType != s.DocType {
+		// not a record of this schema, left for the reader to refuse
+		return value, false, nil
+	}
+	if version == s.Version && record[DOC_TYPE_FIELD] == s.DocType {
+		return value, false, nil
+	}
+	if version > s.Version {
+		return nil, false, Internal(fmt.Sprintf("The %s has schema version %d, this contract knows up to %d", s.DocType, version, s.Version))
+	}
+	for ; version < s.Version; version++ {
+		if version < len(s.Upcasters) && s.Upcasters[version] != nil {
+			if err := s.Upcasters[version](record); err != nil {
+				return nil, false, Internal(fmt.Sprintf("Unable to upcast the %s from schema version %d: %s", s.DocType, version, err))
+			}
+		}
+	}
+	delete(record, DOC_TYPE_FIELD)
+	delete(record, SCHEMA_VERSION_FIELD)
+	upcast, err := json.Marshal(record)
+	if err != nil {
+		return nil, false, Internal(fmt.Sprintf("Marshal failed for %s: %s", s.DocType, err))
+	}
+	if s.Type != nil {
+		// in the field order of the Go type, as the contract writes it
+		typed := reflect.New(reflect.TypeOf(s.Type)).Interface()
+		if err := json.Unmarshal(upcast, typed); err != nil {
+			return nil, false, Internal(fmt.Sprintf("The upcast %s doesn't fit its type: %s", s.DocType, err))
+		}
+		if upcast, err = json.Marshal(typed); err != nil {
+			return nil, false, Internal(fmt.Sprintf("Marshal failed for %s: %s", s.DocType, err))
+		}
+	}
+	upcast, err = s.stamp(upcast)
+	return upcast, true, err
+}
+
+// Stub stamping and upcasting the records of the contract's schemas
+type versionedStub struct {
+	shim.ChaincodeStubInterface
+	schemas Schemas
+}
+
+func (s *versionedStub) GetState(key string) ([]byte, error) {
+	value, err := s.ChaincodeStubInterface.GetState(key)
+	if err != nil || len(value) == 0 {
+		return value, err
+	}
+	return s.read(key, value)
+}
+
+func (s *versionedStub) PutState(key string, value []byte) error {
+	if schema, found := s.schemas.forKey(key); found && len(value) > 0 {
+		stamped, err := schema.stamp(value)
+		if err != nil {
+			return err
+		}
+		value = stamped
+	}
+	return s.ChaincodeStubInterface.PutState(key, value)
+}
+
+func (s *versionedStub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	iterator, err := s.ChaincodeStubInterface.GetStateByRange(startKey, endKey)
+	return s.iterator(iterator), err
+}
+
+func (s *versionedStub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *sc.QueryResponseMetadata, error) {
+	iterator, metadata, err := s.ChaincodeStubInterface.GetStateByRangeWithPagination(startKey, endKey, pageSize, bookmark)
+	return s.iterator(iterator), metadata, err
+}
+
+func (s *versionedStub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	iterator, err := s.ChaincodeStubInterface.GetStateByPartialCompositeKey(objectType, keys)
+	return s.iterator(iterator), err
+}
+
+func (s *versionedStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *sc.QueryResponseMetadata, error) {
+	iterator, metadata, err := s.ChaincodeStubInterface.GetStateByPartialCompositeKeyWithPagination(objectType, keys, pageSize, bookmark)
+	return s.iterator(iterator), metadata, err
+}
+
+func (s *versionedStub) read(key string, value []byte) ([]byte, error) {
+	schema, found := s.schemas.forKey(key)
+	if !found {
+		return value, nil
+	}
+	upcast, _, err := schema.upcast(value)
+	return upcast, err
+}
+
+func (s *versionedStub) iterator(iterator shim.StateQueryIteratorInterface) shim.StateQueryIteratorInterface {
+	if iterator == nil {
+		return nil
+	}
+	return &versionedIterator{StateQueryIteratorInterface: iterator, stub: s}
+}
+
+type versionedIterator struct {
+	shim.StateQueryIteratorInterface
+	stub *versionedStub
+}
+
+func (i *versionedIterator) Next() (*queryresult.KV, error) {
+	result, err := i.StateQueryIteratorInterface.Next()
+	if err != nil || result == nil {
+		return result, err
+	}
+	value, err := i.stub.read(result.Key, result.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &queryresult.KV{Namespace: result.Namespace, Key: result.Key, Value: value}, nil
+}
+
+// Outcome of one migrate call
+type MigrationResult struct {
+	Scanned  int    `json:"scanned"`
+	Migrated int    `json:"migrated"`
+	Bookmark string `json:"bookmark,omitempty"` //where the next call continues, empty when every record is migrated
+}
+
+type migration struct {
+	schemas Schemas
+}
+
+/*
+ * Reads up to batchSize records from the bookmark on and rewrites those of older versions.
+ * A transaction can't write after a paginated query, so the batch is read with plain range
+ * queries; a composite key source is read from its start, skipping the keys before the bookmark.
+ * The bookmark is the source, "" for the simple keys or an object type, and the next key: source|key
+ */
+func (m migration) migrate(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if versioned, isVersioned := APIstub.(*versionedStub); isVersioned {
+		// the stored records as they are
+		APIstub = versioned.ChaincodeStubInterface
+	}
+	batchSize := DEFAULT_PAGE_SIZE
+	if len(args) > 0 && args[0] != "" {
+		var err error
+		batchSize, err = strconv.Atoi(args[0])
+		if err != nil || batchSize < 1 || batchSize > MAX_PAGE_SIZE {
+			return InvalidInput("batchSize", fmt.Sprintf("batchSize must be between 1 and %d", MAX_PAGE_SIZE)).Response()
+		}
+	}
+	sources := m.schemas.ObjectTypes()
+	if _, hasSimpleKeys := m.schemas[""]; hasSimpleKeys {
+		sources = append([]string{""}, sources...)
+	}
+	source, next := 0, ""
+	if len(args) > 1 && args[1] != "" {
+		sourceAndKey := strings.SplitN(args[1], "|", 2)
+		source = -1
+		for i, candidate := range sources {
+			if len(sourceAndKey) == 2 && candidate == sourceAndKey[0] {
+				source, next = i, sourceAndKey[1]
+			}
+		}
+		if source < 0 {
+			return InvalidInput("bookmark", "Unknown bookmark "+args[1]).Response()
+		}
+	}
+
+	result := MigrationResult{}
+	for ; source < len(sources) && result.Bookmark == ""; source, next = source+1, "" {
+		var iterator shim.StateQueryIteratorInterface
+		var err error
+		if sources[source] == "" {
+			iterator, err = APIstub.GetStateByRange(next, "")
+		} else {
+			iterator, err = APIstub.GetStateByPartialCompositeKey(sources[source], []string{})
+		}
+		if err != nil {
+			return Internal(fmt.Sprintf("Unable to read the state: %s", err)).Response()
+		}
+		schema, _ := m.schemas.schema(sources[source])
+		for iterator.HasNext() {
+			record, err := iterator.Next()
+			if err != nil {
+				iterator.Close()
+				return Internal(fmt.Sprintf("Unable to read the state: %s", err)).Response()
+			}
+			if record.Key < next {
+				continue
+			}
+			if result.Scanned == batchSize {
+				result.Bookmark = sources[source] + "|" + record.Key
+				break
+			}
+			result.Scanned++
+			upcast, changed, err := schema.upcast(record.Value)
+			if err != nil {
+				iterator.Close()
+				return ErrorResponse(err)
+			}
+			if m.schemas[sources[source]].MovedTo != "" {
+				if err := m.move(APIstub, record.Key, upcast); err != nil {
+					iterator.Close()
+					return ErrorResponse(err)
+				}
+				result.Migrated++
+			} else if changed {
+				if err := APIstub.PutState(record.Key, upcast); err != nil {
+					iterator.Close()
+					return Internal(fmt.Sprintf("Put ledger state failed: %s", err)).Response()
+				}
+				result.Migrated++
+			}
+		}
+		iterator.Close()
+	}
+
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		return Internal("Marshal failed for migration result: " + err.Error()).Response()
+	}
+	return shim.Success(resultAsBytes)
+}
+
+// Moves the record of a simple key to the composite key of the same name, refusing to overwrite a record there
+func (m migration) move(APIstub shim.ChaincodeStubInterface, key string, value []byte) error {
+	objectType := m.schemas[""].MovedTo
+	movedKey, err := APIstub.CreateCompositeKey(objectType, []string{key})
+	if err != nil {
+		return Internal(fmt.Sprintf("Unable to move %s: %s", key, err))
+	}
+	existing, err := APIstub.GetState(movedKey)
+	if err != nil {
+		return Internal(fmt.Sprintf("Get ledger state failed: %s", err))
+	}
+	if len(existing) > 0 {
+		return Conflict(fmt.Sprintf("Unable to move %s, there already is a %s %s", key, m.schemas[objectType].DocType, key))
+	}
+	if err = APIstub.PutState(movedKey, value); err != nil {
+		return Internal(fmt.Sprintf("Put ledger state failed: %s", err))
+	}
+	if err = APIstub.DelState(key); err != nil {
+		return Internal(fmt.Sprintf("Delete ledger state failed: %s", err))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package ccutil
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testRecord struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+var testSchema = DocSchema{
+	DocType: "testRecord",
+	Version: 2,
+	Upcasters: []Upcaster{
+		// version 0 called the name title
+		func(record map[string]interface{}) error {
+			record["name"] = record["title"]
+			delete(record, "title")
+			return nil
+		},
+		nil,
+	},
+	Type: testRecord{},
+}
+
+func TestUpcast(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		changed bool
+		err     string
+	}{
+		{"unstamped record", `{"count":3,"title":"a"}`, `{"docType":"testRecord","schemaVersion":2,"name":"a","count":3}`, true, ""},
+		{"older version", `{"docType":"testRecord","schemaVersion":1,"count":3,"name":"a"}`, `{"docType":"testRecord","schemaVersion":2,"name":"a","count":3}`, true, ""},
+		{"current version", `{"docType":"testRecord","schemaVersion":2,"name":"a","count":3}`, `{"docType":"testRecord","schemaVersion":2,"name":"a","count":3}`, false, ""},
+		{"another docType", `{"docType":"other","schemaVersion":1,"title":"a"}`, `{"docType":"other","schemaVersion":1,"title":"a"}`, false, ""},
+		{"not a JSON object", `plain`, `plain`, false, ""},
+		{"newer version", `{"docType":"testRecord","schemaVersion":3,"name":"a"}`, "", false, "knows up to 2"},
+		{"large number", `{"docType":"testRecord","schemaVersion":1,"name":"a","count":9007199254740993}`, `{"docType":"testRecord","schemaVersion":2,"name":"a","count":9007199254740993}`, true, ""},
+	}
+	for _, test := range tests {
+		upcast, changed, err := testSchema.upcast([]byte(test.value))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if string(upcast) != test.want || changed != test.changed {
+			t.Errorf("%s: got %s changed %v, want %s changed %v", test.name, upcast, changed, test.want, test.changed)
+		}
+	}
+}
+
+func TestUpcastUpcasterError(t *testing.T) {
+	schema := DocSchema{DocType: "testRecord", Version: 1, Upcasters: []Upcaster{
+		func(record map[string]interface{}) error { return fmt.Errorf("no title") },
+	}}
+	if _, _, err := schema.upcast([]byte(`{"name":"a"}`)); err == nil || !strings.Contains(err.Error(), "no title") {
+		t.Errorf("got error %v, want the upcaster's error", err)
+	}
+}
+
+func TestStamp(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+		err   string
+	}{
+		{"unstamped record", `{"name":"a","count":3}`, `{"docType":"testRecord","schemaVersion":2,"name":"a","count":3}`, ""},
+		{"empty record", `{}`, `{"docType":"testRecord","schemaVersion":2}`, ""},
+		{"current stamp", `{"docType":"testRecord","schemaVersion":2,"name":"a","count":3}`, `{"docType":"testRecord","schemaVersion":2,"name":"a","count":3}`, ""},
+		{"older version", `{"docType":"testRecord","schemaVersion":0,"title":"a","count":3}`, `{"docType":"testRecord","schemaVersion":2,"name":"a","count":3}`, ""},
+		{"version without docType", `{"schemaVersion":1,"name":"a","count":3}`, `{"docType":"testRecord","schemaVersion":2,"name":"a","count":3}`, ""},
+		{"not a JSON object", `plain`, `plain`, ""},
+		{"another docType", `{"docType":"saleApplication","schemaVersion":2,"name":"a"}`, "", `A "saleApplication" can't be written as a testRecord`},
+		{"newer version", `{"docType":"testRecord","schemaVersion":7,"name":"a"}`, "", "knows up to 2"},
+		{"invalid version", `{"docType":"testRecord","schemaVersion":"2","name":"a"}`, "", "Invalid schemaVersion"},
+	}
+	for _, test := range tests {
+		stamped, err := testSchema.stamp([]byte(test.value))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if string(stamped) != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, stamped, test.want)
+		}
+	}
+}
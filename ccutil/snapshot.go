@@ -0,0 +1,283 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * World-state snapshots of a contract. exportState pages through every key of the
+ * contract, simple keys first and then the composite keys of each object type the contract
+ * declares; importState writes the entries of a snapshot into a fresh deployment. Composite
+ * keys are kept as their object type and attributes, so snapshots read as plain JSON.
+ */
+
+package ccutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const SNAPSHOT_FORMAT string = "hlexample-snapshot"
+const SNAPSHOT_VERSION int = 1
+
+const EXPORT_FUNCTION string = "exportState"
+const IMPORT_FUNCTION string = "importState"
+
+// Role of the operators allowed to import snapshots
+const ADMIN_ROLE string = "admin"
+
+const DEFAULT_PAGE_SIZE int = 100
+const MAX_PAGE_SIZE int = 1000
+
+// Most entries one importState call writes, larger snapshots are imported in chunks
+const MAX_IMPORT_ENTRIES int = 1000
+
+// Snapshot of a contract's state, or one page or chunk of it
+type Snapshot struct {
+	Format          string          `json:"format"`
+	Version         int             `json:"version"`
+	Chaincode       string          `json:"chaincode"`
+	ContractVersion string          `json:"contractVersion"`
+	Entries         []SnapshotEntry `json:"entries,omitempty"`
+	Bookmark        string          `json:"bookmark,omitempty"` //where the next page of an export starts, empty on the last page
+}
+
+// One key and its value. A composite key has the object type and attributes instead of the key.
+type SnapshotEntry struct {
+	Key        string          `json:"key,omitempty"`
+	ObjectType string          `json:"objectType,omitempty"`
+	Attributes []string        `json:"attributes,omitempty"`
+	Value      json.RawMessage `json:"value"`
+}
+
+/*
+ * WithSnapshots registers exportState and importState for the contract's simple keys and the composite keys
+ * of the schemas' object types. Imported records must be of their key's docType, older versions are upcast.
+ */
+func (r *Router) WithSnapshots(name string, version string, schemas Schemas) *Router {
+	snapshots := snapshots{name: name, version: version, objectTypes: schemas.ObjectTypes(), schemas: schemas}
+	return r.
+		Add(Route{Function: EXPORT_FUNCTION, Handler: snapshots.export,
+			Description: "Returns a page of the contract's state as a snapshot, with the bookmark of the next page",
+			Returns:     Snapshot{},
+			Args: []Arg{
+				{Name: "pageSize", Type: STRING_ARG, Optional: true, Description: fmt.Sprintf("Entries per page, 1 to %d, %d by default", MAX_PAGE_SIZE, DEFAULT_PAGE_SIZE)},
+				{Name: "bookmark", Type: STRING_ARG, Optional: true, Description: "Bookmark returned with the previous page"},
+			}}).
+		Add(Route{Function: IMPORT_FUNCTION, Handler: snapshots.importState,
+			Description: "Writes the snapshot's entries, none of which may exist yet, upcasting records of older schema versions",
+			Roles:       []string{ADMIN_ROLE},
+			Args: []Arg{
+				{Name: "snapshot", Type: JSON_ARG, Description: fmt.Sprintf("Snapshot of this contract with at most %d entries", MAX_IMPORT_ENTRIES), Schema: Snapshot{}},
+			}})
+}
+
+type snapshots struct {
+	name        string
+	version     string
+	objectTypes []string
+	schemas     Schemas
+}
+
+// The export bookmark is the source, "" for the simple keys or an object type, and the bookmark within it: source|bookmark
+func (s snapshots) export(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	pageSize := DEFAULT_PAGE_SIZE
+	if len(args) > 0 && args[0] != "" {
+		var err error
+		pageSize, err = strconv.Atoi(args[0])
+		if err != nil || pageSize < 1 || pageSize > MAX_PAGE_SIZE {
+			return InvalidInput("pageSize", fmt.Sprintf("pageSize must be between 1 and %d", MAX_PAGE_SIZE)).Response()
+		}
+	}
+	sources := append([]string{""}, s.objectTypes...)
+	source, bookmark := 0, ""
+	if len(args) > 1 && args[1] != "" {
+		sourceAndBookmark := strings.SplitN(args[1], "|", 2)
+		source = -1
+		for i, candidate := range sources {
+			if len(sourceAndBookmark) == 2 && candidate == sourceAndBookmark[0] {
+				source, bookmark = i, sourceAndBookmark[1]
+			}
+		}
+		if source < 0 {
+			return InvalidInput("bookmark", "Unknown bookmark "+args[1]).Response()
+		}
+	}
+
+	var iterator shim.StateQueryIteratorInterface
+	var metadata *sc.QueryResponseMetadata
+	var err error
+	if sources[source] == "" {
+		iterator, metadata, err = APIstub.GetStateByRangeWithPagination("", "", int32(pageSize), bookmark)
+	} else {
+		iterator, metadata, err = APIstub.GetStateByPartialCompositeKeyWithPagination(sources[source], []string{}, int32(pageSize), bookmark)
+	}
+	if err != nil {
+		return Internal(fmt.Sprintf("Unable to read the state: %s", err)).Response()
+	}
+	defer iterator.Close()
+
+	snapshot := Snapshot{Format: SNAPSHOT_FORMAT, Version: SNAPSHOT_VERSION, Chaincode: s.name, ContractVersion: s.version, Entries: []SnapshotEntry{}}
+	for iterator.HasNext() {
+		result, err := iterator.Next()
+		if err != nil {
+			return Internal(fmt.Sprintf("Unable to read the state: %s", err)).Response()
+		}
+		entry := SnapshotEntry{Key: result.Key, Value: result.Value}
+		if sources[source] != "" {
+			objectType, attributes, err := APIstub.SplitCompositeKey(result.Key)
+			if err != nil {
+				return Internal(fmt.Sprintf("Unable to split the key %q: %s", result.Key, err)).Response()
+			}
+			entry = SnapshotEntry{ObjectType: objectType, Attributes: attributes, Value: result.Value}
+		}
+		if !json.Valid(entry.Value) {
+			return Internal(fmt.Sprintf("The value of %q is not JSON", result.Key)).Response()
+		}
+		snapshot.Entries = append(snapshot.Entries, entry)
+	}
+	if metadata.Bookmark != "" {
+		snapshot.Bookmark = sources[source] + "|" + metadata.Bookmark
+	} else if source+1 < len(sources) {
+		snapshot.Bookmark = sources[source+1] + "|"
+	}
+
+	snapshotAsBytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return Internal("Marshal failed for snapshot: " + err.Error()).Response()
+	}
+	return shim.Success(snapshotAsBytes)
+}
+
+func (s snapshots) importState(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	snapshot := Snapshot{}
+	if err := json.Unmarshal([]byte(args[0]), &snapshot); err != nil {
+		return InvalidInput("snapshot", "Unable to unmarshal the snapshot: "+err.Error()).Response()
+	}
+	keys, values, err := s.validate(APIstub, snapshot)
+	if err != nil {
+		return ErrorResponse(err)
+	}
+
+	for i, entry := range snapshot.Entries {
+		existing, err := APIstub.GetState(keys[i])
+		if err != nil {
+			return Internal(fmt.Sprintf("Unable to read the state: %s", err)).Response()
+		}
+		if existing != nil {
+			return Conflict(fmt.Sprintf("Entry %d: %s already exists, snapshots are imported into a fresh deployment", i, entry.describe())).Response()
+		}
+		if err := APIstub.PutState(keys[i], values[i]); err != nil {
+			return Internal(fmt.Sprintf("Put ledger state failed: %s", err)).Response()
+		}
+	}
+	return shim.Success([]byte(fmt.Sprintf(`{"imported":%d}`, len(snapshot.Entries))))
+}
+
+/*
+ * validate checks the whole snapshot before anything is written and returns the keys of the entries
+ * and the values to write, records of older schema versions upcast to the current ones
+ */
+func (s snapshots) validate(APIstub shim.ChaincodeStubInterface, snapshot Snapshot) ([]string, [][]byte, error) {
+	switch {
+	case snapshot.Format != SNAPSHOT_FORMAT:
+		return nil, nil, InvalidInput("format", "Not a snapshot, format must be "+SNAPSHOT_FORMAT)
+	case snapshot.Version != SNAPSHOT_VERSION:
+		return nil, nil, InvalidInput("version", fmt.Sprintf("Snapshot version %d is not supported, expecting %d", snapshot.Version, SNAPSHOT_VERSION))
+	case snapshot.Chaincode != s.name:
+		return nil, nil, InvalidInput("chaincode", "The snapshot is of "+snapshot.Chaincode+", not of "+s.name)
+	case len(snapshot.Entries) > MAX_IMPORT_ENTRIES:
+		return nil, nil, InvalidInput("entries", fmt.Sprintf("A snapshot of %d entries must be imported in chunks of at most %d", len(snapshot.Entries), MAX_IMPORT_ENTRIES))
+	}
+
+	keys := make([]string, len(snapshot.Entries))
+	values := make([][]byte, len(snapshot.Entries))
+	seen := map[string]int{}
+	for i, entry := range snapshot.Entries {
+		if entry.ObjectType == "" {
+			if entry.Key == "" || strings.HasPrefix(entry.Key, "\x00") || len(entry.Attributes) > 0 {
+				return nil, nil, InvalidInput("entries", fmt.Sprintf("Entry %d must have a simple key, or an objectType and attributes", i))
+			}
+			keys[i] = entry.Key
+		} else {
+			if entry.Key != "" || !s.knows(entry.ObjectType) {
+				return nil, nil, InvalidInput("entries", fmt.Sprintf("Entry %d: %s isn't an object type of %s", i, entry.ObjectType, s.name))
+			}
+			key, err := APIstub.CreateCompositeKey(entry.ObjectType, entry.Attributes)
+			if err != nil {
+				return nil, nil, InvalidInput("entries", fmt.Sprintf("Entry %d: %s", i, err))
+			}
+			keys[i] = key
+		}
+		if !json.Valid(entry.Value) {
+			return nil, nil, InvalidInput("entries", fmt.Sprintf("Entry %d: the value of %s must be a JSON document", i, entry.describe()))
+		}
+		if previous, duplicate := seen[keys[i]]; duplicate {
+			return nil, nil, InvalidInput("entries", fmt.Sprintf("Entries %d and %d have the same key %s", previous, i, entry.describe()))
+		}
+		seen[keys[i]] = i
+		value, err := s.record(i, entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		values[i] = value
+	}
+	return keys, values, nil
+}
+
+// record returns the entry's value to write, checked against the schema of its key and upcast to the current version
+func (s snapshots) record(i int, entry SnapshotEntry) ([]byte, error) {
+	schema, versioned := s.schemas[entry.ObjectType]
+	if !versioned {
+		return entry.Value, nil
+	}
+	if schema.MovedTo != "" {
+		return nil, InvalidInput("entries", fmt.Sprintf("Entry %d: the simple key %s is no longer used, the records are kept under %s keys", i, entry.Key, schema.MovedTo))
+	}
+	var stamp struct {
+		DocType string `json:"docType"`
+	}
+	if json.Unmarshal(entry.Value, &stamp) != nil || stamp.DocType != schema.DocType {
+		return nil, InvalidInput("entries", fmt.Sprintf("Entry %d: %s must be a %s", i, entry.describe(), schema.DocType))
+	}
+	value, _, err := schema.upcast(entry.Value)
+	if err != nil {
+		return nil, InvalidInput("entries", fmt.Sprintf("Entry %d: %s", i, err))
+	}
+	return value, nil
+}
+
+func (s snapshots) knows(objectType string) bool {
+	for _, known := range s.objectTypes {
+		if known == objectType {
+			return true
+		}
+	}
+	return false
+}
+
+func (e SnapshotEntry) describe() string {
+	if e.ObjectType == "" {
+		return e.Key
+	}
+	return e.ObjectType + "(" + strings.Join(e.Attributes, ", ") + ")"
+}
@@ -0,0 +1,142 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package ccutil_test
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/littlemyy/hlexample/ccutil"
+	"github.com/littlemyy/hlexample/contracts"
+	"github.com/littlemyy/hlexample/devledger"
+)
+
+var admin = devledger.Identity{MspId: "ARKMSP", User: "operator", Attrs: map[string]string{"role": ccutil.ADMIN_ROLE}}
+
+// exportAll pages through the contract's snapshot and returns its entries
+func exportAll(t *testing.T, ledger *devledger.Ledger, chaincode string) []ccutil.SnapshotEntry {
+	entries := []ccutil.SnapshotEntry{}
+	bookmark := ""
+	for {
+		result, err := ledger.Query(admin, chaincode, ccutil.EXPORT_FUNCTION, "7", bookmark)
+		if err != nil || result.Response.Status != 200 {
+			t.Fatalf("export failed: %v %s", err, result.Response.Message)
+		}
+		page := ccutil.Snapshot{}
+		if err = json.Unmarshal(result.Response.Payload, &page); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, page.Entries...)
+		if page.Bookmark == "" {
+			return entries
+		}
+		bookmark = page.Bookmark
+	}
+}
+
+func importEntries(t *testing.T, ledger *devledger.Ledger, chaincode string, entries ...ccutil.SnapshotEntry) *devledger.Result {
+	snapshot := ccutil.Snapshot{Format: ccutil.SNAPSHOT_FORMAT, Version: ccutil.SNAPSHOT_VERSION, Chaincode: chaincode, Entries: entries}
+	snapshotAsBytes, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := ledger.Invoke(admin, chaincode, ccutil.IMPORT_FUNCTION, string(snapshotAsBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	os.Setenv("CHAINCODE_DEV_MODE", "true")
+	defer os.Unsetenv("CHAINCODE_DEV_MODE")
+	source := contracts.Register(devledger.New())
+	for _, chaincode := range contracts.Names {
+		if result, err := source.Invoke(admin, chaincode, "generateTestData", "3", "12"); err != nil || result.Response.Status != 200 {
+			t.Fatalf("generateTestData of %s failed: %v %s", chaincode, err, result.Response.Message)
+		}
+	}
+
+	target := contracts.Register(devledger.New())
+	for _, chaincode := range contracts.Names {
+		entries := exportAll(t, source, chaincode)
+		if len(entries) == 0 {
+			t.Fatalf("nothing exported from %s", chaincode)
+		}
+		if result := importEntries(t, target, chaincode, entries...); result.Response.Status != 200 {
+			t.Fatalf("import into %s failed: %s", chaincode, result.Response.Message)
+		}
+	}
+	if differences := devledger.Diff(source.State(), target.State()); len(differences) > 0 {
+		t.Errorf("imported state differs: %v", differences)
+	}
+}
+
+func TestSnapshotImportRefusesTamperedEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry ccutil.SnapshotEntry
+		want  string
+	}{
+		{"another docType",
+			ccutil.SnapshotEntry{ObjectType: "asset", Attributes: []string{"AST1"}, Value: json.RawMessage(`{"docType":"saleApplication","schemaVersion":1,"serial":"S1","createdBy":"forged"}`)},
+			"asset(AST1) must be a leaseAsset"},
+		{"no docType",
+			ccutil.SnapshotEntry{ObjectType: "asset", Attributes: []string{"AST1"}, Value: json.RawMessage(`{"serial":"S1"}`)},
+			"asset(AST1) must be a leaseAsset"},
+		{"newer version",
+			ccutil.SnapshotEntry{ObjectType: "asset", Attributes: []string{"AST1"}, Value: json.RawMessage(`{"docType":"leaseAsset","schemaVersion":7,"serial":"S1"}`)},
+			"knows up to 1"},
+		{"legacy simple key",
+			ccutil.SnapshotEntry{Key: "ASSET3", Value: json.RawMessage(`{"docType":"leaseAsset","schemaVersion":1,"serial":"S1"}`)},
+			"the simple key ASSET3 is no longer used"},
+		{"not an object",
+			ccutil.SnapshotEntry{ObjectType: "quote", Attributes: []string{"AST1", "Q1"}, Value: json.RawMessage(`"buyoutQuote"`)},
+			"quote(AST1, Q1) must be a buyoutQuote"},
+	}
+	valid := ccutil.SnapshotEntry{ObjectType: "asset", Attributes: []string{"AST0"}, Value: json.RawMessage(`{"docType":"leaseAsset","schemaVersion":1,"serial":"S0"}`)}
+	for _, test := range tests {
+		ledger := contracts.Register(devledger.New())
+		result := importEntries(t, ledger, contracts.LYL, valid, test.entry)
+		if result.Response.Status != 400 || !strings.Contains(result.Response.Message, test.want) {
+			t.Errorf("%s: got %d %s, want 400 %q", test.name, result.Response.Status, result.Response.Message, test.want)
+		}
+		if state := ledger.State()[contracts.LYL]; len(state) != 0 {
+			t.Errorf("%s: %d keys written by a refused import", test.name, len(state))
+		}
+	}
+}
+
+func TestSnapshotImportUpcastsOlderVersions(t *testing.T) {
+	ledger := contracts.Register(devledger.New())
+	entry := ccutil.SnapshotEntry{ObjectType: "asset", Attributes: []string{"AST1"}, Value: json.RawMessage(`{"docType":"leaseAsset","schemaVersion":0,"serial":"S1","make":"VW","model":"Golf","leaser":"SEB"}`)}
+	if result := importEntries(t, ledger, contracts.LYL, entry); result.Response.Status != 200 {
+		t.Fatalf("import failed: %s", result.Response.Message)
+	}
+	result, err := ledger.Query(admin, contracts.LYL, "queryAsset", "AST1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(result.Response.Payload), `{"docType":"leaseAsset","schemaVersion":1,"serial":"S1"`) {
+		t.Errorf("got %s, want the asset stamped with version 1", result.Response.Payload)
+	}
+}
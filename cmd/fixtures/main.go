@@ -0,0 +1,61 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Writes generated test data as JSON fixtures, the same the contracts' generateTestData
+ * writes for the seed and count, e.g.
+ * go run ./cmd/fixtures -seed 42 -count 20 -o fixtures.json
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/littlemyy/hlexample/fixtures"
+)
+
+func main() {
+	seed := flag.Int64("seed", 1, "seed of the generator")
+	count := flag.Int("count", fixtures.DEFAULT_COUNT, "number of vehicles, lease assets and applications")
+	output := flag.String("o", "", "file to write, stdout when not given")
+	flag.Parse()
+
+	generated, err := fixtures.Generate(*seed, *count)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fixturesAsBytes, err := json.MarshalIndent(generated, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fixturesAsBytes = append(fixturesAsBytes, '\n')
+
+	if *output == "" {
+		os.Stdout.Write(fixturesAsBytes)
+		return
+	}
+	if err := ioutil.WriteFile(*output, fixturesAsBytes, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
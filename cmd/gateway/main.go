@@ -0,0 +1,61 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Local REST gateway for development: hosts the lyl, vehicle_register and sale_application
+ * contracts on a ledger persisted to a JSON file, e.g.
+ * go run ./cmd/gateway -addr :8080 -state devledger.json
+ * curl -H 'X-Msp-Id: SEBMSP' 'localhost:8080/assets?leaser=SEB'
+ */
+
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/littlemyy/hlexample/ccutil"
+	"github.com/littlemyy/hlexample/contracts"
+	"github.com/littlemyy/hlexample/devledger"
+	"github.com/littlemyy/hlexample/gateway"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	state := flag.String("state", "devledger.json", "file the ledger state is kept in")
+	mspId := flag.String("msp", "DevMSP", "MSP ID of requests without the "+gateway.MSP_ID_HEADER+" header")
+	user := flag.String("user", "developer", "user of requests without the "+gateway.USER_HEADER+" header")
+	attrs := flag.String("attrs", "", "attributes of requests without the "+gateway.ATTRIBUTES_HEADER+" header, e.g. role=registry_admin")
+	flag.Parse()
+
+	// the local ledger is for development, generateTestData and the other dev-only functions are enabled
+	os.Setenv(ccutil.DEV_MODE_ENV, "true")
+
+	ledger, err := devledger.Open(*state)
+	if err != nil {
+		log.Fatalf("Error opening the ledger state %s: %s", *state, err)
+	}
+	contracts.Register(ledger)
+
+	server := gateway.New(ledger, devledger.Identity{MspId: *mspId, User: *user, Attrs: devledger.ParseAttrs(*attrs)})
+	log.Printf("Gateway listening on %s, ledger state in %s", *addr, *state)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
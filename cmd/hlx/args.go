@@ -0,0 +1,392 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Flags of a command, made from the function's getMetadata: one per argument, taking a
+ * JSON argument whole (inline or @file), and one per field of a JSON argument, e.g.
+ * -seller-personal-code for application.seller.personalCode.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/littlemyy/hlexample/ccutil"
+	"gopkg.in/yaml.v2"
+)
+
+// fields nested deeper than this only come whole or from a file
+const MAX_FIELD_DEPTH int = 3
+
+// option is a flag setting an argument, or a field inside a JSON argument
+type option struct {
+	Arg   string
+	Path  []string //empty for the whole argument
+	Type  string   //JSON Schema type of a field
+	Usage string
+}
+
+// options lists the flags of a function, keyed by flag name
+func options(command Command, function ccutil.FunctionMetadata, definitions map[string]interface{}) map[string]option {
+	options := map[string]option{}
+	for _, arg := range function.Args {
+		if _, fixed := command.Fixed[arg.Name]; fixed {
+			continue
+		}
+		usage := arg.Description
+		if arg.Type == ccutil.JSON_ARG {
+			usage += " (JSON, or @file with JSON or YAML)"
+		}
+		if arg.Optional {
+			usage += ", optional"
+		}
+		options[flagName(arg.Name)] = option{Arg: arg.Name, Usage: usage}
+	}
+	for _, arg := range function.Args {
+		if _, fixed := command.Fixed[arg.Name]; fixed || arg.Type != ccutil.JSON_ARG {
+			continue
+		}
+		fieldOptions(arg.Name, arg.Schema, definitions, []string{}, arg.ReadOnly, options)
+	}
+	for name, target := range command.Aliases {
+		path := strings.Split(target, ".")
+		alias := option{Arg: path[0], Path: path[1:], Usage: "same as -" + flagName(path[0])}
+		if len(alias.Path) > 0 {
+			alias.Usage = "same as -" + flagName(strings.Join(alias.Path, "."))
+			for _, arg := range function.Args {
+				if arg.Name == alias.Arg {
+					alias.Type, _ = resolve(schemaAt(arg.Schema, definitions, alias.Path), definitions)["type"].(string)
+				}
+			}
+		}
+		options[name] = alias
+	}
+	return options
+}
+
+// Fields the contract sets itself, marked readOnly or listed in readOnly, get no flags
+func fieldOptions(arg string, schema map[string]interface{}, definitions map[string]interface{}, path []string, readOnly []string, options map[string]option) {
+	if len(path) >= MAX_FIELD_DEPTH {
+		return
+	}
+	properties, _ := resolve(schema, definitions)["properties"].(map[string]interface{})
+	names := []string{}
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property, _ := properties[name].(map[string]interface{})
+		if property[ccutil.READ_ONLY] == true || contains(readOnly, name) {
+			continue
+		}
+		property = resolve(property, definitions)
+		fieldPath := append(append([]string{}, path...), name)
+		switch fieldType, _ := property["type"].(string); fieldType {
+		case "object":
+			fieldOptions(arg, property, definitions, fieldPath, nil, options)
+		case "string", "integer", "number", "boolean":
+			flag := flagName(strings.Join(fieldPath, "."))
+			if _, taken := options[flag]; !taken {
+				options[flag] = option{Arg: arg, Path: fieldPath, Type: fieldType, Usage: fieldType + " " + arg + "." + strings.Join(fieldPath, ".")}
+			}
+		}
+	}
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve follows a $ref to the metadata's definitions
+func resolve(schema map[string]interface{}, definitions map[string]interface{}) map[string]interface{} {
+	if ref, isRef := schema["$ref"].(string); isRef {
+		definition, _ := definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+		return definition
+	}
+	return schema
+}
+
+func schemaAt(schema map[string]interface{}, definitions map[string]interface{}, path []string) map[string]interface{} {
+	for _, name := range path {
+		properties, _ := resolve(schema, definitions)["properties"].(map[string]interface{})
+		schema, _ = properties[name].(map[string]interface{})
+	}
+	return schema
+}
+
+// flagName turns an argument or field path into a flag, e.g. seller.personalCode -> seller-personal-code
+func flagName(name string) string {
+	var flag bytes.Buffer
+	for i, r := range name {
+		switch {
+		case r == '.' || r == '_':
+			flag.WriteRune('-')
+		case unicode.IsUpper(r):
+			if i > 0 && name[i-1] != '.' {
+				flag.WriteRune('-')
+			}
+			flag.WriteRune(unicode.ToLower(r))
+		default:
+			flag.WriteRune(r)
+		}
+	}
+	return flag.String()
+}
+
+// optionValue records the flags given, by name
+type optionValue struct {
+	name    string
+	boolean bool
+	given   map[string]string
+}
+
+func (v *optionValue) String() string {
+	return ""
+}
+
+func (v *optionValue) Set(value string) error {
+	v.given[v.name] = value
+	return nil
+}
+
+func (v *optionValue) IsBoolFlag() bool {
+	return v.boolean
+}
+
+// bindArgs puts the function's arguments together from the file, the flags and the fixed values
+func bindArgs(function ccutil.FunctionMetadata, options map[string]option, values map[string]interface{}, given map[string]string, fixed map[string]string) ([]string, error) {
+	types := map[string]string{}
+	for _, arg := range function.Args {
+		types[arg.Name] = arg.Type
+	}
+
+	flags := []string{}
+	for name := range given {
+		flags = append(flags, name)
+	}
+	sort.Strings(flags)
+	// whole arguments first, fields are then set into them
+	for _, name := range flags {
+		option := options[name]
+		if len(option.Path) > 0 {
+			continue
+		}
+		if types[option.Arg] != ccutil.JSON_ARG {
+			values[option.Arg] = given[name]
+			continue
+		}
+		value, err := jsonValue(given[name])
+		if err != nil {
+			return nil, fmt.Errorf("-%s: %s", name, err)
+		}
+		values[option.Arg] = value
+	}
+	for _, name := range flags {
+		option := options[name]
+		if len(option.Path) == 0 {
+			continue
+		}
+		value, err := fieldValue(given[name], option.Type)
+		if err != nil {
+			return nil, fmt.Errorf("-%s: %s", name, err)
+		}
+		object, err := objectArg(values[option.Arg])
+		if err != nil {
+			return nil, fmt.Errorf("-%s: %s is not a JSON object", name, option.Arg)
+		}
+		setField(object, option.Path, value)
+		values[option.Arg] = object
+	}
+	for name, value := range fixed {
+		values[name] = value
+	}
+
+	last := -1
+	for i, arg := range function.Args {
+		if _, isGiven := values[arg.Name]; isGiven {
+			last = i
+		}
+	}
+	args := []string{}
+	for i, arg := range function.Args {
+		value, isGiven := values[arg.Name]
+		if !isGiven {
+			if !arg.Optional {
+				return nil, fmt.Errorf("-%s is mandatory", flagName(arg.Name))
+			}
+			if i > last {
+				break
+			}
+			value = ""
+		}
+		text, err := argText(value)
+		if err != nil {
+			return nil, fmt.Errorf("-%s: %s", flagName(arg.Name), err)
+		}
+		args = append(args, text)
+	}
+	return args, nil
+}
+
+// jsonValue reads a JSON argument given inline or as @file
+func jsonValue(text string) (interface{}, error) {
+	if strings.HasPrefix(text, "@") {
+		return readFile(text[1:])
+	}
+	return decodeJSON([]byte(text))
+}
+
+func fieldValue(text string, fieldType string) (interface{}, error) {
+	switch fieldType {
+	case "integer":
+		if _, err := strconv.ParseInt(text, 10, 64); err != nil {
+			return nil, fmt.Errorf("%q is not an integer", text)
+		}
+		return json.Number(text), nil
+	case "number":
+		if _, err := strconv.ParseFloat(text, 64); err != nil {
+			return nil, fmt.Errorf("%q is not a number", text)
+		}
+		return json.Number(text), nil
+	case "boolean":
+		value, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not true or false", text)
+		}
+		return value, nil
+	}
+	return text, nil
+}
+
+// objectArg is the JSON argument fields are set into, the argument may have come as JSON text
+func objectArg(value interface{}) (map[string]interface{}, error) {
+	switch value := value.(type) {
+	case nil:
+		return map[string]interface{}{}, nil
+	case map[string]interface{}:
+		return value, nil
+	case string:
+		decoded, err := decodeJSON([]byte(value))
+		if object, isObject := decoded.(map[string]interface{}); err == nil && isObject {
+			return object, nil
+		}
+	}
+	return nil, fmt.Errorf("not a JSON object")
+}
+
+func setField(object map[string]interface{}, path []string, value interface{}) {
+	for _, name := range path[:len(path)-1] {
+		child, isObject := object[name].(map[string]interface{})
+		if !isObject {
+			child = map[string]interface{}{}
+			object[name] = child
+		}
+		object = child
+	}
+	object[path[len(path)-1]] = value
+}
+
+// argText passes text as it is and marshals anything else
+func argText(value interface{}) (string, error) {
+	if text, isText := value.(string); isText {
+		return text, nil
+	}
+	return marshal(value)
+}
+
+// readFile reads a JSON or, by the .yaml or .yml extension, a YAML file
+func readFile(path string) (interface{}, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var value interface{}
+		if err := yaml.Unmarshal(content, &value); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		return fromYAML(value), nil
+	}
+	value, err := decodeJSON(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return value, nil
+}
+
+// decodeJSON keeps numbers as they are written
+func decodeJSON(content []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %s", err)
+	}
+	return value, nil
+}
+
+// fromYAML turns YAML mappings into JSON objects
+func fromYAML(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		object := map[string]interface{}{}
+		for key, item := range value {
+			object[fmt.Sprint(key)] = fromYAML(item)
+		}
+		return object
+	case map[string]interface{}:
+		for key, item := range value {
+			value[key] = fromYAML(item)
+		}
+		return value
+	case []interface{}:
+		for i, item := range value {
+			value[i] = fromYAML(item)
+		}
+		return value
+	}
+	return value
+}
+
+// marshal is json.Marshal without escaping <, > and &
+func marshal(value interface{}) (string, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buffer.String(), "\n"), nil
+}
@@ -0,0 +1,119 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * The hlx commands, one for every function of the contracts. Functions not listed here,
+ * like the lease asset copy in vehicle_register, are reached with hlx call.
+ */
+
+package main
+
+import (
+	"github.com/littlemyy/hlexample/contracts"
+)
+
+type Command struct {
+	Noun      string
+	Verb      string
+	Chaincode string
+	Function  string
+	Query     bool              //reads only, runs as peer chaincode query
+	Aliases   map[string]string //flag -> argument, or argument.path of a field in a JSON argument
+	Fixed     map[string]string //arguments the command always passes
+}
+
+var applicationId = map[string]string{"id": "application.applicationId"}
+
+var Commands = []Command{
+	{Noun: "asset", Verb: "init", Chaincode: contracts.LYL, Function: "initLedger"},
+	{Noun: "asset", Verb: "generate", Chaincode: contracts.LYL, Function: "generateTestData"},
+	{Noun: "asset", Verb: "list", Chaincode: contracts.LYL, Function: "queryAllAssets", Query: true},
+	{Noun: "asset", Verb: "list-for-resale", Chaincode: contracts.LYL, Function: "queryAssetsForResale", Query: true},
+	{Noun: "asset", Verb: "get", Chaincode: contracts.LYL, Function: "queryAsset", Query: true, Aliases: map[string]string{"key": "assetKey"}},
+	{Noun: "asset", Verb: "create", Chaincode: contracts.LYL, Function: "createAsset"},
+	{Noun: "asset", Verb: "bulk-create", Chaincode: contracts.LYL, Function: "bulkCreateAssets"},
+	{Noun: "asset", Verb: "change-leaser", Chaincode: contracts.LYL, Function: "changeLeaser", Aliases: map[string]string{"key": "assetKey"}},
+	{Noun: "asset", Verb: "notice-default", Chaincode: contracts.LYL, Function: "noticeDefault", Aliases: map[string]string{"key": "assetKey"}},
+	{Noun: "asset", Verb: "start-grace-period", Chaincode: contracts.LYL, Function: "startGracePeriod", Aliases: map[string]string{"key": "assetKey"}},
+	{Noun: "asset", Verb: "order-repossession", Chaincode: contracts.LYL, Function: "orderRepossession", Aliases: map[string]string{"key": "assetKey"}},
+	{Noun: "asset", Verb: "record-repossession", Chaincode: contracts.LYL, Function: "recordRepossession", Aliases: map[string]string{"key": "assetKey"}},
+	{Noun: "asset", Verb: "remarket", Chaincode: contracts.LYL, Function: "remarketAsset", Aliases: map[string]string{"key": "assetKey"}},
+	{Noun: "asset", Verb: "return", Chaincode: contracts.LYL, Function: "returnAsset", Aliases: map[string]string{"key": "assetKey"}},
+	{Noun: "asset", Verb: "set-contract", Chaincode: contracts.LYL, Function: "setLeaseContract", Aliases: map[string]string{"key": "assetKey"}},
+	{Noun: "buyout", Verb: "quote", Chaincode: contracts.LYL, Function: "quoteBuyout", Aliases: map[string]string{"key": "assetKey"}},
+	{Noun: "buyout", Verb: "get", Chaincode: contracts.LYL, Function: "queryBuyoutQuote", Query: true, Aliases: map[string]string{"key": "assetKey"}},
+	{Noun: "buyout", Verb: "execute", Chaincode: contracts.LYL, Function: "executeBuyout", Aliases: map[string]string{"key": "assetKey"}},
+	{Noun: "assumption", Verb: "propose", Chaincode: contracts.LYL, Function: "proposeLeaseAssumption", Aliases: map[string]string{"key": "assetKey"}},
+	{Noun: "assumption", Verb: "approve", Chaincode: contracts.LYL, Function: "approveLeaseAssumption", Aliases: map[string]string{"key": "assetKey"}},
+	{Noun: "assumption", Verb: "reject", Chaincode: contracts.LYL, Function: "rejectLeaseAssumption", Aliases: map[string]string{"key": "assetKey"}},
+	{Noun: "portfolio", Verb: "transfer", Chaincode: contracts.LYL, Function: "transferPortfolio"},
+	{Noun: "portfolio", Verb: "get", Chaincode: contracts.LYL, Function: "queryPortfolioTransfer", Query: true, Aliases: map[string]string{"id": "transferId"}},
+
+	{Noun: "vehicle", Verb: "generate", Chaincode: contracts.VEHICLE_REGISTER, Function: "generateTestData"},
+	{Noun: "vehicle", Verb: "get", Chaincode: contracts.VEHICLE_REGISTER, Function: "queryVehicle", Query: true},
+	{Noun: "vehicle", Verb: "register", Chaincode: contracts.VEHICLE_REGISTER, Function: "registerVehicle", Aliases: map[string]string{"plate": "vehicle.registrationPlate"}},
+	{Noun: "vehicle", Verb: "set-owners", Chaincode: contracts.VEHICLE_REGISTER, Function: "setVehicleOwners"},
+	{Noun: "vehicle", Verb: "report-stolen", Chaincode: contracts.VEHICLE_REGISTER, Function: "reportStolen"},
+	{Noun: "vehicle", Verb: "report-recovered", Chaincode: contracts.VEHICLE_REGISTER, Function: "reportRecovered"},
+	{Noun: "vehicle", Verb: "scrap", Chaincode: contracts.VEHICLE_REGISTER, Function: "scrapVehicle"},
+	{Noun: "vehicle", Verb: "export", Chaincode: contracts.VEHICLE_REGISTER, Function: "exportVehicle"},
+	{Noun: "vehicle", Verb: "write-off", Chaincode: contracts.VEHICLE_REGISTER, Function: "writeOffVehicle"},
+	{Noun: "odometer", Verb: "record", Chaincode: contracts.VEHICLE_REGISTER, Function: "recordOdometerReading"},
+	{Noun: "odometer", Verb: "list", Chaincode: contracts.VEHICLE_REGISTER, Function: "queryOdometerReadings", Query: true},
+	{Noun: "inspection", Verb: "record", Chaincode: contracts.VEHICLE_REGISTER, Function: "recordInspection"},
+	{Noun: "inspection", Verb: "list", Chaincode: contracts.VEHICLE_REGISTER, Function: "queryInspections", Query: true},
+	{Noun: "lien", Verb: "register", Chaincode: contracts.VEHICLE_REGISTER, Function: "registerLien"},
+	{Noun: "lien", Verb: "release", Chaincode: contracts.VEHICLE_REGISTER, Function: "releaseLien"},
+	{Noun: "lien", Verb: "list", Chaincode: contracts.VEHICLE_REGISTER, Function: "queryLiens", Query: true},
+	{Noun: "plate", Verb: "vehicle", Chaincode: contracts.VEHICLE_REGISTER, Function: "queryVehicleByPlate", Query: true},
+	{Noun: "plate", Verb: "history", Chaincode: contracts.VEHICLE_REGISTER, Function: "queryPlateHistory", Query: true},
+	{Noun: "plate", Verb: "reassign", Chaincode: contracts.VEHICLE_REGISTER, Function: "reassignPlate"},
+
+	{Noun: "application", Verb: "test-data", Chaincode: contracts.SALE_APPLICATION, Function: "makeTestData"},
+	{Noun: "application", Verb: "generate", Chaincode: contracts.SALE_APPLICATION, Function: "generateTestData"},
+	{Noun: "application", Verb: "make", Chaincode: contracts.SALE_APPLICATION, Function: "makeApplication", Aliases: map[string]string{
+		"seller-code": "application.seller.personalCode",
+		"buyer-code":  "application.buyer.personalCode",
+		"vin":         "application.vehicle.vin",
+		"plate":       "application.vehicle.registrationPlate",
+	}},
+	{Noun: "application", Verb: "read", Chaincode: contracts.SALE_APPLICATION, Function: "readApplication", Query: true, Aliases: applicationId},
+	{Noun: "application", Verb: "accept", Chaincode: contracts.SALE_APPLICATION, Function: "acceptApplication", Aliases: applicationId, Fixed: map[string]string{"status": "accepted"}},
+	{Noun: "application", Verb: "reject", Chaincode: contracts.SALE_APPLICATION, Function: "rejectApplication", Aliases: applicationId, Fixed: map[string]string{"status": "rejected"}},
+	{Noun: "application", Verb: "cancel", Chaincode: contracts.SALE_APPLICATION, Function: "cancelApplication", Aliases: applicationId, Fixed: map[string]string{"status": "cancelled"}},
+	{Noun: "application", Verb: "finish", Chaincode: contracts.SALE_APPLICATION, Function: "finishApplication", Aliases: applicationId, Fixed: map[string]string{"status": "finished"}},
+	{Noun: "application", Verb: "approve", Chaincode: contracts.SALE_APPLICATION, Function: "approveApplication", Aliases: applicationId},
+	{Noun: "application", Verb: "approve-lien", Chaincode: contracts.SALE_APPLICATION, Function: "approveLienholderSale", Aliases: applicationId},
+	{Noun: "application", Verb: "by-buyer", Chaincode: contracts.SALE_APPLICATION, Function: "getBuyerApplications", Query: true},
+	{Noun: "application", Verb: "by-seller", Chaincode: contracts.SALE_APPLICATION, Function: "getSellerApplications", Query: true},
+	{Noun: "application", Verb: "incoming", Chaincode: contracts.SALE_APPLICATION, Function: "getInApplications", Query: true},
+	{Noun: "application", Verb: "outgoing", Chaincode: contracts.SALE_APPLICATION, Function: "getOutApplications", Query: true},
+	{Noun: "delegation", Verb: "grant", Chaincode: contracts.SALE_APPLICATION, Function: "grantDelegation"},
+	{Noun: "delegation", Verb: "revoke", Chaincode: contracts.SALE_APPLICATION, Function: "revokeDelegation"},
+	{Noun: "delegation", Verb: "list", Chaincode: contracts.SALE_APPLICATION, Function: "getDelegations", Query: true},
+}
+
+func findCommand(noun string, verb string) (Command, bool) {
+	for _, command := range Commands {
+		if command.Noun == noun && command.Verb == verb {
+			return command, true
+		}
+	}
+	return Command{}, false
+}
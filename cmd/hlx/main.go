@@ -0,0 +1,260 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * hlx builds calls of the lyl, vehicle_register and sale_application contracts from flags
+ * or a JSON/YAML file and prints the peer command making them, or with -local runs them on
+ * the ledger state the local gateway uses, e.g.
+ * go run ./cmd/hlx application make -idempotency-key order-1187 -seller-code 123456789 -buyer-code 123456779 -vin 78347837483784 -price 30000.00
+ * go run ./cmd/hlx -local application read -id LEP7K2QH4ZD3M6XBWNA
+ * Commands are listed by hlx functions, their flags by hlx <noun> <verb> -h.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/littlemyy/hlexample/ccutil"
+	"github.com/littlemyy/hlexample/contracts"
+	"github.com/littlemyy/hlexample/devledger"
+)
+
+func main() {
+	// the contracts log to stdout, which is kept for the output
+	stdout := os.Stdout
+	if devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+		os.Stdout = devNull
+	}
+	os.Exit(run(os.Args[1:], stdout, os.Stderr))
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	// -local may come before the command too
+	local := false
+	if len(args) > 0 && (args[0] == "-local" || args[0] == "--local") {
+		local = true
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return 0
+	case "functions":
+		return listCommands(stdout, stderr)
+	case "call":
+		if len(args) < 3 {
+			fmt.Fprintln(stderr, "usage: hlx call <chaincode> <function> [flags] [args...]")
+			return 2
+		}
+		command := Command{Noun: "call", Verb: args[1] + " " + args[2], Chaincode: args[1], Function: args[2]}
+		return execute(command, true, local, args[3:], stdout, stderr)
+	}
+	if len(args) < 2 {
+		fmt.Fprintf(stderr, "Unknown command %s, see hlx functions\n", args[0])
+		return 2
+	}
+	command, found := findCommand(args[0], args[1])
+	if !found {
+		fmt.Fprintf(stderr, "Unknown command %s %s, see hlx functions\n", args[0], args[1])
+		return 2
+	}
+	return execute(command, false, local, args[2:], stdout, stderr)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, `usage: hlx [-local] <noun> <verb> [flags]
+       hlx [-local] call <chaincode> <function> [flags] [args...]
+       hlx functions
+
+Prints the peer command making the call, or with -local runs it on the local ledger.
+The arguments come from flags and from a JSON or YAML file given with -f.`)
+}
+
+// listCommands prints the commands and the functions they call
+func listCommands(stdout io.Writer, stderr io.Writer) int {
+	for _, command := range Commands {
+		metadata, err := loadMetadata(command.Chaincode)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		function, err := findFunction(metadata, command.Function)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "%-40s %s %s: %s\n", command.Noun+" "+command.Verb, command.Chaincode, command.Function, function.Description)
+	}
+	return 0
+}
+
+func execute(command Command, call bool, local bool, args []string, stdout io.Writer, stderr io.Writer) int {
+	var function *ccutil.FunctionMetadata
+	metadata, err := loadMetadata(command.Chaincode)
+	if err == nil {
+		function, err = findFunction(metadata, command.Function)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("hlx "+command.Noun+" "+command.Verb, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	file := flags.String("f", "", "JSON or YAML file with the arguments by name")
+	flags.BoolVar(&local, "local", local, "run the call on the local ledger instead of printing the peer command")
+	state := flags.String("state", "devledger.json", "file the local ledger state is kept in")
+	mspId := flags.String("msp", "DevMSP", "MSP ID calling on the local ledger")
+	user := flags.String("user", "developer", "user calling on the local ledger")
+	attrs := flags.String("attrs", "", "attributes of the user calling on the local ledger, e.g. role=registry_admin")
+	channel := flags.String("channel", DEFAULT_CHANNEL, "channel of the peer command")
+	orderer := flags.String("orderer", DEFAULT_ORDERER, "orderer flags of the peer command")
+	name := flags.String("name", command.Chaincode, "chaincode name of the peer command")
+	query := command.Query
+	if call {
+		flags.BoolVar(&query, "query", false, "the function only reads, query instead of invoking")
+	}
+
+	given := map[string]string{}
+	options := options(command, *function, metadata.Definitions)
+	names := []string{}
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if flags.Lookup(name) != nil {
+			continue
+		}
+		flags.Var(&optionValue{name: name, boolean: options[name].Type == "boolean", given: given}, name, options[name].Usage)
+	}
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: hlx %s %s [flags]\n%s %s: %s\n", command.Noun, command.Verb, command.Chaincode, command.Function, function.Description)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	var callArgs []string
+	if call && flags.NArg() > 0 {
+		// positional arguments are passed as they are
+		callArgs = flags.Args()
+	} else {
+		if flags.NArg() > 0 {
+			fmt.Fprintf(stderr, "Unexpected arguments %s, arguments are given by flags\n", strings.Join(flags.Args(), " "))
+			return 2
+		}
+		values := map[string]interface{}{}
+		if *file != "" {
+			content, err := readFile(*file)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return 2
+			}
+			object, isObject := content.(map[string]interface{})
+			if !isObject {
+				fmt.Fprintf(stderr, "%s must hold an object with the arguments by name\n", *file)
+				return 2
+			}
+			values = object
+		}
+		callArgs, err = bindArgs(*function, options, values, given, command.Fixed)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+
+	if !local {
+		peer, err := peerCommand(query, *orderer, *channel, *name, command.Function, callArgs)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintln(stdout, peer)
+		return 0
+	}
+
+	// the local ledger is for development, generateTestData and the other dev-only functions are enabled
+	os.Setenv(ccutil.DEV_MODE_ENV, "true")
+	ledger, err := devledger.Open(*state)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error opening the ledger state %s: %s\n", *state, err)
+		return 1
+	}
+	contracts.Register(ledger)
+	identity := devledger.Identity{MspId: *mspId, User: *user, Attrs: devledger.ParseAttrs(*attrs)}
+	submit := ledger.Invoke
+	if query {
+		submit = ledger.Query
+	}
+	result, err := submit(identity, command.Chaincode, append([]string{command.Function}, callArgs...)...)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if !printResult(stdout, stderr, result) {
+		return 1
+	}
+	return 0
+}
+
+// loadMetadata reads the contract's getMetadata from a fresh local ledger
+func loadMetadata(chaincode string) (ccutil.Metadata, error) {
+	metadata := ccutil.Metadata{}
+	ledger := contracts.Register(devledger.New())
+	result, err := ledger.Query(devledger.Identity{MspId: "DevMSP", User: "hlx"}, chaincode, ccutil.METADATA_FUNCTION)
+	if err != nil {
+		return metadata, fmt.Errorf("%s, the chaincodes are %s", err, strings.Join(contracts.Names, ", "))
+	}
+	if result.Response.Status >= shim.ERRORTHRESHOLD {
+		return metadata, ccutil.ParseError(result.Response)
+	}
+	if err := json.Unmarshal(result.Response.Payload, &metadata); err != nil {
+		return metadata, fmt.Errorf("Unable to unmarshal the metadata of %s: %s", chaincode, err)
+	}
+	return metadata, nil
+}
+
+func findFunction(metadata ccutil.Metadata, name string) (*ccutil.FunctionMetadata, error) {
+	functions := []string{}
+	for i, function := range metadata.Functions {
+		if function.Name == name {
+			return &metadata.Functions[i], nil
+		}
+		functions = append(functions, function.Name)
+	}
+	return nil, ccutil.UnknownFunction(name, functions)
+}
@@ -0,0 +1,82 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * What hlx prints: the peer command making the call, or the result of running it locally.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/littlemyy/hlexample/ccutil"
+	"github.com/littlemyy/hlexample/devledger"
+)
+
+const DEFAULT_ORDERER string = "-o orderer.lyl-network.com:7050 --tls --cafile $ORDERER_CA"
+const DEFAULT_CHANNEL string = "$CHANNEL_NAME"
+
+// peerCommand is the peer CLI call, ready to paste into a shell of the network's cli container
+func peerCommand(query bool, orderer string, channel string, chaincode string, function string, args []string) (string, error) {
+	call, err := marshal(map[string][]string{"Args": append([]string{function}, args...)})
+	if err != nil {
+		return "", err
+	}
+	if query {
+		return fmt.Sprintf("peer chaincode query -C %s -n %s -c %s", channel, chaincode, shellQuote(call)), nil
+	}
+	return fmt.Sprintf("peer chaincode invoke %s -C %s -n %s -c %s", orderer, channel, chaincode, shellQuote(call)), nil
+}
+
+// shellQuote single quotes the text for sh, escaping the quotes in it
+func shellQuote(text string) string {
+	return "'" + strings.Replace(text, "'", `'\''`, -1) + "'"
+}
+
+// printResult writes the payload to stdout, indented when it is JSON, and a failed call's error to stderr
+func printResult(stdout io.Writer, stderr io.Writer, result *devledger.Result) bool {
+	if result.Response.Status >= shim.ERRORTHRESHOLD {
+		e := ccutil.ParseError(result.Response)
+		errorAsBytes, _ := json.MarshalIndent(e, "", "  ")
+		fmt.Fprintf(stderr, "Error: %s\n", errorAsBytes)
+		return false
+	}
+	if result.Committed {
+		fmt.Fprintf(stderr, "Committed transaction %s\n", result.TxID)
+	}
+	if result.Event != nil {
+		fmt.Fprintf(stderr, "Event %s: %s\n", result.Event.EventName, result.Event.Payload)
+	}
+	payload := result.Response.Payload
+	if len(payload) == 0 {
+		return true
+	}
+	var indented bytes.Buffer
+	if json.Indent(&indented, payload, "", "  ") == nil {
+		payload = indented.Bytes()
+	}
+	fmt.Fprintf(stdout, "%s\n", payload)
+	return true
+}
@@ -0,0 +1,121 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * The invocation log: one JSON object per line, e.g.
+ * {"txId":"8c1f...","chaincode":"vehicle_register","function":"reportStolen","args":["WVWZZZ1JZXW000001","Reported by the owner"],
+ *  "creator":{"mspId":"PoliceMSP","user":"officer1","attrs":{"role":"police"}},"timestamp":"2019-05-02T10:15:00Z"}
+ * The creator is a local identity or, as recorded on the channel, the MSP ID with the PEM
+ * certificate. Transient values are base64 like the peer CLI takes them. Empty lines and
+ * lines starting with # are skipped.
+ */
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos/msp"
+	"github.com/littlemyy/hlexample/devledger"
+)
+
+type Invocation struct {
+	Line      int               `json:"-"`
+	TxID      string            `json:"txId,omitempty"` //derived from the line when not recorded
+	Chaincode string            `json:"chaincode"`
+	Function  string            `json:"function"`
+	Args      []string          `json:"args"`
+	Creator   Creator           `json:"creator"`
+	Timestamp time.Time         `json:"timestamp"`
+	Transient map[string][]byte `json:"transient,omitempty"`
+	Query     bool              `json:"query,omitempty"` //evaluated only, nothing is committed
+}
+
+type Creator struct {
+	MspId       string            `json:"mspId"`
+	User        string            `json:"user,omitempty"`
+	Attrs       map[string]string `json:"attrs,omitempty"`
+	Certificate string            `json:"certificate,omitempty"` //PEM, used instead of user and attrs
+}
+
+// readLog reads the whole log, so a malformed line stops the replay before anything runs
+func readLog(r io.Reader) ([]Invocation, error) {
+	invocations := []Invocation{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		invocation := Invocation{}
+		if err := json.Unmarshal([]byte(text), &invocation); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		invocation.Line = line
+		switch {
+		case invocation.Chaincode == "":
+			return nil, fmt.Errorf("line %d: chaincode is mandatory", line)
+		case invocation.Function == "":
+			return nil, fmt.Errorf("line %d: function is mandatory", line)
+		case invocation.Creator.MspId == "":
+			return nil, fmt.Errorf("line %d: creator.mspId is mandatory", line)
+		case invocation.Timestamp.IsZero():
+			return nil, fmt.Errorf("line %d: timestamp is mandatory, the contracts record it", line)
+		}
+		if invocation.TxID == "" {
+			// the same log always gives the same transaction ids
+			sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", line, text)))
+			invocation.TxID = hex.EncodeToString(sum[:])
+		}
+		invocations = append(invocations, invocation)
+	}
+	return invocations, scanner.Err()
+}
+
+// Call is the invocation as the local ledger runs it
+func (i Invocation) Call() (devledger.Call, error) {
+	call := devledger.Call{
+		Chaincode: i.Chaincode,
+		Args:      append([]string{i.Function}, i.Args...),
+		Identity:  devledger.Identity{MspId: i.Creator.MspId, User: i.Creator.User, Attrs: i.Creator.Attrs},
+		TxID:      i.TxID,
+		Timestamp: i.Timestamp,
+		Transient: i.Transient,
+		Query:     i.Query,
+	}
+	if i.Creator.Certificate != "" {
+		creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: i.Creator.MspId, IdBytes: []byte(i.Creator.Certificate)})
+		if err != nil {
+			return call, fmt.Errorf("line %d: %s", i.Line, err)
+		}
+		call.Creator = creator
+	}
+	return call, nil
+}
@@ -0,0 +1,173 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Replays a log of invocations recorded on a channel against the contracts on a local
+ * in-memory ledger, to reproduce the world state offline, e.g.
+ * go run ./cmd/replay -from before.json -state after.json -events events.jsonl invocations.jsonl
+ * go run ./cmd/replay -expect expected.json invocations.jsonl
+ * Failed invocations are reported and replayed like on the channel, where they commit
+ * nothing. With -expect the resulting state is compared with the snapshot and the command
+ * exits with 1 when they differ.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/littlemyy/hlexample/ccutil"
+	"github.com/littlemyy/hlexample/contracts"
+	"github.com/littlemyy/hlexample/devledger"
+)
+
+// One event of the replay, written as a line of the events file
+type Event struct {
+	Line      int             `json:"line"`
+	TxID      string          `json:"txId"`
+	Chaincode string          `json:"chaincode"`
+	Name      string          `json:"name"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+func main() {
+	from := flag.String("from", "", "state snapshot to start from, an empty ledger when not given")
+	stateOut := flag.String("state", "", "file to write the resulting state to, stdout when neither -state nor -expect is given")
+	eventsOut := flag.String("events", "", "file to write the events to as JSON lines")
+	expect := flag.String("expect", "", "state snapshot the resulting state is compared with")
+	stop := flag.Bool("stop", false, "stop at the first failed invocation")
+	dev := flag.Bool("dev", false, "run the contracts in dev mode, enabling generateTestData")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: replay [flags] invocations.jsonl")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	// the contracts log to stdout, which may carry the state
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	if *dev {
+		os.Setenv(ccutil.DEV_MODE_ENV, "true")
+	}
+
+	logFile, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	invocations, err := readLog(logFile)
+	logFile.Close()
+	if err != nil {
+		log.Fatalf("Error reading %s: %s", flag.Arg(0), err)
+	}
+
+	ledger := devledger.New()
+	if *from != "" {
+		if ledger, err = devledger.Load(*from); err != nil {
+			log.Fatalf("Error loading the snapshot %s: %s", *from, err)
+		}
+	}
+	contracts.Register(ledger)
+
+	events := []Event{}
+	failed := 0
+	for _, invocation := range invocations {
+		call, err := invocation.Call()
+		if err != nil {
+			log.Fatal(err)
+		}
+		result, err := ledger.Execute(call)
+		if err != nil {
+			log.Fatalf("line %d: %s", invocation.Line, err)
+		}
+		if result.Response.Status >= shim.ERRORTHRESHOLD {
+			failed++
+			log.Printf("line %d: %s %s tx %s failed: %s", invocation.Line, invocation.Chaincode, invocation.Function, result.TxID, ccutil.ParseError(result.Response).Message)
+			if *stop {
+				os.Exit(1)
+			}
+			continue
+		}
+		log.Printf("line %d: %s %s tx %s: %d", invocation.Line, invocation.Chaincode, invocation.Function, result.TxID, result.Response.Status)
+		if result.Event != nil {
+			event := Event{Line: invocation.Line, TxID: result.TxID, Chaincode: result.Event.ChaincodeId, Name: result.Event.EventName}
+			if json.Valid(result.Event.Payload) {
+				event.Payload = result.Event.Payload
+			} else if len(result.Event.Payload) > 0 {
+				event.Payload, _ = json.Marshal(result.Event.Payload)
+			}
+			log.Printf("line %d: event %s %s", invocation.Line, event.Name, event.Payload)
+			events = append(events, event)
+		}
+	}
+	log.Printf("Replayed %d invocations, %d failed, %d events", len(invocations), failed, len(events))
+
+	if *eventsOut != "" {
+		if err := writeEvents(*eventsOut, events); err != nil {
+			log.Fatalf("Error writing the events: %s", err)
+		}
+	}
+	if *stateOut != "" {
+		if err := ledger.Save(*stateOut); err != nil {
+			log.Fatalf("Error writing the state: %s", err)
+		}
+	} else if *expect == "" {
+		if err := ledger.Dump(stdout); err != nil {
+			log.Fatalf("Error writing the state: %s", err)
+		}
+	}
+	if *expect != "" {
+		expected, err := devledger.Load(*expect)
+		if err != nil {
+			log.Fatalf("Error loading the snapshot %s: %s", *expect, err)
+		}
+		differences := devledger.Diff(expected.State(), ledger.State())
+		for _, difference := range differences {
+			fmt.Fprintln(stdout, difference)
+		}
+		if len(differences) > 0 {
+			log.Printf("The state differs from %s in %d keys", *expect, len(differences))
+			os.Exit(1)
+		}
+		log.Printf("The state matches %s", *expect)
+	}
+}
+
+func writeEvents(path string, events []Event) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetEscapeHTML(false)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
@@ -0,0 +1,41 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Chaincode process of the sale_application contract. Install it on the peer with
+ * peer chaincode install -n sale_application -v 1.0 -p github.com/littlemyy/hlexample/cmd/sale_application
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/littlemyy/hlexample/sale_application"
+)
+
+func main() {
+
+	// Create a new Smart Contract
+	err := shim.Start(new(sale_application.ApplicationContract))
+	if err != nil {
+		fmt.Printf("Error creating new Application Contract: %s", err)
+	}
+}
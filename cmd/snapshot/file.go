@@ -0,0 +1,80 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Snapshot files: one JSON document, or NDJSON with the snapshot header on the first line
+ * and one entry per line after it. Both are read the same way.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/littlemyy/hlexample/ccutil"
+)
+
+func readSnapshot(path string) (ccutil.Snapshot, error) {
+	snapshot := ccutil.Snapshot{}
+	file, err := os.Open(path)
+	if err != nil {
+		return snapshot, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	if err := decoder.Decode(&snapshot); err != nil {
+		return snapshot, fmt.Errorf("%s: %s", path, err)
+	}
+	if snapshot.Format != ccutil.SNAPSHOT_FORMAT {
+		return snapshot, fmt.Errorf("%s is not a snapshot, its format isn't %s", path, ccutil.SNAPSHOT_FORMAT)
+	}
+	for line := 2; decoder.More(); line++ {
+		entry := ccutil.SnapshotEntry{}
+		if err := decoder.Decode(&entry); err != nil {
+			return snapshot, fmt.Errorf("%s, entry %d: %s", path, line, err)
+		}
+		snapshot.Entries = append(snapshot.Entries, entry)
+	}
+	return snapshot, nil
+}
+
+func writeSnapshot(w io.Writer, snapshot ccutil.Snapshot, ndjson bool) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if !ndjson {
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(snapshot)
+	}
+	entries := snapshot.Entries
+	snapshot.Entries = nil
+	if err := encoder.Encode(snapshot); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
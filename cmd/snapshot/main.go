@@ -0,0 +1,210 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Exports a contract's world state from the local ledger into a snapshot, and imports
+ * snapshots into the local ledger or, as peer commands, into a channel, e.g.
+ * go run ./cmd/snapshot export -state devledger.json -ndjson -o lyl.ndjson lyl
+ * go run ./cmd/snapshot import -state staging.json lyl.ndjson
+ * go run ./cmd/snapshot import -peer -chunk 200 lyl.ndjson > import.sh
+ * A snapshot is imported in chunks of one transaction each, after a dry run on a copy of
+ * the ledger has validated every chunk.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/littlemyy/hlexample/ccutil"
+	"github.com/littlemyy/hlexample/contracts"
+	"github.com/littlemyy/hlexample/devledger"
+)
+
+const DEFAULT_ORDERER string = "-o orderer.lyl-network.com:7050 --tls --cafile $ORDERER_CA"
+
+func main() {
+	if len(os.Args) < 2 || (os.Args[1] != "export" && os.Args[1] != "import") {
+		fmt.Fprintln(os.Stderr, "usage: snapshot export [flags] <chaincode>\n       snapshot import [flags] <snapshot>")
+		os.Exit(2)
+	}
+	// the contracts log to stdout, which may carry the snapshot
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	// the local ledger is for development, its contracts run in dev mode
+	os.Setenv(ccutil.DEV_MODE_ENV, "true")
+
+	flags := flag.NewFlagSet("snapshot "+os.Args[1], flag.ExitOnError)
+	state := flags.String("state", "devledger.json", "file the local ledger state is kept in")
+	mspId := flags.String("msp", "DevMSP", "MSP ID calling on the local ledger")
+	user := flags.String("user", "developer", "user calling on the local ledger")
+	attrs := flags.String("attrs", ccutil.ROLE_ATTRIBUTE+"="+ccutil.ADMIN_ROLE, "attributes of the user calling on the local ledger")
+	if os.Args[1] == "export" {
+		output := flags.String("o", "", "file to write the snapshot to, stdout when not given")
+		ndjson := flags.Bool("ndjson", false, "write NDJSON, one entry per line")
+		pageSize := flags.Int("page", ccutil.MAX_PAGE_SIZE, "entries read per exportState call")
+		flags.Parse(os.Args[2:])
+		if flags.NArg() != 1 {
+			log.Fatal("The chaincode to export is missing, one of " + strings.Join(contracts.Names, ", "))
+		}
+		identity := devledger.Identity{MspId: *mspId, User: *user, Attrs: devledger.ParseAttrs(*attrs)}
+		snapshot, err := export(*state, identity, flags.Arg(0), *pageSize)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := io.Writer(stdout)
+		if *output != "" {
+			file, err := os.Create(*output)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer file.Close()
+			w = file
+		}
+		if err := writeSnapshot(w, snapshot, *ndjson); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Exported %d entries of %s", len(snapshot.Entries), snapshot.Chaincode)
+		return
+	}
+
+	chunkSize := flags.Int("chunk", 500, "entries per importState transaction, at most "+strconv.Itoa(ccutil.MAX_IMPORT_ENTRIES))
+	peer := flags.Bool("peer", false, "print the peer commands importing the chunks instead of importing into the local ledger")
+	channel := flags.String("channel", "$CHANNEL_NAME", "channel of the peer commands")
+	orderer := flags.String("orderer", DEFAULT_ORDERER, "orderer flags of the peer commands")
+	flags.Parse(os.Args[2:])
+	if flags.NArg() != 1 {
+		log.Fatal("The snapshot to import is missing")
+	}
+	if *chunkSize < 1 || *chunkSize > ccutil.MAX_IMPORT_ENTRIES {
+		log.Fatalf("-chunk must be between 1 and %d", ccutil.MAX_IMPORT_ENTRIES)
+	}
+	snapshot, err := readSnapshot(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	identity := devledger.Identity{MspId: *mspId, User: *user, Attrs: devledger.ParseAttrs(*attrs)}
+	chunks, err := chunk(snapshot, *chunkSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// dry run: on an empty ledger for a channel, on a copy of the local ledger otherwise
+	dryRun := devledger.New()
+	if _, err := os.Stat(*state); err == nil && !*peer {
+		if dryRun, err = devledger.Load(*state); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := importChunks(contracts.Register(dryRun), identity, snapshot.Chaincode, chunks); err != nil {
+		log.Fatalf("The snapshot can't be imported: %s", err)
+	}
+
+	if *peer {
+		for _, chunk := range chunks {
+			call, _ := json.Marshal(map[string][]string{"Args": {ccutil.IMPORT_FUNCTION, chunk}})
+			fmt.Fprintf(stdout, "peer chaincode invoke %s -C %s -n %s -c %s\n", *orderer, *channel, snapshot.Chaincode, shellQuote(string(call)))
+		}
+		log.Printf("Validated %d entries of %s in %d chunks", len(snapshot.Entries), snapshot.Chaincode, len(chunks))
+		return
+	}
+	ledger, err := devledger.Open(*state)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := importChunks(contracts.Register(ledger), identity, snapshot.Chaincode, chunks); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Imported %d entries of %s into %s", len(snapshot.Entries), snapshot.Chaincode, *state)
+}
+
+// export reads the chaincode's state page by page
+func export(state string, identity devledger.Identity, chaincode string, pageSize int) (ccutil.Snapshot, error) {
+	ledger, err := devledger.Load(state)
+	if err != nil {
+		return ccutil.Snapshot{}, err
+	}
+	contracts.Register(ledger)
+	snapshot := ccutil.Snapshot{Entries: []ccutil.SnapshotEntry{}}
+	bookmark := ""
+	for {
+		result, err := ledger.Query(identity, chaincode, ccutil.EXPORT_FUNCTION, strconv.Itoa(pageSize), bookmark)
+		if err != nil {
+			return snapshot, err
+		}
+		if result.Response.Status >= shim.ERRORTHRESHOLD {
+			return snapshot, ccutil.ParseError(result.Response)
+		}
+		page := ccutil.Snapshot{}
+		if err := json.Unmarshal(result.Response.Payload, &page); err != nil {
+			return snapshot, err
+		}
+		entries := append(snapshot.Entries, page.Entries...)
+		snapshot, snapshot.Entries = page, entries
+		if page.Bookmark == "" {
+			return snapshot, nil
+		}
+		bookmark = page.Bookmark
+	}
+}
+
+// chunk splits the snapshot into importState arguments
+func chunk(snapshot ccutil.Snapshot, size int) ([]string, error) {
+	chunks := []string{}
+	for start := 0; start < len(snapshot.Entries); start += size {
+		end := start + size
+		if end > len(snapshot.Entries) {
+			end = len(snapshot.Entries)
+		}
+		part := snapshot
+		part.Entries, part.Bookmark = snapshot.Entries[start:end], ""
+		partAsBytes, err := json.Marshal(part)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, string(partAsBytes))
+	}
+	return chunks, nil
+}
+
+func importChunks(ledger *devledger.Ledger, identity devledger.Identity, chaincode string, chunks []string) error {
+	for i, chunk := range chunks {
+		result, err := ledger.Invoke(identity, chaincode, ccutil.IMPORT_FUNCTION, chunk)
+		if err != nil {
+			return err
+		}
+		if result.Response.Status >= shim.ERRORTHRESHOLD {
+			return fmt.Errorf("chunk %d: %s", i+1, ccutil.ParseError(result.Response).Message)
+		}
+	}
+	return nil
+}
+
+// shellQuote single quotes the text for sh, escaping the quotes in it
+func shellQuote(text string) string {
+	return "'" + strings.Replace(text, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,45 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * The contracts of this repository under their chaincode names, for the development tools
+ * running them on a local ledger.
+ */
+
+package contracts
+
+import (
+	"github.com/littlemyy/hlexample/devledger"
+	"github.com/littlemyy/hlexample/lyl"
+	"github.com/littlemyy/hlexample/sale_application"
+	"github.com/littlemyy/hlexample/vehicle_register"
+)
+
+const LYL string = "lyl"
+const VEHICLE_REGISTER string = "vehicle_register"
+const SALE_APPLICATION string = "sale_application"
+
+var Names = []string{LYL, VEHICLE_REGISTER, SALE_APPLICATION}
+
+// Register deploys the three contracts on the ledger
+func Register(ledger *devledger.Ledger) *devledger.Ledger {
+	return ledger.Register(LYL, new(lyl.SmartContract)).
+		Register(VEHICLE_REGISTER, new(vehicle_register.SmartContract)).
+		Register(SALE_APPLICATION, new(sale_application.ApplicationContract))
+}
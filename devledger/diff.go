@@ -0,0 +1,89 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Comparison of world states, e.g. a replayed state against an expected snapshot.
+ */
+
+package devledger
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// World state by namespace (chaincode name) and key
+type State map[string]map[string][]byte
+
+// One key whose value differs, Expected or Actual is nil when the key is missing from that state
+type Difference struct {
+	Namespace string
+	Key       string
+	Expected  []byte
+	Actual    []byte
+}
+
+// String is "- namespace key" for a missing key, "+ namespace key" for an unexpected one and "~ namespace key" for a changed one, followed by the values
+func (d Difference) String() string {
+	switch {
+	case d.Actual == nil:
+		return fmt.Sprintf("- %s %q\n  expected: %s", d.Namespace, d.Key, d.Expected)
+	case d.Expected == nil:
+		return fmt.Sprintf("+ %s %q\n  actual:   %s", d.Namespace, d.Key, d.Actual)
+	}
+	return fmt.Sprintf("~ %s %q\n  expected: %s\n  actual:   %s", d.Namespace, d.Key, d.Expected, d.Actual)
+}
+
+// Diff lists the differences ordered by namespace and key, none when the states are equal
+func Diff(expected State, actual State) []Difference {
+	namespaces := map[string]bool{}
+	for namespace := range expected {
+		namespaces[namespace] = true
+	}
+	for namespace := range actual {
+		namespaces[namespace] = true
+	}
+	names := []string{}
+	for namespace := range namespaces {
+		names = append(names, namespace)
+	}
+	sort.Strings(names)
+
+	differences := []Difference{}
+	for _, namespace := range names {
+		keys := []string{}
+		for key := range expected[namespace] {
+			keys = append(keys, key)
+		}
+		for key := range actual[namespace] {
+			if _, inExpected := expected[namespace][key]; !inExpected {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			expectedValue, actualValue := expected[namespace][key], actual[namespace][key]
+			if !bytes.Equal(expectedValue, actualValue) {
+				differences = append(differences, Difference{Namespace: namespace, Key: key, Expected: expectedValue, Actual: actualValue})
+			}
+		}
+	}
+	return differences
+}
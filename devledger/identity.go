@@ -0,0 +1,111 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Callers of the local ledger. An identity is turned into a self-signed certificate with
+ * its attributes in the Fabric CA attribute extension, so the contracts read the MSP ID,
+ * subject and attributes (role, personalCode, registryCode) exactly as on a network.
+ */
+
+package devledger
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos/msp"
+)
+
+// Object identifier of the certificate extension Fabric CA puts the attributes in
+var attributesOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+type Identity struct {
+	MspId string            `json:"mspId"`
+	User  string            `json:"user"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+// String is e.g. SEBMSP/alice{role=police}, attributes sorted by name
+func (i Identity) String() string {
+	names := []string{}
+	for name := range i.Attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	attrs := []string{}
+	for _, name := range names {
+		attrs = append(attrs, name+"="+i.Attrs[name])
+	}
+	return i.MspId + "/" + i.User + "{" + strings.Join(attrs, ",") + "}"
+}
+
+// ParseAttrs reads attributes written as name=value pairs separated by commas
+func ParseAttrs(attrs string) map[string]string {
+	parsed := map[string]string{}
+	for _, pair := range strings.Split(attrs, ",") {
+		nameValue := strings.SplitN(pair, "=", 2)
+		if len(nameValue) == 2 && strings.TrimSpace(nameValue[0]) != "" {
+			parsed[strings.TrimSpace(nameValue[0])] = strings.TrimSpace(nameValue[1])
+		}
+	}
+	return parsed
+}
+
+// serialize returns the creator of the identity's transactions, a serialized identity as the peer passes it
+func (i Identity) serialize() ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: i.User, OrganizationalUnit: []string{"client"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if len(i.Attrs) > 0 {
+		attrsAsBytes, err := json.Marshal(map[string]map[string]string{"attrs": i.Attrs})
+		if err != nil {
+			return nil, err
+		}
+		template.ExtraExtensions = []pkix.Extension{{Id: attributesOID, Value: attrsAsBytes}}
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	certificatePEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate})
+	return proto.Marshal(&msp.SerializedIdentity{Mspid: i.MspId, IdBytes: certificatePEM})
+}
@@ -0,0 +1,326 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * In-process ledger for development: the contracts run against an in-memory world state,
+ * optionally persisted to a JSON file, without a Fabric network. Transactions run one at a
+ * time; an invoke commits its writes when the response is successful, a query never does.
+ */
+
+package devledger
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/littlemyy/hlexample/ccutil"
+)
+
+const DEFAULT_CHANNEL string = "devchannel"
+
+type Ledger struct {
+	ChannelID string
+	Now       func() time.Time //clock of the transaction timestamps
+	mutex     sync.Mutex
+	path      string
+	contracts map[string]shim.Chaincode
+	state     map[string]map[string][]byte //namespace (chaincode name) -> key -> value
+	creators  map[string][]byte
+}
+
+// Outcome of a transaction
+type Result struct {
+	TxID      string
+	Timestamp time.Time
+	Response  sc.Response
+	Event     *sc.ChaincodeEvent
+	Committed bool
+}
+
+// Call spells a transaction out in full, e.g. a recorded invocation being replayed
+type Call struct {
+	Chaincode string
+	Args      []string //function and its arguments
+	Identity  Identity
+	Creator   []byte    //serialized identity of the creator, made from Identity when empty
+	TxID      string    //random when empty
+	Timestamp time.Time //taken from Now when zero
+	Transient map[string][]byte
+	Query     bool //run without committing
+}
+
+type transaction struct {
+	ledger    *Ledger
+	txID      string
+	timestamp time.Time
+	creator   []byte
+	transient map[string][]byte
+	writes    map[string]map[string][]byte //empty value deletes the key
+	event     *sc.ChaincodeEvent
+	paginated bool
+}
+
+// New returns an empty ledger kept in memory only
+func New() *Ledger {
+	return &Ledger{
+		ChannelID: DEFAULT_CHANNEL,
+		Now:       time.Now,
+		contracts: map[string]shim.Chaincode{},
+		state:     map[string]map[string][]byte{},
+		creators:  map[string][]byte{},
+	}
+}
+
+// Open returns a ledger persisted to the file, loading the state the file already has
+func Open(path string) (*Ledger, error) {
+	ledger := New()
+	ledger.path = path
+	state, err := readState(path)
+	if err != nil {
+		return nil, err
+	}
+	ledger.state = state
+	return ledger, nil
+}
+
+// Load returns a ledger kept in memory only, starting from the state saved in the file
+func Load(path string) (*Ledger, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	ledger := New()
+	state, err := readState(path)
+	if err != nil {
+		return nil, err
+	}
+	ledger.state = state
+	return ledger, nil
+}
+
+// Save writes the state to the file, as Open and Load read it
+func (l *Ledger) Save(path string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return writeState(path, l.state)
+}
+
+// Dump writes the state as Save does, e.g. to stdout
+func (l *Ledger) Dump(w io.Writer) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	stateAsBytes, err := encodeState(l.state)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(stateAsBytes)
+	return err
+}
+
+// State returns a copy of the committed state
+func (l *Ledger) State() State {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	state := State{}
+	for namespace, values := range l.state {
+		state[namespace] = map[string][]byte{}
+		for key, value := range values {
+			state[namespace][key] = append([]byte{}, value...)
+		}
+	}
+	return state
+}
+
+// Register deploys the contract under the chaincode name other contracts invoke it by
+func (l *Ledger) Register(name string, contract shim.Chaincode) *Ledger {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.contracts[name] = contract
+	return l
+}
+
+// Contracts returns the registered chaincode names in alphabetical order
+func (l *Ledger) Contracts() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	names := []string{}
+	for name := range l.contracts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Invoke runs a transaction and commits its writes if the contract responds with success
+func (l *Ledger) Invoke(identity Identity, chaincode string, args ...string) (*Result, error) {
+	return l.Execute(Call{Chaincode: chaincode, Args: args, Identity: identity})
+}
+
+// Query runs a transaction without committing anything
+func (l *Ledger) Query(identity Identity, chaincode string, args ...string) (*Result, error) {
+	return l.Execute(Call{Chaincode: chaincode, Args: args, Identity: identity, Query: true})
+}
+
+// Execute runs the call as Invoke or, for a query, as Query does
+func (l *Ledger) Execute(call Call) (*Result, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, found := l.contracts[call.Chaincode]; !found {
+		return nil, errors.New("Chaincode " + call.Chaincode + " is not registered on the ledger")
+	}
+	var err error
+	creator := call.Creator
+	if len(creator) == 0 {
+		if creator, err = l.creator(call.Identity); err != nil {
+			return nil, err
+		}
+	}
+	txID := call.TxID
+	if txID == "" {
+		if txID, err = newTxID(); err != nil {
+			return nil, err
+		}
+	}
+	timestamp := call.Timestamp
+	if timestamp.IsZero() {
+		timestamp = l.Now()
+	}
+	transient := call.Transient
+	if transient == nil {
+		transient = map[string][]byte{}
+	}
+	tx := &transaction{ledger: l, txID: txID, timestamp: timestamp.UTC(), creator: creator, transient: transient, writes: map[string]map[string][]byte{}}
+
+	byteArgs := make([][]byte, len(call.Args))
+	for i, arg := range call.Args {
+		byteArgs[i] = []byte(arg)
+	}
+	response := tx.invoke(call.Chaincode, byteArgs)
+
+	result := &Result{TxID: tx.txID, Timestamp: tx.timestamp, Response: response}
+	if response.Status >= shim.ERRORTHRESHOLD {
+		return result, nil
+	}
+	result.Event = tx.event
+	if !call.Query {
+		if err := l.commit(tx.writes); err != nil {
+			return nil, err
+		}
+		result.Committed = true
+	}
+	return result, nil
+}
+
+// creator returns the identity's serialized certificate, made once per identity
+func (l *Ledger) creator(identity Identity) ([]byte, error) {
+	key := identity.String()
+	if creator, found := l.creators[key]; found {
+		return creator, nil
+	}
+	creator, err := identity.serialize()
+	if err != nil {
+		return nil, err
+	}
+	l.creators[key] = creator
+	return creator, nil
+}
+
+// commit applies the writes and persists the state, the state is left unchanged if persisting fails
+func (l *Ledger) commit(writes map[string]map[string][]byte) error {
+	if len(writes) == 0 {
+		return nil
+	}
+	previous := map[string]map[string][]byte{}
+	for namespace, keys := range writes {
+		if l.state[namespace] == nil {
+			l.state[namespace] = map[string][]byte{}
+		}
+		previous[namespace] = map[string][]byte{}
+		for key, value := range keys {
+			previous[namespace][key] = l.state[namespace][key]
+			setValue(l.state[namespace], key, value)
+		}
+	}
+	if l.path == "" {
+		return nil
+	}
+	if err := writeState(l.path, l.state); err != nil {
+		for namespace, keys := range previous {
+			for key, value := range keys {
+				setValue(l.state[namespace], key, value)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// An empty value deletes the key, as on a peer
+func setValue(state map[string][]byte, key string, value []byte) {
+	if len(value) == 0 {
+		delete(state, key)
+	} else {
+		state[key] = value
+	}
+}
+
+func (tx *transaction) invoke(chaincode string, args [][]byte) sc.Response {
+	contract, found := tx.ledger.contracts[chaincode]
+	if !found {
+		return ccutil.NotFound("Chaincode " + chaincode + " is not registered on the ledger").Response()
+	}
+	return contract.Invoke(&Stub{tx: tx, namespace: chaincode, args: args})
+}
+
+func (tx *transaction) checkWrite(key string) error {
+	if key == "" {
+		return errors.New("key must not be an empty string")
+	}
+	if !utf8.ValidString(key) {
+		return errors.New("invalid key. key must be a valid UTF-8 string")
+	}
+	if tx.paginated {
+		return errors.New("txSimulator does not support write after paginated query")
+	}
+	return nil
+}
+
+func (tx *transaction) write(namespace string, key string, value []byte) {
+	if tx.writes[namespace] == nil {
+		tx.writes[namespace] = map[string][]byte{}
+	}
+	tx.writes[namespace][key] = value
+}
+
+func newTxID() (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(nonce), nil
+}
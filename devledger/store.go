@@ -0,0 +1,129 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * The state file keeps every namespace as a list of entries ordered by key. Values written
+ * by the contracts are JSON and are stored as is, other values are stored base64 encoded.
+ */
+
+package devledger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type stateEntry struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Bytes []byte          `json:"bytes,omitempty"`
+}
+
+func readState(path string) (map[string]map[string][]byte, error) {
+	state := map[string]map[string][]byte{}
+	stateAsBytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	namespaces := map[string][]stateEntry{}
+	if err := json.Unmarshal(stateAsBytes, &namespaces); err != nil {
+		return nil, err
+	}
+	for namespace, entries := range namespaces {
+		state[namespace] = map[string][]byte{}
+		for _, entry := range entries {
+			if entry.Value != nil {
+				// the file is indented, the stored value was compact
+				value := bytes.Buffer{}
+				if err := json.Compact(&value, entry.Value); err != nil {
+					return nil, err
+				}
+				state[namespace][entry.Key] = value.Bytes()
+			} else {
+				state[namespace][entry.Key] = entry.Bytes
+			}
+		}
+	}
+	return state, nil
+}
+
+// writeState replaces the file in one step, so a crash never leaves half a state behind
+func writeState(path string, state map[string]map[string][]byte) error {
+	stateAsBytes, err := encodeState(state)
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(stateAsBytes); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func encodeState(state map[string]map[string][]byte) ([]byte, error) {
+	namespaces := map[string][]stateEntry{}
+	for namespace, values := range state {
+		keys := []string{}
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		entries := []stateEntry{}
+		for _, key := range keys {
+			entries = append(entries, newStateEntry(key, values[key]))
+		}
+		namespaces[namespace] = entries
+	}
+	stateAsBytes := bytes.Buffer{}
+	encoder := json.NewEncoder(&stateAsBytes)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(namespaces); err != nil {
+		return nil, err
+	}
+	return stateAsBytes.Bytes(), nil
+}
+
+// A value is stored as JSON only when it reads back byte for byte
+func newStateEntry(key string, value []byte) stateEntry {
+	if json.Valid(value) {
+		compacted := bytes.Buffer{}
+		if json.Compact(&compacted, value) == nil && bytes.Equal(compacted.Bytes(), value) {
+			return stateEntry{Key: key, Value: value}
+		}
+	}
+	return stateEntry{Key: key, Bytes: value}
+}
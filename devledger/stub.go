@@ -0,0 +1,315 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Chaincode stub of a transaction on the local ledger. Reads see the committed state only,
+ * as on a peer, and writes are buffered until the transaction commits. Functions the
+ * contracts don't use (private data, rich queries, history) are not supported.
+ */
+
+package devledger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const compositeKeyNamespace = "\x00"
+const minUnicodeRuneValue rune = 0
+const maxUnicodeRuneValue rune = utf8.MaxRune
+const emptyKeySubstitute = "\x01"
+
+type Stub struct {
+	// not implemented functions of the interface panic, the router turns that into an error response
+	shim.ChaincodeStubInterface
+	tx        *transaction
+	namespace string
+	args      [][]byte
+}
+
+func (s *Stub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *Stub) GetStringArgs() []string {
+	args := make([]string, len(s.args))
+	for i, arg := range s.args {
+		args[i] = string(arg)
+	}
+	return args
+}
+
+func (s *Stub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+func (s *Stub) GetArgsSlice() ([]byte, error) {
+	slice := []byte{}
+	for _, arg := range s.args {
+		slice = append(slice, arg...)
+	}
+	return slice, nil
+}
+
+func (s *Stub) GetTxID() string {
+	return s.tx.txID
+}
+
+func (s *Stub) GetChannelID() string {
+	return s.tx.ledger.ChannelID
+}
+
+// The called contract's writes become part of this transaction
+func (s *Stub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) sc.Response {
+	if channel != "" && channel != s.tx.ledger.ChannelID {
+		return shim.Error("Channel " + channel + " is not on the local ledger")
+	}
+	return s.tx.invoke(chaincodeName, args)
+}
+
+func (s *Stub) GetState(key string) ([]byte, error) {
+	if key == "" {
+		return nil, errors.New("key must not be an empty string")
+	}
+	value := s.tx.ledger.state[s.namespace][key]
+	if value == nil {
+		return nil, nil
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (s *Stub) PutState(key string, value []byte) error {
+	if err := s.tx.checkWrite(key); err != nil {
+		return err
+	}
+	s.tx.write(s.namespace, key, append([]byte{}, value...))
+	return nil
+}
+
+func (s *Stub) DelState(key string) error {
+	if err := s.tx.checkWrite(key); err != nil {
+		return err
+	}
+	s.tx.write(s.namespace, key, nil)
+	return nil
+}
+
+func (s *Stub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return errors.New("event name can not be nil string")
+	}
+	s.tx.event = &sc.ChaincodeEvent{ChaincodeId: s.namespace, TxId: s.tx.txID, EventName: name, Payload: payload}
+	return nil
+}
+
+func (s *Stub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, err
+	}
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	return s.rangeQuery(startKey, endKey, 0), nil
+}
+
+// Like on a peer, a transaction can't write after a paginated query
+func (s *Stub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *sc.QueryResponseMetadata, error) {
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, nil, err
+	}
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	return s.paginatedQuery(startKey, endKey, pageSize, bookmark)
+}
+
+func (s *Stub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	startKey, endKey, err := s.partialCompositeKeyRange(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	return s.rangeQuery(startKey, endKey, 0), nil
+}
+
+func (s *Stub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *sc.QueryResponseMetadata, error) {
+	startKey, endKey, err := s.partialCompositeKeyRange(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.paginatedQuery(startKey, endKey, pageSize, bookmark)
+}
+
+func (s *Stub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	if err := validateCompositeKeyAttribute(objectType); err != nil {
+		return "", err
+	}
+	key := compositeKeyNamespace + objectType + string(minUnicodeRuneValue)
+	for _, attribute := range attributes {
+		if err := validateCompositeKeyAttribute(attribute); err != nil {
+			return "", err
+		}
+		key += attribute + string(minUnicodeRuneValue)
+	}
+	return key, nil
+}
+
+func (s *Stub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	components := []string{}
+	componentIndex := 1
+	for i := 1; i < len(compositeKey); i++ {
+		if rune(compositeKey[i]) == minUnicodeRuneValue {
+			components = append(components, compositeKey[componentIndex:i])
+			componentIndex = i + 1
+		}
+	}
+	if len(components) == 0 {
+		return "", []string{}, nil
+	}
+	return components[0], components[1:], nil
+}
+
+func (s *Stub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	return nil, errors.New("ExecuteQuery not supported for leveldb")
+}
+
+func (s *Stub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return nil, errors.New("GetHistoryForKey is not supported by the local ledger")
+}
+
+func (s *Stub) GetCreator() ([]byte, error) {
+	return s.tx.creator, nil
+}
+
+func (s *Stub) GetTransient() (map[string][]byte, error) {
+	return s.tx.transient, nil
+}
+
+func (s *Stub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: s.tx.timestamp.Unix(), Nanos: int32(s.tx.timestamp.Nanosecond())}, nil
+}
+
+func (s *Stub) partialCompositeKeyRange(objectType string, keys []string) (string, string, error) {
+	startKey, err := s.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return "", "", err
+	}
+	return startKey, startKey + string(maxUnicodeRuneValue), nil
+}
+
+// Committed keys of the namespace in [startKey, endKey), an empty endKey has no upper bound
+func (s *Stub) rangeKeys(startKey, endKey string) []string {
+	keys := []string{}
+	for key := range s.tx.ledger.state[s.namespace] {
+		if key >= startKey && (endKey == "" || key < endKey) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Stub) rangeQuery(startKey, endKey string, limit int) *iterator {
+	keys := s.rangeKeys(startKey, endKey)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	results := make([]*queryresult.KV, len(keys))
+	for i, key := range keys {
+		results[i] = &queryresult.KV{Namespace: s.namespace, Key: key, Value: append([]byte{}, s.tx.ledger.state[s.namespace][key]...)}
+	}
+	return &iterator{results: results}
+}
+
+// The bookmark is the key the next page starts from, empty on the last page
+func (s *Stub) paginatedQuery(startKey, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *sc.QueryResponseMetadata, error) {
+	if pageSize <= 0 {
+		return nil, nil, errors.New("pageSize must be greater than zero")
+	}
+	if bookmark != "" {
+		if bookmark < startKey || (endKey != "" && bookmark >= endKey) {
+			return nil, nil, fmt.Errorf("bookmark %q is outside the queried range", bookmark)
+		}
+		startKey = bookmark
+	}
+	s.tx.paginated = true
+	page := s.rangeQuery(startKey, endKey, int(pageSize)+1)
+	metadata := &sc.QueryResponseMetadata{}
+	if len(page.results) > int(pageSize) {
+		metadata.Bookmark = page.results[pageSize].Key
+		page.results = page.results[:pageSize]
+	}
+	metadata.FetchedRecordsCount = int32(len(page.results))
+	return page, metadata, nil
+}
+
+func validateSimpleKeys(keys ...string) error {
+	for _, key := range keys {
+		if strings.HasPrefix(key, compositeKeyNamespace) {
+			return fmt.Errorf("first character of the key [%s] contains a null character which is not allowed", key)
+		}
+	}
+	return nil
+}
+
+func validateCompositeKeyAttribute(attribute string) error {
+	if !utf8.ValidString(attribute) {
+		return fmt.Errorf("not a valid utf8 string: [%x]", attribute)
+	}
+	for _, r := range attribute {
+		if r == minUnicodeRuneValue || r == maxUnicodeRuneValue {
+			return fmt.Errorf(`input contain unicode %#U starting at position [%d]. %#U and %#U are not allowed in the input attribute of a composite key`,
+				r, strings.IndexRune(attribute, r), minUnicodeRuneValue, maxUnicodeRuneValue)
+		}
+	}
+	return nil
+}
+
+// Iterator over a snapshot of query results
+type iterator struct {
+	results  []*queryresult.KV
+	position int
+}
+
+func (i *iterator) HasNext() bool {
+	return i.position < len(i.results)
+}
+
+func (i *iterator) Next() (*queryresult.KV, error) {
+	if !i.HasNext() {
+		return nil, errors.New("no more results")
+	}
+	i.position++
+	return i.results[i.position-1], nil
+}
+
+func (i *iterator) Close() error {
+	return nil
+}
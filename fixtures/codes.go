@@ -0,0 +1,96 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Identifiers with their check digits: Estonian personal codes and vehicle identification numbers.
+ */
+
+package fixtures
+
+import (
+	"fmt"
+	"time"
+)
+
+/*
+ * PersonalCode is the Estonian personal code GYYMMDDSSSC: G the sex and century of birth
+ * (3/4 for 1900-1999, 5/6 for 2000-2099, odd for men), the birth date, a serial number and
+ * the check digit.
+ */
+func PersonalCode(female bool, birthDate time.Time, serial int) string {
+	century := 3
+	if birthDate.Year() >= 2000 {
+		century = 5
+	}
+	if female {
+		century++
+	}
+	code := fmt.Sprintf("%d%s%03d", century, birthDate.Format("060102"), serial%1000)
+	return code + fmt.Sprint(personalCodeCheckDigit(code))
+}
+
+// Weighted sum modulo 11 with the weights 1..9,1, or 3..9,1,2,3 when that gives 10
+func personalCodeCheckDigit(code string) int {
+	for _, weights := range [][]int{{1, 2, 3, 4, 5, 6, 7, 8, 9, 1}, {3, 4, 5, 6, 7, 8, 9, 1, 2, 3}} {
+		sum := 0
+		for i, weight := range weights {
+			sum += int(code[i]-'0') * weight
+		}
+		if sum%11 < 10 {
+			return sum % 11
+		}
+	}
+	return 0
+}
+
+// Characters of a VIN, I, O and Q are left out
+const VIN_CHARACTERS string = "0123456789ABCDEFGHJKLMNPRSTUVWXYZ"
+
+var vinValues = map[byte]int{
+	'A': 1, 'B': 2, 'C': 3, 'D': 4, 'E': 5, 'F': 6, 'G': 7, 'H': 8,
+	'J': 1, 'K': 2, 'L': 3, 'M': 4, 'N': 5, 'P': 7, 'R': 9,
+	'S': 2, 'T': 3, 'U': 4, 'V': 5, 'W': 6, 'X': 7, 'Y': 8, 'Z': 9,
+}
+
+var vinWeights = []int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+
+// VIN makes a 17 character VIN with a valid check digit in the 9th position, random(n) returns 0..n-1
+func VIN(random func(n int) int) string {
+	vin := make([]byte, 17)
+	for i := range vin {
+		vin[i] = VIN_CHARACTERS[random(len(VIN_CHARACTERS))]
+	}
+	vin[8] = vinCheckDigit(string(vin))
+	return string(vin)
+}
+
+func vinCheckDigit(vin string) byte {
+	sum := 0
+	for i := 0; i < len(vin); i++ {
+		value, isLetter := vinValues[vin[i]]
+		if !isLetter {
+			value = int(vin[i] - '0')
+		}
+		sum += value * vinWeights[i]
+	}
+	if sum%11 == 10 {
+		return 'X'
+	}
+	return byte('0' + sum%11)
+}
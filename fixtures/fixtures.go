@@ -0,0 +1,210 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Seeded generator of consistent test data for the three contracts: persons, the vehicles
+ * they own, lease assets of those vehicles and sale applications between the persons. The
+ * same seed and count always give the same data, whichever contract or tool generates it.
+ */
+
+package fixtures
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/littlemyy/hlexample/ccutil"
+)
+
+// Most records one call generates, keeping the chaincode transactions a reasonable size
+const MAX_COUNT int = 500
+const DEFAULT_COUNT int = 10
+
+type Person struct {
+	FirstName    string `json:"firstName"`
+	LastName     string `json:"lastName"`
+	PersonalCode string `json:"personalCode"`
+}
+
+type Vehicle struct {
+	Vin               string `json:"vin"`
+	Mark              string `json:"mark"`
+	Model             string `json:"model"`
+	RegistrationPlate string `json:"registrationPlate"`
+	Owner             Person `json:"owner"`
+}
+
+type Asset struct {
+	Key    string `json:"key"`
+	Serial string `json:"serial"`
+	Make   string `json:"make"`
+	Model  string `json:"model"`
+	Leaser string `json:"leaser"`
+	Vin    string `json:"vin"`
+}
+
+type Application struct {
+	ApplicationId string  `json:"applicationId"`
+	Seller        Person  `json:"seller"`
+	Buyer         Person  `json:"buyer"`
+	Vehicle       Vehicle `json:"vehicle"`
+	Price         string  `json:"price"`
+	Status        string  `json:"status"`
+}
+
+type Fixtures struct {
+	Seed         int64         `json:"seed"`
+	Count        int           `json:"count"`
+	Persons      []Person      `json:"persons"`
+	Vehicles     []Vehicle     `json:"vehicles"`
+	Assets       []Asset       `json:"assets"`
+	Applications []Application `json:"applications"`
+}
+
+// Statuses of the sale application contract, generated in turn
+var Statuses = []string{"waiting", "accepted", "rejected", "cancelled", "finished"}
+
+var leasers = []string{"SEB", "Luminor", "Swedbank"}
+
+var models = [][2]string{
+	{"Toyota", "Prius"}, {"Ford", "Mustang"}, {"Hyundai", "Tucson"}, {"Volkswagen", "Passat"},
+	{"Tesla", "S"}, {"Peugeot", "205"}, {"Chery", "S22L"}, {"Fiat", "Punto"}, {"Tata", "Nano"},
+	{"Holden", "Barina"}, {"Audi", "A8"}, {"Skoda", "Octavia"}, {"Volvo", "XC60"}, {"BMW", "320d"},
+}
+
+var femaleNames = []string{"Mari", "Ulvi", "Pilvi", "Riita", "Kadri", "Liis", "Kristiina", "Triin", "Anu", "Merike"}
+var maleNames = []string{"Jaan", "Toomas", "Andres", "Peeter", "Mart", "Rein", "Priit", "Tiit", "Margus", "Indrek"}
+var lastNames = []string{"Tamm", "Saar", "Sepp", "Mägi", "Kask", "Kukk", "Rebane", "Ilves", "Pärn", "Koppel", "Maasikas", "Ratas", "Sädem"}
+
+/*
+ * Generate makes count vehicles, each with a lease asset and a sale application, and
+ * count+1 persons. The application of vehicle i is sold by person i to person i+1, and a
+ * finished application's vehicle is owned by its buyer.
+ */
+func Generate(seed int64, count int) (Fixtures, error) {
+	if count < 1 || count > MAX_COUNT {
+		return Fixtures{}, fmt.Errorf("count must be between 1 and %d", MAX_COUNT)
+	}
+	g := generator{random: rand.New(rand.NewSource(seed)), used: map[string]bool{}}
+	fixtures := Fixtures{Seed: seed, Count: count}
+
+	for i := 0; i <= count; i++ {
+		fixtures.Persons = append(fixtures.Persons, g.person())
+	}
+	for i := 0; i < count; i++ {
+		model := models[g.random.Intn(len(models))]
+		status := Statuses[i%len(Statuses)]
+		seller, buyer := fixtures.Persons[i], fixtures.Persons[i+1]
+		vehicle := Vehicle{Vin: g.vin(), Mark: model[0], Model: model[1], RegistrationPlate: g.plate(), Owner: seller}
+		if status == "finished" {
+			vehicle.Owner = buyer
+		}
+		fixtures.Vehicles = append(fixtures.Vehicles, vehicle)
+		fixtures.Assets = append(fixtures.Assets, Asset{Key: fmt.Sprintf("ASSET%d", 10+i), Serial: g.serial(),
+			Make: vehicle.Mark, Model: vehicle.Model, Leaser: leasers[g.random.Intn(len(leasers))], Vin: vehicle.Vin})
+		fixtures.Applications = append(fixtures.Applications, Application{ApplicationId: fmt.Sprintf("LEP%07d", i+1),
+			Seller: seller, Buyer: buyer, Vehicle: vehicle, Price: fmt.Sprintf("%d.00", 2000+100*g.random.Intn(580)), Status: status})
+	}
+	return fixtures, nil
+}
+
+// FromArgs generates the fixtures of a contract's generateTestData call. args: seed, optionally count
+func FromArgs(args []string) (Fixtures, error) {
+	seed, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return Fixtures{}, ccutil.InvalidInput("seed", "seed must be an integer")
+	}
+	count := DEFAULT_COUNT
+	if len(args) > 1 {
+		count, err = strconv.Atoi(args[1])
+		if err != nil || count < 1 || count > MAX_COUNT {
+			return Fixtures{}, ccutil.InvalidInput("count", fmt.Sprintf("count must be between 1 and %d", MAX_COUNT))
+		}
+	}
+	return Generate(seed, count)
+}
+
+type generator struct {
+	random *rand.Rand
+	used   map[string]bool //codes, VINs, plates and serials already given out
+}
+
+func (g *generator) person() Person {
+	female := g.random.Intn(2) == 0
+	names := maleNames
+	if female {
+		names = femaleNames
+	}
+	firstName := names[g.random.Intn(len(names))]
+	lastName := lastNames[g.random.Intn(len(lastNames))]
+	for {
+		birthDate := time.Date(1940, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, g.random.Intn(365*65))
+		code := PersonalCode(female, birthDate, g.random.Intn(1000))
+		if g.unused(code) {
+			return Person{FirstName: firstName, LastName: lastName, PersonalCode: code}
+		}
+	}
+}
+
+func (g *generator) vin() string {
+	for {
+		vin := VIN(func(n int) int { return g.random.Intn(n) })
+		if g.unused(vin) {
+			return vin
+		}
+	}
+}
+
+// Estonian plate: three digits and three letters, e.g. 123ABC
+func (g *generator) plate() string {
+	for {
+		plate := fmt.Sprintf("%03d%s", g.random.Intn(1000), g.letters("ABCDEFGHIJKLMNOPRSTUVZ", 3))
+		if g.unused(plate) {
+			return plate
+		}
+	}
+}
+
+// Lease asset serial like the ones of initLedger, e.g. 2KJvxs2J
+func (g *generator) serial() string {
+	for {
+		serial := g.letters("abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789", 8)
+		if g.unused(serial) {
+			return serial
+		}
+	}
+}
+
+func (g *generator) letters(alphabet string, n int) string {
+	letters := make([]byte, n)
+	for i := range letters {
+		letters[i] = alphabet[g.random.Intn(len(alphabet))]
+	}
+	return string(letters)
+}
+
+func (g *generator) unused(value string) bool {
+	if g.used[value] {
+		return false
+	}
+	g.used[value] = true
+	return true
+}
@@ -0,0 +1,104 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * REST routes of the gateway. A route calls one contract function; its arguments are bound
+ * by name (see getMetadata) from the path segments, the query string and the fields of a
+ * JSON request body. Body names the argument that takes the whole request body instead.
+ * GET routes are queries, the other methods submit transactions.
+ */
+
+package gateway
+
+import (
+	"github.com/littlemyy/hlexample/contracts"
+)
+
+type Route struct {
+	Method    string
+	Path      string
+	Chaincode string
+	Function  string
+	Body      string
+	Fixed     map[string]string //arguments the route always passes
+}
+
+var Routes = []Route{
+	// Lease assets
+	{Method: "GET", Path: "/assets", Chaincode: contracts.LYL, Function: "queryAllAssets"},
+	{Method: "POST", Path: "/assets", Chaincode: contracts.LYL, Function: "createAsset"},
+	{Method: "POST", Path: "/assets/bulk", Chaincode: contracts.LYL, Function: "bulkCreateAssets", Body: "assets"},
+	{Method: "GET", Path: "/assets/resale", Chaincode: contracts.LYL, Function: "queryAssetsForResale"},
+	{Method: "GET", Path: "/assets/{assetKey}", Chaincode: contracts.LYL, Function: "queryAsset"},
+	{Method: "PUT", Path: "/assets/{assetKey}/leaser", Chaincode: contracts.LYL, Function: "changeLeaser"},
+	{Method: "PUT", Path: "/assets/{assetKey}/contract", Chaincode: contracts.LYL, Function: "setLeaseContract", Body: "contract"},
+	{Method: "POST", Path: "/assets/{assetKey}/default-notice", Chaincode: contracts.LYL, Function: "noticeDefault"},
+	{Method: "POST", Path: "/assets/{assetKey}/grace-period", Chaincode: contracts.LYL, Function: "startGracePeriod"},
+	{Method: "POST", Path: "/assets/{assetKey}/repossession-order", Chaincode: contracts.LYL, Function: "orderRepossession"},
+	{Method: "POST", Path: "/assets/{assetKey}/repossession", Chaincode: contracts.LYL, Function: "recordRepossession"},
+	{Method: "POST", Path: "/assets/{assetKey}/remarketing", Chaincode: contracts.LYL, Function: "remarketAsset"},
+	{Method: "POST", Path: "/assets/{assetKey}/return", Chaincode: contracts.LYL, Function: "returnAsset"},
+	{Method: "POST", Path: "/assets/{assetKey}/buyout-quotes", Chaincode: contracts.LYL, Function: "quoteBuyout"},
+	{Method: "GET", Path: "/assets/{assetKey}/buyout-quotes/{quoteId}", Chaincode: contracts.LYL, Function: "queryBuyoutQuote"},
+	{Method: "POST", Path: "/assets/{assetKey}/buyout-quotes/{quoteId}/execution", Chaincode: contracts.LYL, Function: "executeBuyout"},
+	{Method: "POST", Path: "/assets/{assetKey}/assumption", Chaincode: contracts.LYL, Function: "proposeLeaseAssumption"},
+	{Method: "POST", Path: "/assets/{assetKey}/assumption/approval", Chaincode: contracts.LYL, Function: "approveLeaseAssumption"},
+	{Method: "POST", Path: "/assets/{assetKey}/assumption/rejection", Chaincode: contracts.LYL, Function: "rejectLeaseAssumption"},
+	{Method: "POST", Path: "/portfolio-transfers", Chaincode: contracts.LYL, Function: "transferPortfolio", Body: "transfer"},
+	{Method: "GET", Path: "/portfolio-transfers/{transferId}", Chaincode: contracts.LYL, Function: "queryPortfolioTransfer"},
+
+	// Vehicle register
+	{Method: "POST", Path: "/vehicles", Chaincode: contracts.VEHICLE_REGISTER, Function: "registerVehicle", Body: "vehicle"},
+	{Method: "GET", Path: "/vehicles/{vin}", Chaincode: contracts.VEHICLE_REGISTER, Function: "queryVehicle"},
+	{Method: "PUT", Path: "/vehicles/{vin}/owners", Chaincode: contracts.VEHICLE_REGISTER, Function: "setVehicleOwners", Body: "owners"},
+	{Method: "POST", Path: "/vehicles/{vin}/stolen-reports", Chaincode: contracts.VEHICLE_REGISTER, Function: "reportStolen"},
+	{Method: "POST", Path: "/vehicles/{vin}/recovery-reports", Chaincode: contracts.VEHICLE_REGISTER, Function: "reportRecovered"},
+	{Method: "GET", Path: "/vehicles/{vin}/odometer-readings", Chaincode: contracts.VEHICLE_REGISTER, Function: "queryOdometerReadings"},
+	{Method: "POST", Path: "/vehicles/{vin}/odometer-readings", Chaincode: contracts.VEHICLE_REGISTER, Function: "recordOdometerReading", Body: "reading"},
+	{Method: "GET", Path: "/vehicles/{vin}/inspections", Chaincode: contracts.VEHICLE_REGISTER, Function: "queryInspections"},
+	{Method: "POST", Path: "/vehicles/{vin}/inspections", Chaincode: contracts.VEHICLE_REGISTER, Function: "recordInspection", Body: "inspection"},
+	{Method: "GET", Path: "/vehicles/{vin}/liens", Chaincode: contracts.VEHICLE_REGISTER, Function: "queryLiens"},
+	{Method: "POST", Path: "/vehicles/{vin}/liens", Chaincode: contracts.VEHICLE_REGISTER, Function: "registerLien"},
+	{Method: "POST", Path: "/vehicles/{vin}/liens/{lienId}/release", Chaincode: contracts.VEHICLE_REGISTER, Function: "releaseLien"},
+	{Method: "POST", Path: "/vehicles/{vin}/scrapping", Chaincode: contracts.VEHICLE_REGISTER, Function: "scrapVehicle", Body: "deregistration"},
+	{Method: "POST", Path: "/vehicles/{vin}/export", Chaincode: contracts.VEHICLE_REGISTER, Function: "exportVehicle", Body: "deregistration"},
+	{Method: "POST", Path: "/vehicles/{vin}/write-off", Chaincode: contracts.VEHICLE_REGISTER, Function: "writeOffVehicle", Body: "deregistration"},
+	{Method: "GET", Path: "/plates/{plate}", Chaincode: contracts.VEHICLE_REGISTER, Function: "queryVehicleByPlate"},
+	{Method: "GET", Path: "/plates/{plate}/history", Chaincode: contracts.VEHICLE_REGISTER, Function: "queryPlateHistory"},
+	{Method: "POST", Path: "/plates/{plate}/reassignment", Chaincode: contracts.VEHICLE_REGISTER, Function: "reassignPlate"},
+
+	// Sale applications, {applicationId} makes the application argument {"applicationId":...}
+	{Method: "POST", Path: "/applications", Chaincode: contracts.SALE_APPLICATION, Function: "makeApplication", Body: "application"},
+	{Method: "GET", Path: "/applications/{applicationId}", Chaincode: contracts.SALE_APPLICATION, Function: "readApplication"},
+	{Method: "POST", Path: "/applications/{applicationId}/acceptance", Chaincode: contracts.SALE_APPLICATION, Function: "acceptApplication", Fixed: map[string]string{"status": "accepted"}},
+	{Method: "POST", Path: "/applications/{applicationId}/rejection", Chaincode: contracts.SALE_APPLICATION, Function: "rejectApplication", Fixed: map[string]string{"status": "rejected"}},
+	{Method: "POST", Path: "/applications/{applicationId}/cancellation", Chaincode: contracts.SALE_APPLICATION, Function: "cancelApplication", Fixed: map[string]string{"status": "cancelled"}},
+	{Method: "POST", Path: "/applications/{applicationId}/completion", Chaincode: contracts.SALE_APPLICATION, Function: "finishApplication", Fixed: map[string]string{"status": "finished"}},
+	{Method: "POST", Path: "/applications/{applicationId}/approvals", Chaincode: contracts.SALE_APPLICATION, Function: "approveApplication"},
+	{Method: "POST", Path: "/applications/{applicationId}/lien-approvals", Chaincode: contracts.SALE_APPLICATION, Function: "approveLienholderSale"},
+	{Method: "POST", Path: "/delegations", Chaincode: contracts.SALE_APPLICATION, Function: "grantDelegation", Body: "delegation"},
+	{Method: "GET", Path: "/principals/{principal}/delegations", Chaincode: contracts.SALE_APPLICATION, Function: "getDelegations"},
+	{Method: "POST", Path: "/principals/{principal}/delegations/{delegationId}/revocation", Chaincode: contracts.SALE_APPLICATION, Function: "revokeDelegation"},
+}
+
+// Routes reaching any function of any contract, arguments bound the same way
+var GenericRoutes = []Route{
+	{Method: "GET", Path: "/chaincodes/{chaincode}/{function}"},
+	{Method: "POST", Path: "/chaincodes/{chaincode}/{function}"},
+}
@@ -0,0 +1,378 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * HTTP gateway hosting the contracts on a local ledger, for developing clients without a
+ * Fabric network. Callers pick their identity with the X-Msp-Id, X-User and X-Attributes
+ * (e.g. "role=police,personalCode=49104231234") headers. Successful calls answer with the
+ * contract's payload, failed ones with the contract's error and its status.
+ */
+
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/littlemyy/hlexample/ccutil"
+	"github.com/littlemyy/hlexample/devledger"
+)
+
+const MSP_ID_HEADER string = "X-Msp-Id"
+const USER_HEADER string = "X-User"
+const ATTRIBUTES_HEADER string = "X-Attributes"
+const TX_ID_HEADER string = "X-Tx-Id"
+const EVENT_HEADER string = "X-Chaincode-Event"
+
+const MAX_BODY_SIZE int64 = 10 << 20
+
+type Server struct {
+	Ledger   *devledger.Ledger
+	Identity devledger.Identity //used for requests without identity headers
+	Routes   []Route
+	metadata map[string]ccutil.Metadata
+	mutex    sync.Mutex
+}
+
+func New(ledger *devledger.Ledger, identity devledger.Identity) *Server {
+	return &Server{
+		Ledger:   ledger,
+		Identity: identity,
+		Routes:   append(append([]Route{}, Routes...), GenericRoutes...),
+		metadata: map[string]ccutil.Metadata{},
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the UI is served from another origin during development
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Expose-Headers", TX_ID_HEADER+", "+EVENT_HEADER)
+	if r.Method == "OPTIONS" {
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join([]string{"Content-Type", MSP_ID_HEADER, USER_HEADER, ATTRIBUTES_HEADER}, ", "))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	route, params, err := s.match(r.Method, r.URL.Path)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	chaincode, function := route.Chaincode, route.Function
+	if chaincode == "" {
+		chaincode, function = params["chaincode"], params["function"]
+		delete(params, "chaincode")
+		delete(params, "function")
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MAX_BODY_SIZE))
+	if err != nil {
+		writeError(w, ccutil.InvalidInput("", "Unable to read the request body: "+err.Error()))
+		return
+	}
+	args, filters, err := s.bindArgs(route, chaincode, function, params, r.URL.Query(), body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	identity := s.identity(r)
+	var result *devledger.Result
+	if r.Method == "GET" {
+		result, err = s.Ledger.Query(identity, chaincode, append([]string{function}, args...)...)
+	} else {
+		result, err = s.Ledger.Invoke(identity, chaincode, append([]string{function}, args...)...)
+	}
+	if err != nil {
+		writeError(w, ccutil.Internal(err.Error()))
+		return
+	}
+	log.Printf("%s %s -> %s.%s as %s: %d tx %s", r.Method, r.URL.Path, chaincode, function, identity, result.Response.Status, result.TxID)
+	writeResult(w, result, filters)
+}
+
+// match finds the first route of the path, a path known for other methods only is not allowed
+func (s *Server) match(method string, path string) (Route, map[string]string, error) {
+	segments := splitPath(path)
+	pathFound := false
+	for _, route := range s.Routes {
+		params, matches := matchPath(splitPath(route.Path), segments)
+		if !matches {
+			continue
+		}
+		if route.Method == method {
+			return route, params, nil
+		}
+		pathFound = true
+	}
+	if pathFound {
+		return Route{}, nil, ccutil.NewError(http.StatusMethodNotAllowed, ccutil.INVALID_INPUT, "Method "+method+" is not allowed on "+path, "")
+	}
+	return Route{}, nil, ccutil.NotFound("No route for " + path)
+}
+
+func splitPath(path string) []string {
+	segments := []string{}
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+func matchPath(pattern []string, segments []string) (map[string]string, bool) {
+	if len(pattern) != len(segments) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, part := range pattern {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			params[part[1:len(part)-1]] = segments[i]
+		} else if part != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func (s *Server) identity(r *http.Request) devledger.Identity {
+	identity := s.Identity
+	if mspId := r.Header.Get(MSP_ID_HEADER); mspId != "" {
+		identity.MspId = mspId
+	}
+	if user := r.Header.Get(USER_HEADER); user != "" {
+		identity.User = user
+	}
+	if attrs := r.Header.Get(ATTRIBUTES_HEADER); attrs != "" {
+		identity.Attrs = devledger.ParseAttrs(attrs)
+	}
+	return identity
+}
+
+/*
+ * bindArgs lists the function's arguments in order. A JSON array body is taken as the argument
+ * list itself. Query parameters that aren't arguments filter the records of a JSON array result.
+ */
+func (s *Server) bindArgs(route Route, chaincode string, function string, params map[string]string, query url.Values, body []byte) ([]string, map[string]string, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' && route.Body == "" {
+		return positionalArgs(body)
+	}
+
+	metadata, err := s.functionMetadata(chaincode, function)
+	if err != nil {
+		return nil, nil, err
+	}
+	types := map[string]string{}
+	for _, arg := range metadata.Args {
+		types[arg.Name] = arg.Type
+	}
+
+	values := map[string]string{}
+	if len(body) > 0 {
+		if route.Body != "" {
+			values[route.Body] = string(body)
+		} else {
+			fields := map[string]json.RawMessage{}
+			if err := json.Unmarshal(body, &fields); err != nil {
+				return nil, nil, ccutil.InvalidInput("", "Request body must be a JSON object or array: "+err.Error())
+			}
+			for name, value := range fields {
+				values[name] = argValue(value, types[name])
+			}
+		}
+	}
+	filters := map[string]string{}
+	for name := range query {
+		if _, isArg := types[name]; isArg {
+			values[name] = query.Get(name)
+		} else {
+			filters[name] = query.Get(name)
+		}
+	}
+	for name, value := range params {
+		values[name] = value
+	}
+	for name, value := range route.Fixed {
+		values[name] = value
+	}
+	// a JSON argument not given otherwise is made of the path parameters
+	for _, arg := range metadata.Args {
+		if _, given := values[arg.Name]; !given && arg.Type == ccutil.JSON_ARG && len(params) > 0 {
+			paramsAsBytes, _ := json.Marshal(params)
+			values[arg.Name] = string(paramsAsBytes)
+		}
+	}
+
+	last := -1
+	for i, arg := range metadata.Args {
+		if _, given := values[arg.Name]; given {
+			last = i
+		}
+	}
+	args := []string{}
+	for i, arg := range metadata.Args {
+		value, given := values[arg.Name]
+		if !given {
+			if !arg.Optional {
+				return nil, nil, ccutil.InvalidInput(arg.Name, arg.Name+" is mandatory")
+			}
+			if i > last {
+				break
+			}
+		}
+		args = append(args, value)
+	}
+	return args, filters, nil
+}
+
+func positionalArgs(body []byte) ([]string, map[string]string, error) {
+	values := []json.RawMessage{}
+	if err := json.Unmarshal(body, &values); err != nil {
+		return nil, nil, ccutil.InvalidInput("", "Request body must be a JSON object or array: "+err.Error())
+	}
+	args := make([]string, len(values))
+	for i, value := range values {
+		args[i] = argValue(value, ccutil.STRING_ARG)
+	}
+	return args, map[string]string{}, nil
+}
+
+// argValue passes JSON arguments as they are and strings unquoted
+func argValue(value json.RawMessage, argType string) string {
+	if argType != ccutil.JSON_ARG {
+		text := ""
+		if json.Unmarshal(value, &text) == nil {
+			return text
+		}
+	}
+	return string(value)
+}
+
+// functionMetadata looks the function up in the contract's getMetadata, read once per contract
+func (s *Server) functionMetadata(chaincode string, function string) (*ccutil.FunctionMetadata, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	metadata, found := s.metadata[chaincode]
+	if !found {
+		result, err := s.Ledger.Query(s.Identity, chaincode, ccutil.METADATA_FUNCTION)
+		if err != nil {
+			return nil, ccutil.NotFound(err.Error())
+		}
+		if result.Response.Status >= shim.ERRORTHRESHOLD {
+			return nil, ccutil.ParseError(result.Response)
+		}
+		if err := json.Unmarshal(result.Response.Payload, &metadata); err != nil {
+			return nil, ccutil.Internal("Unable to unmarshal the metadata of " + chaincode)
+		}
+		s.metadata[chaincode] = metadata
+	}
+	functions := []string{}
+	for i, candidate := range metadata.Functions {
+		if candidate.Name == function {
+			return &metadata.Functions[i], nil
+		}
+		functions = append(functions, candidate.Name)
+	}
+	return nil, ccutil.UnknownFunction(function, functions)
+}
+
+func writeResult(w http.ResponseWriter, result *devledger.Result, filters map[string]string) {
+	w.Header().Set(TX_ID_HEADER, result.TxID)
+	if result.Response.Status >= shim.ERRORTHRESHOLD {
+		writeError(w, ccutil.ParseError(result.Response))
+		return
+	}
+	if result.Event != nil {
+		w.Header().Set(EVENT_HEADER, result.Event.EventName)
+	}
+	payload := filterRecords(result.Response.Payload, filters)
+	if len(payload) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if json.Valid(payload) {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	e, ok := err.(*ccutil.Error)
+	if !ok {
+		e = ccutil.Internal(err.Error())
+	}
+	status := int(e.Status)
+	if status < 400 || status > 599 {
+		status = http.StatusInternalServerError
+	}
+	body, _ := json.Marshal(e)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+/*
+ * filterRecords keeps the records of a JSON array whose fields equal the filters, e.g.
+ * ?leaser=SEB. Query results of the form {"Key":...,"Record":{...}} are matched on the record.
+ */
+func filterRecords(payload []byte, filters map[string]string) []byte {
+	if len(filters) == 0 {
+		return payload
+	}
+	records := []json.RawMessage{}
+	if json.Unmarshal(payload, &records) != nil {
+		return payload
+	}
+	kept := [][]byte{}
+	for _, record := range records {
+		fields := map[string]json.RawMessage{}
+		if json.Unmarshal(record, &fields) != nil {
+			continue
+		}
+		if inner, isQueryResult := fields["Record"]; isQueryResult {
+			fields = map[string]json.RawMessage{}
+			json.Unmarshal(inner, &fields)
+		}
+		matches := true
+		for name, wanted := range filters {
+			value, found := fields[name]
+			if !found || argValue(value, ccutil.STRING_ARG) != wanted {
+				matches = false
+			}
+		}
+		if matches {
+			kept = append(kept, record)
+		}
+	}
+	return append(append([]byte("["), bytes.Join(kept, []byte(","))...), ']')
+}
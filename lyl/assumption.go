@@ -0,0 +1,161 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Lease assumption for the "lyl" Smart Contract: the current lessee hands the lease
+ * over to a new lessee once the leaser has approved it
+ */
+
+package lyl
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/littlemyy/hlexample/ccutil"
+)
+
+// One lessee's period on the lease contract
+type LesseeTerm struct {
+	Lessee string `json:"lessee"`
+	From   string `json:"from"`           //YYYY-MM-DD
+	To     string `json:"to,omitempty"`   //YYYY-MM-DD
+	TxId   string `json:"txId,omitempty"` //assumption that made the lessee take over
+}
+
+// Define the lease assumption structure
+type LeaseAssumption struct {
+	NewLessee  string `json:"newLessee"`
+	ProposedBy string `json:"proposedBy"`
+	ProposedAt string `json:"proposedAt"`
+	TxId       string `json:"txId"`
+}
+
+// Certificate attribute carrying the personal code of a natural person calling the chaincode
+const PERSONAL_CODE_ATTRIBUTE string = "personalCode"
+
+// Called by the current lessee. args: assetKey, personal code of the new lessee
+func (s *SmartContract) proposeLeaseAssumption(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	newLessee := strings.TrimSpace(args[1])
+	if newLessee == "" {
+		return ccutil.InvalidInput("newLessee", "New lessee is mandatory").Response()
+	}
+
+	asset, err := getAsset(APIstub, args[0])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if err = assertBuyoutAllowed(asset); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if asset.Contract.Assumption != nil {
+		return ccutil.Conflict("A lease assumption is already waiting for the leaser's decision").Response()
+	}
+	if newLessee == asset.Contract.Lessee {
+		return ccutil.InvalidInput("newLessee", "New lessee is the current lessee").Response()
+	}
+
+	personalCode, found, err := cid.GetAttributeValue(APIstub, PERSONAL_CODE_ATTRIBUTE)
+	if err != nil || !found || personalCode != asset.Contract.Lessee {
+		return ccutil.Forbidden("Only the current lessee may propose a lease assumption").Response()
+	}
+
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	asset.Contract.Assumption = &LeaseAssumption{NewLessee: newLessee, ProposedBy: personalCode, ProposedAt: txTime.Format(time.RFC3339), TxId: APIstub.GetTxID()}
+
+	assetAsBytes, err := putAsset(APIstub, args[0], asset)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(assetAsBytes)
+}
+
+// Called by the leaser. args: assetKey
+func (s *SmartContract) approveLeaseAssumption(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	asset, err := getPendingAssumption(APIstub, args[0])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if err = assertBuyoutAllowed(asset); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	date := txTime.Format(ccutil.DATE_FORMAT)
+
+	contract := asset.Contract
+	if len(contract.Lessees) == 0 {
+		contract.Lessees = []LesseeTerm{{Lessee: contract.Lessee, From: contract.StartDate}}
+	}
+	contract.Lessees[len(contract.Lessees)-1].To = date
+	contract.Lessees = append(contract.Lessees, LesseeTerm{Lessee: contract.Assumption.NewLessee, From: date, TxId: contract.Assumption.TxId})
+	contract.Lessee = contract.Assumption.NewLessee
+	contract.Assumption = nil
+
+	assetAsBytes, err := putAsset(APIstub, args[0], asset)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(assetAsBytes)
+}
+
+// Called by the leaser. args: assetKey
+func (s *SmartContract) rejectLeaseAssumption(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	asset, err := getPendingAssumption(APIstub, args[0])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	asset.Contract.Assumption = nil
+
+	assetAsBytes, err := putAsset(APIstub, args[0], asset)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(assetAsBytes)
+}
+
+// Reads an asset with a pending lease assumption the caller may decide on
+func getPendingAssumption(APIstub shim.ChaincodeStubInterface, key string) (LeaseAsset, error) {
+	asset, err := getAsset(APIstub, key)
+	if err != nil {
+		return asset, err
+	}
+	if err = assertLeaser(APIstub, asset); err != nil {
+		return asset, err
+	}
+	if asset.Contract == nil || asset.Contract.Assumption == nil {
+		return asset, ccutil.NotFound(fmt.Sprintf("Asset %s has no pending lease assumption", key))
+	}
+	return asset, nil
+}
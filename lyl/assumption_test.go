@@ -0,0 +1,86 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package lyl_test
+
+import (
+	"testing"
+
+	"github.com/littlemyy/hlexample/contracts"
+	"github.com/littlemyy/hlexample/devledger"
+	"github.com/littlemyy/hlexample/lyl"
+)
+
+var lessee = devledger.Identity{MspId: "SEBMSP", User: "mari", Attrs: map[string]string{"personalCode": "38001010001"}}
+
+const leaseContract = `{"lessee":"38001010001","startDate":"2025-01-15","termMonths":36,"principal":"20000","interestRate":"5","residualValue":"5000","breakFeePercent":"2"}`
+
+func TestLeaseAssumption(t *testing.T) {
+	s := newScenario(t, "2025-01-15T09:00:00Z")
+	key := s.createAsset(seb, "S1", "Golf", "SEB", "")
+	s.ok(nil, seb, contracts.LYL, "setLeaseContract", key, leaseContract)
+
+	s.fails(403, luminor, contracts.LYL, "proposeLeaseAssumption", key, "49002020002")
+	s.fails(400, lessee, contracts.LYL, "proposeLeaseAssumption", key, "38001010001")
+	s.at("2025-03-10T15:30:00Z")
+	s.ok(nil, lessee, contracts.LYL, "proposeLeaseAssumption", key, "49002020002")
+	s.fails(409, lessee, contracts.LYL, "proposeLeaseAssumption", key, "49002020002")
+	s.fails(403, luminor, contracts.LYL, "approveLeaseAssumption", key)
+
+	s.at("2025-03-12T08:00:00Z")
+	s.ok(nil, seb, contracts.LYL, "approveLeaseAssumption", key)
+	asset := s.asset(key)
+	want := []lyl.LesseeTerm{
+		{Lessee: "38001010001", From: "2025-01-15", To: "2025-03-12"},
+		{Lessee: "49002020002", From: "2025-03-12"},
+	}
+	if asset.Contract.Lessee != "49002020002" || asset.Contract.Assumption != nil || len(asset.Contract.Lessees) != len(want) {
+		t.Fatalf("got the contract %+v", asset.Contract)
+	}
+	for i, term := range asset.Contract.Lessees {
+		term.TxId = ""
+		if term != want[i] {
+			t.Errorf("got the lessee term %+v, want %+v", term, want[i])
+		}
+	}
+	s.fails(404, seb, contracts.LYL, "approveLeaseAssumption", key)
+}
+
+func TestLeaseAssumptionOfAnEndedLease(t *testing.T) {
+	s := newScenario(t, "2025-01-15T09:00:00Z")
+	boughtOut := s.createAsset(seb, "S1", "Golf", "SEB", "")
+	defaulted := s.createAsset(seb, "S2", "Golf", "SEB", "")
+	for _, key := range []string{boughtOut, defaulted} {
+		s.ok(nil, seb, contracts.LYL, "setLeaseContract", key, leaseContract)
+		s.ok(nil, lessee, contracts.LYL, "proposeLeaseAssumption", key, "49002020002")
+	}
+
+	quote := lyl.BuyoutQuote{}
+	s.ok(&quote, seb, contracts.LYL, "quoteBuyout", boughtOut, "10")
+	s.ok(nil, seb, contracts.LYL, "executeBuyout", boughtOut, quote.QuoteId)
+	s.ok(nil, seb, contracts.LYL, "noticeDefault", defaulted, "Payments missed")
+
+	for _, key := range []string{boughtOut, defaulted} {
+		s.fails(409, seb, contracts.LYL, "approveLeaseAssumption", key)
+		s.ok(nil, seb, contracts.LYL, "rejectLeaseAssumption", key)
+		if asset := s.asset(key); asset.Contract.Lessee != "38001010001" || asset.Contract.Assumption != nil {
+			t.Errorf("got the contract %+v, want the assumption rejected", asset.Contract)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Bulk import for the "lyl" Smart Contract: creates the lease assets of a CSV or NDJSON
+ * payload in one transaction, e.g. when a bank joins with its existing portfolio.
+ * Every row is validated first; a single invalid row writes nothing and the error lists
+ * every invalid row.
+ */
+
+package lyl
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/littlemyy/hlexample/ccutil"
+)
+
+// Limits keeping a bulk import within one transaction
+const MAX_BULK_ASSETS int = 500
+const MAX_BULK_PAYLOAD int = 512 << 10
+
+// Payload formats
+const CSV_FORMAT string = "csv"
+const NDJSON_FORMAT string = "ndjson"
+
+// One row of a bulk import. CSV columns are named as the JSON fields, in any case and order.
+type BulkAsset struct {
+	Serial         string `json:"serial"`
+	Make           string `json:"make"`
+	Model          string `json:"model"`
+	Leaser         string `json:"leaser"`
+	Vin            string `json:"vin,omitempty"`
+	IdempotencyKey string `json:"idempotencyKey,omitempty"` //a resubmitted row with the same key returns the asset already created
+}
+
+// Why a row of a bulk import is invalid, rows are numbered from 1 without the CSV header
+type BulkRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type BulkResult struct {
+	Created int          `json:"created"`
+	Assets  []KeyedAsset `json:"assets"` //in the order of the rows
+}
+
+// args: format (csv or ndjson), payload
+func (s *SmartContract) bulkCreateAssets(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	format := strings.ToLower(strings.TrimSpace(args[0]))
+	if len(args[1]) > MAX_BULK_PAYLOAD {
+		return ccutil.InvalidInput("assets", fmt.Sprintf("The payload exceeds %d bytes, split it into several imports", MAX_BULK_PAYLOAD)).Response()
+	}
+	var rows []BulkAsset
+	var rowErrors []BulkRowError
+	var err error
+	switch format {
+	case CSV_FORMAT:
+		rows, err = readCSVAssets(args[1])
+	case NDJSON_FORMAT:
+		rows, rowErrors = readNDJSONAssets(args[1])
+	default:
+		return ccutil.InvalidInput("format", "Format must be "+CSV_FORMAT+" or "+NDJSON_FORMAT).Response()
+	}
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if len(rows) == 0 {
+		return ccutil.InvalidInput("assets", "The payload has no assets").Response()
+	}
+	if len(rows) > MAX_BULK_ASSETS {
+		return ccutil.InvalidInput("assets", fmt.Sprintf("The payload has more than %d assets, split it into several imports", MAX_BULK_ASSETS)).Response()
+	}
+
+	keys := make([]string, len(rows))
+	existing := make([][]byte, len(rows))
+	rowsOf := map[string]map[string]int{"serial": {}, "vin": {}, "idempotencyKey": {}}
+	for i := range rows {
+		row := &rows[i]
+		if row.Serial == "" && row.Make == "" && row.Model == "" && row.Leaser == "" {
+			// unreadable NDJSON rows are already reported
+			if !hasRowError(rowErrors, i+1) {
+				rowErrors = append(rowErrors, BulkRowError{Row: i + 1, Message: "Empty row"})
+			}
+			continue
+		}
+		rowErrors = append(rowErrors, validateBulkAsset(i+1, row, rowsOf)...)
+
+		keys[i] = ccutil.NewID(APIstub, ASSET_ID_PREFIX, i)
+		if row.IdempotencyKey != "" {
+			if keys[i], err = ccutil.IdempotentID(APIstub, ASSET_ID_PREFIX, row.IdempotencyKey); err != nil {
+				rowErrors = append(rowErrors, BulkRowError{Row: i + 1, Field: "idempotencyKey", Message: err.Error()})
+				continue
+			}
+			if existing[i], err = schemas.Get(APIstub, "asset", keys[i]); err != nil {
+				return ccutil.ErrorResponse(err)
+			}
+			if existing[i] != nil {
+				continue
+			}
+		}
+		if row.Vin != "" {
+			if err = checkLeasable(APIstub, row.Vin); err != nil {
+				rowError, isRowError := err.(*ccutil.Error)
+				if !isRowError || rowError.Status >= 500 {
+					return ccutil.ErrorResponse(err)
+				}
+				rowErrors = append(rowErrors, BulkRowError{Row: i + 1, Field: "vin", Message: rowError.Message})
+			}
+		}
+	}
+	if len(rowErrors) > 0 {
+		sort.SliceStable(rowErrors, func(i, j int) bool { return rowErrors[i].Row < rowErrors[j].Row })
+		invalid := ccutil.InvalidInput("assets", fmt.Sprintf("%d of %d rows are invalid, no assets were created", countRows(rowErrors), len(rows)))
+		invalid.Details = rowErrors
+		return invalid.Response()
+	}
+
+	result := BulkResult{Assets: make([]KeyedAsset, len(rows))}
+	for i, row := range rows {
+		if existing[i] != nil {
+			result.Assets[i] = KeyedAsset{Key: keys[i], Record: existing[i]}
+			continue
+		}
+		asset := LeaseAsset{Serial: row.Serial, Make: row.Make, Model: row.Model, Leaser: row.Leaser, Vin: row.Vin}
+		assetAsBytes, err := putAsset(APIstub, keys[i], asset)
+		if err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+		result.Assets[i] = KeyedAsset{Key: keys[i], Record: assetAsBytes}
+		result.Created++
+	}
+
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		return ccutil.Internal(fmt.Sprintf("Marshal failed for bulk result: %s", err)).Response()
+	}
+	return shim.Success(resultAsBytes)
+}
+
+// Reads the rows of a CSV payload with a header row, blank lines are skipped
+func readCSVAssets(payload string) ([]BulkAsset, error) {
+	reader := csv.NewReader(strings.NewReader(payload))
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, ccutil.InvalidInput("assets", fmt.Sprintf("Unable to read the CSV header: %s", err))
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		field := bulkField(name)
+		if field == "" {
+			return nil, ccutil.InvalidInput("assets", fmt.Sprintf("Unknown CSV column %q", name))
+		}
+		if _, seen := columns[field]; seen {
+			return nil, ccutil.InvalidInput("assets", fmt.Sprintf("CSV column %q is repeated", name))
+		}
+		columns[field] = i
+	}
+	for _, field := range []string{"serial", "make", "model", "leaser"} {
+		if _, found := columns[field]; !found {
+			return nil, ccutil.InvalidInput("assets", fmt.Sprintf("The CSV has no %s column", field))
+		}
+	}
+
+	rows := []BulkAsset{}
+	for len(rows) <= MAX_BULK_ASSETS {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, ccutil.InvalidInput("assets", fmt.Sprintf("Unable to read the CSV: %s", err))
+		}
+		value := func(field string) string {
+			if i, found := columns[field]; found {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		rows = append(rows, BulkAsset{Serial: value("serial"), Make: value("make"), Model: value("model"),
+			Leaser: value("leaser"), Vin: value("vin"), IdempotencyKey: value("idempotencyKey")})
+	}
+	return rows, nil
+}
+
+// bulkField returns the field a CSV column names, e.g. "VIN" or "Idempotency Key", or "" for no field
+func bulkField(column string) string {
+	name := strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.TrimSpace(column)))
+	for _, field := range []string{"serial", "make", "model", "leaser", "vin", "idempotencyKey"} {
+		if name == strings.ToLower(field) {
+			return field
+		}
+	}
+	return ""
+}
+
+// Reads one JSON object per line, blank lines are skipped. An unreadable line is reported as an empty row.
+func readNDJSONAssets(payload string) ([]BulkAsset, []BulkRowError) {
+	rows := []BulkAsset{}
+	rowErrors := []BulkRowError{}
+	for _, line := range strings.Split(payload, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if len(rows) > MAX_BULK_ASSETS {
+			break
+		}
+		row := BulkAsset{}
+		decoder := json.NewDecoder(bytes.NewReader([]byte(line)))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&row); err != nil {
+			rowErrors = append(rowErrors, BulkRowError{Row: len(rows) + 1, Message: "Invalid JSON: " + err.Error()})
+			row = BulkAsset{}
+		}
+		row.Serial, row.Make, row.Model = strings.TrimSpace(row.Serial), strings.TrimSpace(row.Make), strings.TrimSpace(row.Model)
+		row.Leaser, row.Vin, row.IdempotencyKey = strings.TrimSpace(row.Leaser), strings.TrimSpace(row.Vin), strings.TrimSpace(row.IdempotencyKey)
+		rows = append(rows, row)
+	}
+	return rows, rowErrors
+}
+
+// Checks the row's fields, and that no other row has its serial, VIN or idempotency key
+func validateBulkAsset(row int, asset *BulkAsset, rowsOf map[string]map[string]int) []BulkRowError {
+	rowErrors := []BulkRowError{}
+	for _, field := range []struct{ name, value string }{{"serial", asset.Serial}, {"make", asset.Make}, {"model", asset.Model}, {"leaser", asset.Leaser}} {
+		if field.value == "" {
+			rowErrors = append(rowErrors, BulkRowError{Row: row, Field: field.name, Message: "The " + field.name + " is mandatory"})
+		}
+	}
+	for _, field := range []struct{ name, value string }{{"serial", asset.Serial}, {"vin", asset.Vin}, {"idempotencyKey", asset.IdempotencyKey}} {
+		if field.value == "" {
+			continue
+		}
+		if other, seen := rowsOf[field.name][field.value]; seen {
+			rowErrors = append(rowErrors, BulkRowError{Row: row, Field: field.name, Message: fmt.Sprintf("Row %d has the same %s %s", other, field.name, field.value)})
+		} else {
+			rowsOf[field.name][field.value] = row
+		}
+	}
+	return rowErrors
+}
+
+func hasRowError(rowErrors []BulkRowError, row int) bool {
+	for _, rowError := range rowErrors {
+		if rowError.Row == row {
+			return true
+		}
+	}
+	return false
+}
+
+// Number of rows with errors, a row may have several
+func countRows(rowErrors []BulkRowError) int {
+	rows := map[int]bool{}
+	for _, rowError := range rowErrors {
+		rows[rowError.Row] = true
+	}
+	return len(rows)
+}
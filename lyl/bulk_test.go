@@ -0,0 +1,133 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package lyl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBulkField(t *testing.T) {
+	tests := map[string]string{
+		"serial":          "serial",
+		" Make ":          "make",
+		"MODEL":           "model",
+		"VIN":             "vin",
+		"Idempotency Key": "idempotencyKey",
+		"idempotency_key": "idempotencyKey",
+		"idempotency-key": "idempotencyKey",
+		"owner":           "",
+		"":                "",
+	}
+	for column, want := range tests {
+		if got := bulkField(column); got != want {
+			t.Errorf("bulkField(%q) = %q, want %q", column, got, want)
+		}
+	}
+}
+
+func TestReadCSVAssets(t *testing.T) {
+	rows, err := readCSVAssets("VIN,Serial,Make,Model,Leaser\n WVWZZZ1JZXW000001 ,S1,VW,Golf,SEB\n\n,S2,Ford,Focus,LHV\n")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := []BulkAsset{
+		{Serial: "S1", Make: "VW", Model: "Golf", Leaser: "SEB", Vin: "WVWZZZ1JZXW000001"},
+		{Serial: "S2", Make: "Ford", Model: "Focus", Leaser: "LHV"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got %+v, want %+v", rows, want)
+	}
+}
+
+func TestReadCSVAssetsHeader(t *testing.T) {
+	tests := map[string]string{
+		"":                                  "Unable to read the CSV header",
+		"serial,make,model,leaser,owner\n":  `Unknown CSV column "owner"`,
+		"serial,make,model,leaser,Serial\n": `CSV column "Serial" is repeated`,
+		"serial,make,model\n":               "The CSV has no leaser column",
+	}
+	for payload, want := range tests {
+		if _, err := readCSVAssets(payload); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("readCSVAssets(%q) error %v, want %q", payload, err, want)
+		}
+	}
+}
+
+func TestReadCSVAssetsLimit(t *testing.T) {
+	payload := "serial,make,model,leaser\n" + strings.Repeat("S,VW,Golf,SEB\n", MAX_BULK_ASSETS+10)
+	rows, err := readCSVAssets(payload)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// one row over the limit is read, so the caller can refuse the payload
+	if len(rows) != MAX_BULK_ASSETS+1 {
+		t.Errorf("read %d rows, want %d", len(rows), MAX_BULK_ASSETS+1)
+	}
+}
+
+func TestReadNDJSONAssets(t *testing.T) {
+	payload := `{"serial":" S1 ","make":"VW","model":"Golf","leaser":"SEB","idempotencyKey":"k1"}
+
+{"serial":"S2","owner":"x"}
+not json
+`
+	rows, rowErrors := readNDJSONAssets(payload)
+	want := []BulkAsset{
+		{Serial: "S1", Make: "VW", Model: "Golf", Leaser: "SEB", IdempotencyKey: "k1"},
+		{},
+		{},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got %+v, want %+v", rows, want)
+	}
+	if len(rowErrors) != 2 || rowErrors[0].Row != 2 || rowErrors[1].Row != 3 {
+		t.Errorf("got row errors %+v, want rows 2 and 3", rowErrors)
+	}
+}
+
+func TestValidateBulkAsset(t *testing.T) {
+	rowsOf := map[string]map[string]int{"serial": {}, "vin": {}, "idempotencyKey": {}}
+	first := BulkAsset{Serial: "S1", Make: "VW", Model: "Golf", Leaser: "SEB", Vin: "V1", IdempotencyKey: "k1"}
+	if rowErrors := validateBulkAsset(1, &first, rowsOf); len(rowErrors) != 0 {
+		t.Errorf("got %+v for a valid row", rowErrors)
+	}
+
+	second := BulkAsset{Serial: "S1", Vin: "V1", IdempotencyKey: "k2"}
+	rowErrors := validateBulkAsset(2, &second, rowsOf)
+	fields := []string{}
+	for _, rowError := range rowErrors {
+		if rowError.Row != 2 {
+			t.Errorf("got row %d, want 2", rowError.Row)
+		}
+		fields = append(fields, rowError.Field)
+	}
+	want := []string{"make", "model", "leaser", "serial", "vin"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("got errors of %v, want %v", fields, want)
+	}
+	if rowErrors[3].Message != "Row 1 has the same serial S1" {
+		t.Errorf("got message %q", rowErrors[3].Message)
+	}
+	if rowsOf["idempotencyKey"]["k2"] != 2 {
+		t.Errorf("idempotency key k2 not recorded for row 2")
+	}
+}
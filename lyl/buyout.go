@@ -0,0 +1,362 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Lease buyout and early termination quotes for the "lyl" Smart Contract
+ */
+
+package lyl
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/littlemyy/hlexample/ccutil"
+)
+
+// Define the lease contract structure. Amounts are decimal strings like "30000.00", rates are yearly percents.
+type LeaseContract struct {
+	Lessee          string           `json:"lessee"`
+	StartDate       string           `json:"startDate"` //YYYY-MM-DD, monthly payments fall on the same day of month, or the last day of a shorter month
+	TermMonths      int              `json:"termMonths"`
+	Principal       string           `json:"principal"`
+	InterestRate    string           `json:"interestRate"`
+	ResidualValue   string           `json:"residualValue"`
+	BreakFeePercent string           `json:"breakFeePercent"`                          //charged on the outstanding principal when ending the lease early
+	Lessees         []LesseeTerm     `json:"lessees,omitempty" metadata:"readOnly"`    //chain of lessees, kept by lease assumptions
+	Assumption      *LeaseAssumption `json:"assumption,omitempty" metadata:"readOnly"` //pending lease assumption
+}
+
+// Define the buyout quote structure
+type BuyoutQuote struct {
+	QuoteId              string `json:"quoteId"`
+	AssetKey             string `json:"assetKey"`
+	Lessee               string `json:"lessee"`
+	AsOf                 string `json:"asOf"`
+	ValidUntil           string `json:"validUntil"`
+	OutstandingPrincipal string `json:"outstandingPrincipal"`
+	ResidualValue        string `json:"residualValue"`
+	BreakFee             string `json:"breakFee"`
+	AccruedInterest      string `json:"accruedInterest"`
+	Total                string `json:"total"`
+	Status               string `json:"status"`
+}
+
+const QUOTE_ISSUED string = "issued"
+const QUOTE_EXECUTED string = "executed"
+
+// Largest amount of a lease contract, keeps its cents well within int64
+const MAX_AMOUNT float64 = 1e12
+
+// Largest yearly interest rate and break fee, in percent
+const MAX_PERCENT float64 = 100
+
+// args: assetKey, lease contract JSON
+func (s *SmartContract) setLeaseContract(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	asset, err := getAsset(APIstub, args[0])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if err = assertLeaser(APIstub, asset); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	contract := LeaseContract{}
+	if err = json.Unmarshal([]byte(args[1]), &contract); err != nil {
+		return ccutil.InvalidInput("", "Unable to unmarshal input JSON data: "+fmt.Sprint(err)).Response()
+	}
+	if err = validateLeaseContract(contract); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if asset.Contract != nil {
+		// the lessee of a running contract only changes through a lease assumption
+		if contract.Lessee != asset.Contract.Lessee {
+			return ccutil.Conflict("Lessee can only be changed by a lease assumption").Response()
+		}
+		contract.Lessees = asset.Contract.Lessees
+		contract.Assumption = asset.Contract.Assumption
+	} else {
+		contract.Lessees = nil
+		contract.Assumption = nil
+	}
+
+	asset.Contract = &contract
+	assetAsBytes, err := putAsset(APIstub, args[0], asset)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(assetAsBytes)
+}
+
+// args: assetKey, number of days the quote stays valid
+func (s *SmartContract) quoteBuyout(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	validDays, err := strconv.Atoi(args[1])
+	if err != nil || validDays < 1 {
+		return ccutil.InvalidInput("days", "Quote validity must be a positive number of days").Response()
+	}
+
+	asset, err := getAsset(APIstub, args[0])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if err = assertLeaser(APIstub, asset); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if err = assertBuyoutAllowed(asset); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	quote, err := calculateBuyout(*asset.Contract, txTime)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	quote.QuoteId = APIstub.GetTxID()
+	quote.AssetKey = args[0]
+	quote.ValidUntil = txTime.AddDate(0, 0, validDays).Format(time.RFC3339)
+	quote.Status = QUOTE_ISSUED
+
+	quoteAsBytes, err := putQuote(APIstub, quote)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(quoteAsBytes)
+}
+
+// args: assetKey, quoteId
+func (s *SmartContract) queryBuyoutQuote(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	quoteAsBytes, err := schemas.Get(APIstub, "quote", args[0], args[1])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if quoteAsBytes == nil {
+		return ccutil.NotFound("Couldn't find the quote " + args[1]).Response()
+	}
+
+	return shim.Success(quoteAsBytes)
+}
+
+// Executes a valid quote once the lessee has paid it: the asset becomes the lessee's property.
+// args: assetKey, quoteId
+func (s *SmartContract) executeBuyout(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	asset, err := getAsset(APIstub, args[0])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if err = assertLeaser(APIstub, asset); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if err = assertBuyoutAllowed(asset); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	quote := BuyoutQuote{}
+	if err = schemas.Load(APIstub, "quote", &quote, args[0], args[1]); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if quote.Status != QUOTE_ISSUED {
+		return ccutil.Conflict("Quote " + quote.QuoteId + " is already " + quote.Status).Response()
+	}
+	if quote.Lessee != asset.Contract.Lessee {
+		return ccutil.Conflict("Quote was issued to another lessee").Response()
+	}
+
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	validUntil, err := time.Parse(time.RFC3339, quote.ValidUntil)
+	if err != nil || txTime.After(validUntil) {
+		return ccutil.Conflict("Quote " + quote.QuoteId + " expired on " + quote.ValidUntil).Response()
+	}
+
+	quote.Status = QUOTE_EXECUTED
+	quoteAsBytes, err := putQuote(APIstub, quote)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	asset.Owner = asset.Contract.Lessee
+	asset.Status = BOUGHT_OUT
+	if _, err = putAsset(APIstub, args[0], asset); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(quoteAsBytes)
+}
+
+// Only running leases can be bought out
+func assertBuyoutAllowed(asset LeaseAsset) error {
+	if asset.Contract == nil {
+		return ccutil.Conflict("Asset has no lease contract")
+	}
+	if asset.Status != "" && asset.Status != ACTIVE && asset.Status != RETURNED {
+		return ccutil.Conflict(fmt.Sprintf("Asset in status %s can't be bought out", asset.Status))
+	}
+	return nil
+}
+
+func putQuote(APIstub shim.ChaincodeStubInterface, quote BuyoutQuote) ([]byte, error) {
+	return schemas.Save(APIstub, "quote", quote, quote.AssetKey, quote.QuoteId)
+}
+
+func validateLeaseContract(contract LeaseContract) error {
+	if strings.TrimSpace(contract.Lessee) == "" {
+		return ccutil.InvalidInput("lessee", "Lessee is mandatory")
+	}
+	if _, err := time.Parse(ccutil.DATE_FORMAT, contract.StartDate); err != nil {
+		return ccutil.InvalidInput("startDate", "startDate must be in YYYY-MM-DD format")
+	}
+	if contract.TermMonths < 1 {
+		return ccutil.InvalidInput("termMonths", "termMonths must be positive")
+	}
+	principal, err := parseAmount(contract.Principal)
+	if err != nil || principal <= 0 {
+		return ccutil.InvalidInput("principal", "principal must be a positive amount")
+	}
+	residual, err := parseAmount(contract.ResidualValue)
+	if err != nil || residual < 0 || residual > principal {
+		return ccutil.InvalidInput("residualValue", "residualValue must be an amount between 0 and principal")
+	}
+	if _, err := parsePercent(contract.InterestRate); err != nil {
+		return ccutil.InvalidInput("interestRate", fmt.Sprintf("interestRate must be a percent between 0 and %g", MAX_PERCENT))
+	}
+	if _, err := parsePercent(contract.BreakFeePercent); err != nil {
+		return ccutil.InvalidInput("breakFeePercent", fmt.Sprintf("breakFeePercent must be a percent between 0 and %g", MAX_PERCENT))
+	}
+	return nil
+}
+
+/*
+ * Calculates the amount needed to end the lease as of the given time.
+ * Monthly annuity payments amortize the principal down to the residual value at the end of the term.
+ * The quote is made of the principal still to be amortized, the residual value, a break fee on the
+ * outstanding principal when ending before the term, and interest accrued since the last payment.
+ */
+func calculateBuyout(contract LeaseContract, asOf time.Time) (BuyoutQuote, error) {
+	quote := BuyoutQuote{Lessee: contract.Lessee, AsOf: asOf.Format(time.RFC3339)}
+	if err := validateLeaseContract(contract); err != nil {
+		return quote, err
+	}
+
+	start, _ := time.Parse(ccutil.DATE_FORMAT, contract.StartDate)
+	if asOf.Before(start) {
+		return quote, ccutil.Conflict(fmt.Sprintf("Lease starts on %s", contract.StartDate))
+	}
+	principal, _ := parseAmount(contract.Principal)
+	residual, _ := parseAmount(contract.ResidualValue)
+	yearlyRate, _ := parsePercent(contract.InterestRate)
+	breakFeePercent, _ := parsePercent(contract.BreakFeePercent)
+
+	// payments made so far
+	months := (asOf.Year()-start.Year())*12 + int(asOf.Month()) - int(start.Month())
+	for months > 0 && addMonths(start, months).After(asOf) {
+		months--
+	}
+	if months > contract.TermMonths {
+		months = contract.TermMonths
+	}
+
+	n := float64(contract.TermMonths)
+	k := float64(months)
+	r := yearlyRate / 100 / 12
+	var balance float64
+	if r == 0 {
+		balance = float64(principal) - (float64(principal-residual)/n)*k
+	} else {
+		payment := (float64(principal)*math.Pow(1+r, n) - float64(residual)) * r / (math.Pow(1+r, n) - 1)
+		balance = float64(principal)*math.Pow(1+r, k) - payment*(math.Pow(1+r, k)-1)/r
+	}
+	outstanding := int64(math.Round(balance)) - residual
+	if outstanding < 0 || months == contract.TermMonths {
+		outstanding = 0
+	}
+
+	var breakFee int64
+	if months < contract.TermMonths {
+		breakFee = int64(math.Round(float64(outstanding) * breakFeePercent / 100))
+	}
+
+	var accrued int64
+	if months < contract.TermMonths {
+		lastPayment := addMonths(start, months)
+		days := math.Max(0, math.Floor(asOf.Sub(lastPayment).Hours()/24))
+		accrued = int64(math.Round(float64(outstanding+residual) * yearlyRate / 100 * days / 365))
+	}
+
+	quote.OutstandingPrincipal = formatAmount(outstanding)
+	quote.ResidualValue = formatAmount(residual)
+	quote.BreakFee = formatAmount(breakFee)
+	quote.AccruedInterest = formatAmount(accrued)
+	quote.Total = formatAmount(outstanding + residual + breakFee + accrued)
+	return quote, nil
+}
+
+// Payment dates fall on the start's day of month, or on the last day of shorter months: Jan 31, Feb 28, Mar 31
+func addMonths(start time.Time, months int) time.Time {
+	firstOfMonth := time.Date(start.Year(), start.Month()+time.Month(months), 1, 0, 0, 0, 0, start.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	day := start.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return firstOfMonth.AddDate(0, 0, day-1)
+}
+
+// Parses a decimal amount such as "30000.00" into cents, amounts beyond MAX_AMOUNT are refused
+func parseAmount(amount string) (int64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(amount), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) || math.Abs(value) > MAX_AMOUNT {
+		return 0, ccutil.InvalidInput("", fmt.Sprintf("Invalid amount %s", amount))
+	}
+	return int64(math.Round(value * 100)), nil
+}
+
+// Parses a percent such as "4.5", between 0 and MAX_PERCENT
+func parsePercent(percent string) (float64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(percent), 64)
+	if err != nil || math.IsNaN(value) || value < 0 || value > MAX_PERCENT {
+		return 0, ccutil.InvalidInput("", fmt.Sprintf("Invalid percent %s", percent))
+	}
+	return value, nil
+}
+
+// Formats cents as a decimal amount such as "30000.00"
+func formatAmount(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
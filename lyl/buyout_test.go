@@ -0,0 +1,106 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package lyl_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/littlemyy/hlexample/contracts"
+	"github.com/littlemyy/hlexample/lyl"
+)
+
+func TestBuyoutQuote(t *testing.T) {
+	tests := []struct {
+		name     string
+		contract lyl.LeaseContract
+		asOf     string
+		want     lyl.BuyoutQuote
+	}{
+		{"zero rate",
+			lyl.LeaseContract{StartDate: "2025-01-15", TermMonths: 12, Principal: "12000.00", InterestRate: "0", ResidualValue: "0", BreakFeePercent: "2"},
+			"2025-04-15T12:00:00Z",
+			lyl.BuyoutQuote{OutstandingPrincipal: "9000.00", ResidualValue: "0.00", BreakFee: "180.00", AccruedInterest: "0.00", Total: "9180.00"}},
+		{"month-end start",
+			lyl.LeaseContract{StartDate: "2025-01-31", TermMonths: 12, Principal: "12000.00", InterestRate: "12", ResidualValue: "0", BreakFeePercent: "0"},
+			"2025-03-01T12:00:00Z",
+			lyl.BuyoutQuote{OutstandingPrincipal: "11053.81", ResidualValue: "0.00", BreakFee: "0.00", AccruedInterest: "3.63", Total: "11057.44"}},
+		{"month-end start on the clamped payment date",
+			lyl.LeaseContract{StartDate: "2025-01-31", TermMonths: 12, Principal: "12000.00", InterestRate: "12", ResidualValue: "0", BreakFeePercent: "0"},
+			"2025-02-28T12:00:00Z",
+			lyl.BuyoutQuote{OutstandingPrincipal: "11053.81", ResidualValue: "0.00", BreakFee: "0.00", AccruedInterest: "0.00", Total: "11053.81"}},
+		{"before the first payment",
+			lyl.LeaseContract{StartDate: "2025-01-31", TermMonths: 12, Principal: "12000.00", InterestRate: "12", ResidualValue: "0", BreakFeePercent: "1"},
+			"2025-02-10T12:00:00Z",
+			lyl.BuyoutQuote{OutstandingPrincipal: "12000.00", ResidualValue: "0.00", BreakFee: "120.00", AccruedInterest: "39.45", Total: "12159.45"}},
+		{"full term",
+			lyl.LeaseContract{StartDate: "2024-01-01", TermMonths: 12, Principal: "20000.00", InterestRate: "5", ResidualValue: "5000.00", BreakFeePercent: "2"},
+			"2025-06-01T12:00:00Z",
+			lyl.BuyoutQuote{OutstandingPrincipal: "0.00", ResidualValue: "5000.00", BreakFee: "0.00", AccruedInterest: "0.00", Total: "5000.00"}},
+	}
+	for _, test := range tests {
+		s := newScenario(t, "2024-01-01T09:00:00Z")
+		key := s.createAsset(seb, "S1", "Golf", "SEB", "")
+		test.contract.Lessee = "38001010001"
+		contractAsBytes, _ := json.Marshal(test.contract)
+		s.ok(nil, seb, contracts.LYL, "setLeaseContract", key, string(contractAsBytes))
+
+		s.at(test.asOf)
+		quote := lyl.BuyoutQuote{}
+		s.ok(&quote, seb, contracts.LYL, "quoteBuyout", key, "10")
+		got := lyl.BuyoutQuote{OutstandingPrincipal: quote.OutstandingPrincipal, ResidualValue: quote.ResidualValue,
+			BreakFee: quote.BreakFee, AccruedInterest: quote.AccruedInterest, Total: quote.Total}
+		if got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLeaseContractValidation(t *testing.T) {
+	valid := `"lessee":"38001010001","startDate":"2025-01-15","termMonths":12`
+	tests := map[string]string{
+		`"principal":"12000","interestRate":"NaN","residualValue":"0","breakFeePercent":"0"`:   "interestRate",
+		`"principal":"12000","interestRate":"Inf","residualValue":"0","breakFeePercent":"0"`:   "interestRate",
+		`"principal":"12000","interestRate":"-1","residualValue":"0","breakFeePercent":"0"`:    "interestRate",
+		`"principal":"12000","interestRate":"101","residualValue":"0","breakFeePercent":"0"`:   "interestRate",
+		`"principal":"12000","interestRate":"5","residualValue":"0","breakFeePercent":"NaN"`:   "breakFeePercent",
+		`"principal":"12000","interestRate":"5","residualValue":"0","breakFeePercent":"-Inf"`:  "breakFeePercent",
+		`"principal":"NaN","interestRate":"5","residualValue":"0","breakFeePercent":"0"`:       "principal",
+		`"principal":"Inf","interestRate":"5","residualValue":"0","breakFeePercent":"0"`:       "principal",
+		`"principal":"1e300","interestRate":"5","residualValue":"0","breakFeePercent":"0"`:     "principal",
+		`"principal":"12000","interestRate":"5","residualValue":"13000","breakFeePercent":"0"`: "residualValue",
+	}
+	s := newScenario(t, "2025-01-15T09:00:00Z")
+	key := s.createAsset(seb, "S1", "Golf", "SEB", "")
+	for fields, field := range tests {
+		result := s.invoke(seb, contracts.LYL, "setLeaseContract", key, "{"+valid+","+fields+"}")
+		if result.Response.Status != 400 || !json.Valid([]byte(result.Response.Message)) {
+			t.Errorf("%s: got %d %s, want 400", fields, result.Response.Status, result.Response.Message)
+			continue
+		}
+		e := struct{ Field string }{}
+		json.Unmarshal([]byte(result.Response.Message), &e)
+		if e.Field != field {
+			t.Errorf("%s: got the error of %q, want %q", fields, e.Field, field)
+		}
+	}
+	s.fails(400, seb, contracts.LYL, "setLeaseContract", key, `{"lessee":"38001010001","startDate":"2025-01-15","termMonths":0,"principal":"12000","interestRate":"5","residualValue":"0","breakFeePercent":"0"}`)
+	s.fails(400, seb, contracts.LYL, "setLeaseContract", key, `{"lessee":"38001010001","startDate":"2025-1-15","termMonths":12,"principal":"12000","interestRate":"5","residualValue":"0","breakFeePercent":"0"}`)
+}
@@ -0,0 +1,108 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package lyl_test
+
+import (
+	"testing"
+
+	"github.com/littlemyy/hlexample/contracts"
+	"github.com/littlemyy/hlexample/devledger"
+	"github.com/littlemyy/hlexample/lyl"
+)
+
+func TestDefaultWorkflow(t *testing.T) {
+	s := newScenario(t, "2025-01-15T09:00:00Z")
+	key := s.createAsset(seb, "S1", "Golf", "SEB", "")
+
+	s.fails(403, luminor, contracts.LYL, "noticeDefault", key, "Payments missed")
+	s.fails(409, seb, contracts.LYL, "startGracePeriod", key, "14")
+	s.ok(nil, seb, contracts.LYL, "noticeDefault", key, "Payments missed")
+	s.fails(400, seb, contracts.LYL, "startGracePeriod", key, "-1")
+	s.ok(nil, seb, contracts.LYL, "startGracePeriod", key, "14")
+	if asset := s.asset(key); asset.Status != lyl.GRACE_PERIOD || asset.GraceEnds != "2025-01-29T09:00:00Z" {
+		t.Errorf("got the status %s until %s, want the grace period until 2025-01-29T09:00:00Z", asset.Status, asset.GraceEnds)
+	}
+
+	s.at("2025-01-29T08:59:59Z")
+	s.fails(409, seb, contracts.LYL, "orderRepossession", key, "Not paid")
+	s.at("2025-01-29T09:00:00Z")
+	s.ok(nil, seb, contracts.LYL, "orderRepossession", key, "Not paid")
+	s.ok(nil, seb, contracts.LYL, "recordRepossession", key, "Picked up")
+	s.fails(409, seb, contracts.LYL, "noticeDefault", key, "Payments missed")
+	s.ok(nil, seb, contracts.LYL, "remarketAsset", key, "Listed at the auction")
+
+	asset := s.asset(key)
+	steps := []string{}
+	for _, step := range asset.DefaultSteps {
+		steps = append(steps, step.Status)
+	}
+	want := []string{lyl.DEFAULT_NOTICE, lyl.GRACE_PERIOD, lyl.REPOSSESSION_ORDERED, lyl.REPOSSESSED, lyl.REMARKETED}
+	if len(steps) != len(want) {
+		t.Fatalf("got the steps %v, want %v", steps, want)
+	}
+	for i := range want {
+		if steps[i] != want[i] {
+			t.Errorf("got the steps %v, want %v", steps, want)
+		}
+	}
+
+	forResale := []lyl.KeyedAsset{}
+	s.ok(&forResale, seb, contracts.LYL, "queryAssetsForResale")
+	if len(forResale) != 1 || forResale[0].Key != key {
+		t.Errorf("got the assets for resale %+v, want %s", forResale, key)
+	}
+}
+
+func TestReturnAfterRepossession(t *testing.T) {
+	s := newScenario(t, "2025-01-15T09:00:00Z")
+	key := s.createAsset(seb, "S1", "Golf", "SEB", "")
+	s.ok(nil, seb, contracts.LYL, "noticeDefault", key, "Payments missed")
+	s.ok(nil, seb, contracts.LYL, "startGracePeriod", key, "0")
+	s.ok(nil, seb, contracts.LYL, "orderRepossession", key, "Not paid")
+	s.ok(nil, seb, contracts.LYL, "recordRepossession", key, "Picked up")
+	s.ok(nil, seb, contracts.LYL, "returnAsset", key, "Arrears settled")
+
+	if asset := s.asset(key); asset.Status != lyl.RETURNED || asset.GraceEnds != "" {
+		t.Errorf("got the status %s with the grace period until %s, want returned", asset.Status, asset.GraceEnds)
+	}
+	s.ok(nil, seb, contracts.LYL, "noticeDefault", key, "Payments missed again")
+}
+
+func TestResaleOfARemarketedAsset(t *testing.T) {
+	s := newScenario(t, "2025-01-15T09:00:00Z")
+	seller := devledger.Identity{MspId: "SEBMSP", User: "alice", Attrs: map[string]string{"registryCode": "10004252"}}
+	remarketed := s.createAsset(seb, "S1", "Golf", "SEB", "")
+	running := s.createAsset(seb, "S2", "Golf", "SEB", "")
+	for _, function := range []string{"noticeDefault", "startGracePeriod", "orderRepossession", "recordRepossession", "remarketAsset"} {
+		arg := "note"
+		if function == "startGracePeriod" {
+			arg = "0"
+		}
+		s.ok(nil, seb, contracts.LYL, function, remarketed, arg)
+	}
+
+	application := func(assetKey string) string {
+		return `{"sellers":[{"type":"legal","name":"SEB Liising","registryCode":"10004252"}],` +
+			`"buyer":{"personalCode":"38001010001"},"price":"9000.00","leaseAssetKey":"` + assetKey + `"}`
+	}
+	s.ok(nil, seller, contracts.SALE_APPLICATION, "makeApplication", application(remarketed))
+	s.fails(409, seller, contracts.SALE_APPLICATION, "makeApplication", application(running))
+	s.fails(404, seller, contracts.SALE_APPLICATION, "makeApplication", application("ASTMISSING"))
+}
@@ -22,7 +22,7 @@
  * Writing Your First Blockchain Application
  */
 
-package main
+package lyl
 
 /* Imports
  * 4 utility libraries for formatting, handling bytes, reading and writing JSON, and string manipulation
@@ -33,8 +33,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/littlemyy/hlexample/ccutil"
+	"github.com/littlemyy/hlexample/fixtures"
 	sc "github.com/hyperledger/fabric/protos/peer"
 )
 
@@ -42,14 +45,87 @@ import (
 type SmartContract struct {
 }
 
-// Define the lease asset structure, with 4 properties.  Structure tags are used by encoding/json library
+// Define the lease asset structure.  Structure tags are used by encoding/json library
 type LeaseAsset struct {
 	Serial   string `json:"serial"`
 	Make  string `json:"make"`
 	Model string `json:"model"`
 	Leaser  string `json:"leaser"`
+	Vin string `json:"vin,omitempty"`
+	Owner string `json:"owner,omitempty"` //set when the lessee has bought the asset out
+	Status string `json:"status,omitempty"`
+	GraceEnds string `json:"graceEnds,omitempty"`
+	DefaultSteps []DefaultStep `json:"defaultSteps,omitempty"`
+	Contract *LeaseContract `json:"contract,omitempty"`
+	LeaserHistory []LeaserChange `json:"leaserHistory,omitempty"`
+	// Set by putAsset on every write, never taken from the caller
+	CreatedBy string `json:"createdBy,omitempty" metadata:"readOnly"`
+	CreatedAt string `json:"createdAt,omitempty" metadata:"readOnly"`
+	UpdatedBy string `json:"updatedBy,omitempty" metadata:"readOnly"`
+	UpdatedAt string `json:"updatedAt,omitempty" metadata:"readOnly"`
 }
 
+// An asset with its key, as createAsset and the queries return it
+type KeyedAsset struct {
+	Key    string          `json:"Key"`
+	Record json.RawMessage `json:"Record"`
+}
+
+// One change of the asset's leaser
+type LeaserChange struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Date       string `json:"date"`
+	TxId       string `json:"txId"`
+	TransferId string `json:"transferId,omitempty"` //portfolio transfer that moved the asset
+}
+
+// Vehicle as kept by the vehicle register
+type RegisteredVehicle struct {
+	Vin        string `json:"vin"`
+	Stolen     bool   `json:"stolen"`
+	Inspection *struct {
+		NextDueDate string `json:"nextDueDate"`
+	} `json:"inspection,omitempty"`
+	Deregistration *struct {
+		Type string `json:"type"`
+	} `json:"deregistration,omitempty"`
+}
+
+// One recorded step of the default and repossession workflow
+type DefaultStep struct {
+	Status string `json:"status"`
+	Date   string `json:"date"`
+	TxId   string `json:"txId"`
+	Note   string `json:"note,omitempty"`
+}
+
+// Lease asset statuses. An asset without a status is active.
+const ACTIVE string = "active"
+const DEFAULT_NOTICE string = "default_notice"
+const GRACE_PERIOD string = "grace_period"
+const REPOSSESSION_ORDERED string = "repossession_ordered"
+const REPOSSESSED string = "repossessed"
+const REMARKETED string = "remarketed"
+const RETURNED string = "returned"
+const BOUGHT_OUT string = "bought_out"
+
+// Vehicles are kept by the "vehicle_register" chaincode on the same channel
+const VEHICLE_REGISTER_CHAINCODE string = "vehicle_register"
+
+// Allowed default workflow transitions: new status -> statuses it may follow
+var defaultTransitions = map[string][]string{
+	DEFAULT_NOTICE:       {ACTIVE, RETURNED},
+	GRACE_PERIOD:         {DEFAULT_NOTICE},
+	REPOSSESSION_ORDERED: {GRACE_PERIOD},
+	REPOSSESSED:          {REPOSSESSION_ORDERED},
+	REMARKETED:           {REPOSSESSED},
+	RETURNED:             {REPOSSESSED},
+}
+
+// Statuses of assets whose lease has ended for good
+var terminalStatuses = []string{REMARKETED, BOUGHT_OUT}
+
 /*
  * The Init method is called when the Smart Contract "lyl" is instantiated by the blockchain network
  * Best practice is to have any Ledger initialization in separate function -- see initLedger()
@@ -63,36 +139,183 @@ func (s *SmartContract) Init(APIstub shim.ChaincodeStubInterface) sc.Response {
  * The calling application program has also specified the particular smart contract function to be called, with arguments
  */
 func (s *SmartContract) Invoke(APIstub shim.ChaincodeStubInterface) sc.Response {
+	return s.routes().Invoke(APIstub)
+}
 
-	// Retrieve the requested Smart Contract function and arguments
-	function, args := APIstub.GetFunctionAndParameters()
-	// Route to the appropriate handler function to interact with the ledger appropriately
-	if function == "queryAsset" {
-		return s.queryAsset(APIstub, args)
-	} else if function == "initLedger" {
-		return s.initLedger(APIstub)
-	} else if function == "createAsset" {
-		return s.createAsset(APIstub, args)
-	} else if function == "queryAllAssets" {
-		return s.queryAllAssets(APIstub)
-	} else if function == "changeLeaser" {
-		return s.changeLeaser(APIstub, args)
-	}
+// Name and version published by getMetadata
+const CONTRACT_NAME string = "lyl"
+const CONTRACT_VERSION string = "1.0"
 
-	return shim.Error("Invalid Smart Contract function name.")
+// Generated asset keys start with the prefix, see ccutil.NewID
+const ASSET_ID_PREFIX string = "AST"
+
+// Stored records with their current schema versions, simple keys under ""
+var schemas = ccutil.Schemas{
+	"":                  {MovedTo: "asset"},
+	"asset":             {DocType: "leaseAsset", Version: 1, Type: LeaseAsset{}},
+	"quote":             {DocType: "buyoutQuote", Version: 1, Type: BuyoutQuote{}},
+	"portfolioTransfer": {DocType: "portfolioTransfer", Version: 1, Type: PortfolioTransfer{}},
+}
+
+/*
+ * The contract's functions with their arguments. Invoke routes every call through this table.
+ */
+func (s *SmartContract) routes() *ccutil.Router {
+	return ccutil.NewRouter().
+		WithMetadata(CONTRACT_NAME, CONTRACT_VERSION).
+		WithSnapshots(CONTRACT_NAME, CONTRACT_VERSION, schemas).
+		WithSchemas(schemas).
+		Add(ccutil.Route{Function: "queryAsset", Handler: s.queryAsset,
+			Description: "Returns the lease asset",
+			Returns: LeaseAsset{},
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+			}}).
+		Add(ccutil.Route{Function: "initLedger", Handler: s.initLedger,
+			Description: "Writes the sample lease assets under generated keys",
+			Returns: []KeyedAsset{}}).
+		Add(ccutil.Route{Function: "generateTestData", Handler: s.generateTestData,
+			Description: "Writes generated lease assets of the generated vehicles, the same seed and count give matching data in every contract",
+			DevOnly: true,
+			Args: []ccutil.Arg{
+				{Name: "seed", Type: ccutil.STRING_ARG, Description: "Seed of the generator, an integer"},
+				{Name: "count", Type: ccutil.STRING_ARG, Optional: true, Description: "Number of lease assets, 1 to 500, 10 by default"},
+			}}).
+		Add(ccutil.Route{Function: "createAsset", Handler: s.createAsset,
+			Description: "Creates a lease asset under a generated key, checking the vehicle in the register when a VIN is given",
+			Returns: KeyedAsset{},
+			Args: []ccutil.Arg{
+				{Name: "serial", Type: ccutil.STRING_ARG, Description: "Serial number"},
+				{Name: "make", Type: ccutil.STRING_ARG, Description: "Make"},
+				{Name: "model", Type: ccutil.STRING_ARG, Description: "Model"},
+				{Name: "leaser", Type: ccutil.STRING_ARG, Description: "Leasing company owning the asset"},
+				{Name: "vin", Type: ccutil.STRING_ARG, Optional: true, Description: "Vehicle's VIN, may be empty"},
+				{Name: "idempotencyKey", Type: ccutil.STRING_ARG, Optional: true, Description: "Caller's key of the request, a resubmitted call with the same key returns the asset the first call created"},
+			}}).
+		Add(ccutil.Route{Function: "bulkCreateAssets", Handler: s.bulkCreateAssets,
+			Description: fmt.Sprintf("Creates up to %d lease assets under generated keys, all of them or none; the error of an invalid payload lists every invalid row", MAX_BULK_ASSETS),
+			Returns: BulkResult{},
+			Args: []ccutil.Arg{
+				{Name: "format", Type: ccutil.STRING_ARG, Description: "csv or ndjson"},
+				{Name: "assets", Type: ccutil.STRING_ARG, Description: "CSV with a header row or one JSON object per line, with serial, make, model, leaser and optionally vin and idempotencyKey"},
+			}}).
+		Add(ccutil.Route{Function: "queryAllAssets", Handler: s.queryAllAssets,
+			Description: "Returns all lease assets"}).
+		Add(ccutil.Route{Function: "changeLeaser", Handler: s.changeLeaser,
+			Description: "Moves the asset to another leaser",
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+				{Name: "leaser", Type: ccutil.STRING_ARG, Description: "New leaser"},
+			}}).
+		Add(ccutil.Route{Function: "noticeDefault", Handler: s.noticeDefault,
+			Description: "Gives the lessee notice of default",
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+				{Name: "note", Type: ccutil.STRING_ARG, Description: "Note recorded with the step"},
+			}}).
+		Add(ccutil.Route{Function: "startGracePeriod", Handler: s.startGracePeriod,
+			Description: "Starts the grace period after a notice of default",
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+				{Name: "days", Type: ccutil.STRING_ARG, Description: "Grace period length in days"},
+			}}).
+		Add(ccutil.Route{Function: "orderRepossession", Handler: s.orderRepossession,
+			Description: "Orders repossession once the grace period is over",
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+				{Name: "note", Type: ccutil.STRING_ARG, Description: "Note recorded with the step"},
+			}}).
+		Add(ccutil.Route{Function: "recordRepossession", Handler: s.recordRepossession,
+			Description: "Records that the asset was repossessed",
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+				{Name: "note", Type: ccutil.STRING_ARG, Description: "Note recorded with the step"},
+			}}).
+		Add(ccutil.Route{Function: "remarketAsset", Handler: s.remarketAsset,
+			Description: "Lists a repossessed asset for resale",
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+				{Name: "note", Type: ccutil.STRING_ARG, Description: "Note recorded with the step"},
+			}}).
+		Add(ccutil.Route{Function: "returnAsset", Handler: s.returnAsset,
+			Description: "Returns the asset to the active lease",
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+				{Name: "note", Type: ccutil.STRING_ARG, Description: "Note recorded with the step"},
+			}}).
+		Add(ccutil.Route{Function: "queryAssetsForResale", Handler: s.queryAssetsForResale,
+			Description: "Returns the assets listed for resale"}).
+		Add(ccutil.Route{Function: "setLeaseContract", Handler: s.setLeaseContract,
+			Description: "Sets the lease contract terms of the asset",
+			Returns: LeaseAsset{},
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+				{Name: "contract", Type: ccutil.JSON_ARG, Description: "Lease contract", Schema: LeaseContract{}},
+			}}).
+		Add(ccutil.Route{Function: "quoteBuyout", Handler: s.quoteBuyout,
+			Description: "Quotes the early buyout amount of the lease",
+			Returns: BuyoutQuote{},
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+				{Name: "days", Type: ccutil.STRING_ARG, Description: "Number of days the quote stays valid"},
+			}}).
+		Add(ccutil.Route{Function: "queryBuyoutQuote", Handler: s.queryBuyoutQuote,
+			Description: "Returns a buyout quote",
+			Returns: BuyoutQuote{},
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+				{Name: "quoteId", Type: ccutil.STRING_ARG, Description: "Quote id"},
+			}}).
+		Add(ccutil.Route{Function: "executeBuyout", Handler: s.executeBuyout,
+			Description: "Executes a valid buyout quote, ending the lease",
+			Returns: BuyoutQuote{},
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+				{Name: "quoteId", Type: ccutil.STRING_ARG, Description: "Quote id"},
+			}}).
+		Add(ccutil.Route{Function: "proposeLeaseAssumption", Handler: s.proposeLeaseAssumption,
+			Description: "Proposes a new lessee to take over the lease",
+			Returns: LeaseAsset{},
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+				{Name: "personalCode", Type: ccutil.STRING_ARG, Description: "Personal code of the new lessee"},
+			}}).
+		Add(ccutil.Route{Function: "approveLeaseAssumption", Handler: s.approveLeaseAssumption,
+			Description: "Approves the pending lease assumption",
+			Returns: LeaseAsset{},
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+			}}).
+		Add(ccutil.Route{Function: "rejectLeaseAssumption", Handler: s.rejectLeaseAssumption,
+			Description: "Rejects the pending lease assumption",
+			Returns: LeaseAsset{},
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+			}}).
+		Add(ccutil.Route{Function: "transferPortfolio", Handler: s.transferPortfolio,
+			Description: "Moves a set of assets to another leaser in one transaction",
+			Returns: PortfolioTransfer{},
+			Args: []ccutil.Arg{
+				{Name: "transfer", Type: ccutil.JSON_ARG, Description: "Transfer with from, to and either assetKeys or selector", Schema: PortfolioTransfer{}},
+			}}).
+		Add(ccutil.Route{Function: "queryPortfolioTransfer", Handler: s.queryPortfolioTransfer,
+			Description: "Returns a portfolio transfer",
+			Returns: PortfolioTransfer{},
+			Args: []ccutil.Arg{
+				{Name: "transferId", Type: ccutil.STRING_ARG, Description: "Transfer id"},
+			}})
 }
 
 func (s *SmartContract) queryAsset(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	assetAsBytes, err := schemas.Get(APIstub, "asset", args[0])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
 	}
-
-	assetAsBytes, _ := APIstub.GetState(args[0])
 	return shim.Success(assetAsBytes)
 }
 
-func (s *SmartContract) initLedger(APIstub shim.ChaincodeStubInterface) sc.Response {
+func (s *SmartContract) initLedger(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 	assets := []LeaseAsset{
 		LeaseAsset{Serial:"2KJvxs2J", Make: "Toyota", Model: "Prius", Leaser: "SEB"},
 		LeaseAsset{Serial:"YmkeuMPk", Make: "Ford", Model: "Mustang", Leaser: "Luminor"},
@@ -106,43 +329,132 @@ func (s *SmartContract) initLedger(APIstub shim.ChaincodeStubInterface) sc.Respo
 		LeaseAsset{Serial:"br9EeEhp", Make: "Holden", Model: "Barina", Leaser: "Swedbank"},
 	}
 
+	created := []KeyedAsset{}
 	i := 0
 	for i < len(assets) {
 		fmt.Println("i is ", i)
-		assetAsBytes, _ := json.Marshal(assets[i])
-		APIstub.PutState("ASSET"+strconv.Itoa(i), assetAsBytes)
+		key := ccutil.NewID(APIstub, ASSET_ID_PREFIX, i)
+		assetAsBytes, err := putAsset(APIstub, key, assets[i])
+		if err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+		created = append(created, KeyedAsset{Key: key, Record: assetAsBytes})
 		fmt.Println("Added", assets[i])
 		i = i + 1
 	}
 
+	createdAsBytes, err := json.Marshal(created)
+	if err != nil {
+		return ccutil.Internal(fmt.Sprintf("Marshal failed for assets: %s", err)).Response()
+	}
+	return shim.Success(createdAsBytes)
+}
+
+// Writes generated lease assets from ASSET10 on, see package fixtures. args: seed, optionally count
+func (s *SmartContract) generateTestData(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	generated, err := fixtures.FromArgs(args)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	for _, generatedAsset := range generated.Assets {
+		asset := LeaseAsset{Serial: generatedAsset.Serial, Make: generatedAsset.Make, Model: generatedAsset.Model, Leaser: generatedAsset.Leaser, Vin: generatedAsset.Vin}
+		if _, err := putAsset(APIstub, generatedAsset.Key, asset); err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+	}
+
 	return shim.Success(nil)
 }
 
+/*
+ * Creates the asset under a key generated from the transaction id and returns it with its key.
+ * With an idempotency key the asset's key is derived from it, and a resubmitted call returns
+ * the asset the first call created without writing anything.
+ * args: serial, make, model, leaser, optionally the vehicle's VIN and an idempotency key
+ */
 func (s *SmartContract) createAsset(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 4 {
-		return shim.Error("Incorrect number of arguments. Expecting 5")
+	key := ccutil.NewID(APIstub, ASSET_ID_PREFIX, 0)
+	if len(args) > 5 && args[5] != "" {
+		var err error
+		if key, err = ccutil.IdempotentID(APIstub, ASSET_ID_PREFIX, args[5]); err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+	}
+	existing, err := schemas.Get(APIstub, "asset", key)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if existing != nil {
+		return keyedAssetResponse(key, existing)
+	}
+
+	var asset = LeaseAsset{Serial: args[0], Make: args[1], Model: args[2], Leaser: args[3]}
+	if len(args) > 4 && args[4] != "" {
+		asset.Vin = args[4]
+		if err = checkLeasable(APIstub, asset.Vin); err != nil {
+			return ccutil.ErrorResponse(err)
+		}
 	}
 
-	var asset = LeaseAsset{Serial: args[1], Make: args[2], Model: args[3], Leaser: args[4]}
+	assetAsBytes, err := putAsset(APIstub, key, asset)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
 
-	assetAsBytes, _ := json.Marshal(asset)
-	APIstub.PutState(args[0], assetAsBytes)
+	return keyedAssetResponse(key, assetAsBytes)
+}
 
-	return shim.Success(nil)
+func keyedAssetResponse(key string, assetAsBytes []byte) sc.Response {
+	keyedAsBytes, err := json.Marshal(KeyedAsset{Key: key, Record: assetAsBytes})
+	if err != nil {
+		return ccutil.Internal(fmt.Sprintf("Marshal failed for asset: %s", err)).Response()
+	}
+	return shim.Success(keyedAsBytes)
 }
 
-func (s *SmartContract) queryAllAssets(APIstub shim.ChaincodeStubInterface) sc.Response {
+func (s *SmartContract) queryAllAssets(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	startKey := "ASSET0"
-	endKey := "ASSET999"
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey("asset", []string{})
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	defer resultsIterator.Close()
 
-	resultsIterator, err := APIstub.GetStateByRange(startKey, endKey)
+	buffer, err := constructQueryResponseFromIterator(APIstub, resultsIterator, nil)
 	if err != nil {
-		return shim.Error(err.Error())
+		return ccutil.ErrorResponse(err)
+	}
+
+	fmt.Printf("- queryAllAssets:\n%s\n", buffer.String())
+
+	return shim.Success(buffer.Bytes())
+}
+
+// Lists the repossessed assets the leasers have put up for resale through the sale application flow
+func (s *SmartContract) queryAssetsForResale(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey("asset", []string{})
+	if err != nil {
+		return ccutil.ErrorResponse(err)
 	}
 	defer resultsIterator.Close()
 
+	buffer, err := constructQueryResponseFromIterator(APIstub, resultsIterator, func(asset LeaseAsset) bool {
+		return asset.Status == REMARKETED
+	})
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	fmt.Printf("- queryAssetsForResale:\n%s\n", buffer.String())
+
+	return shim.Success(buffer.Bytes())
+}
+
+// Builds a JSON array of {Key, Record} pairs from the iterator over assets, keeping the assets accepted by the filter
+func constructQueryResponseFromIterator(APIstub shim.ChaincodeStubInterface, resultsIterator shim.StateQueryIteratorInterface, filter func(LeaseAsset) bool) (*bytes.Buffer, error) {
 	// buffer is a JSON array containing QueryResults
 	var buffer bytes.Buffer
 	buffer.WriteString("[")
@@ -151,7 +463,17 @@ func (s *SmartContract) queryAllAssets(APIstub shim.ChaincodeStubInterface) sc.R
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
-			return shim.Error(err.Error())
+			return nil, err
+		}
+		_, attributes, err := APIstub.SplitCompositeKey(queryResponse.Key)
+		if err != nil || len(attributes) != 1 {
+			return nil, ccutil.Internal("Invalid asset key " + queryResponse.Key)
+		}
+		if filter != nil {
+			asset := LeaseAsset{}
+			if json.Unmarshal(queryResponse.Value, &asset) != nil || !filter(asset) {
+				continue
+			}
 		}
 		// Add a comma before array members, suppress it for the first array member
 		if bArrayMemberAlreadyWritten == true {
@@ -159,7 +481,7 @@ func (s *SmartContract) queryAllAssets(APIstub shim.ChaincodeStubInterface) sc.R
 		}
 		buffer.WriteString("{\"Key\":")
 		buffer.WriteString("\"")
-		buffer.WriteString(queryResponse.Key)
+		buffer.WriteString(attributes[0])
 		buffer.WriteString("\"")
 
 		buffer.WriteString(", \"Record\":")
@@ -170,35 +492,227 @@ func (s *SmartContract) queryAllAssets(APIstub shim.ChaincodeStubInterface) sc.R
 	}
 	buffer.WriteString("]")
 
-	fmt.Printf("- queryAllAssets:\n%s\n", buffer.String())
-
-	return shim.Success(buffer.Bytes())
+	return &buffer, nil
 }
 
+// Called by the current leaser. args: assetKey, new leaser
 func (s *SmartContract) changeLeaser(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
+	asset, err := getAsset(APIstub, args[0])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if err = assertLeaser(APIstub, asset); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if asset.Vin != "" {
+		if _, err := checkVehicle(APIstub, asset.Vin); err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+	}
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	moveAsset(APIstub, &asset, args[1], txTime, "")
+
+	if _, err = putAsset(APIstub, args[0], asset); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(nil)
+}
+
+// Changes the asset's leaser and records the change in the asset's history
+func moveAsset(APIstub shim.ChaincodeStubInterface, asset *LeaseAsset, leaser string, txTime time.Time, transferId string) {
+	asset.LeaserHistory = append(asset.LeaserHistory, LeaserChange{From: asset.Leaser, To: leaser, Date: txTime.Format(time.RFC3339), TxId: APIstub.GetTxID(), TransferId: transferId})
+	asset.Leaser = leaser
+}
+
+/*
+ * Default and repossession workflow. A defaulted lease goes through
+ * default notice -> grace period -> repossession ordered -> repossessed -> remarketed or returned.
+ * Every step is recorded on the asset and may only be taken by the leaser owning the asset.
+ */
+
+// args: assetKey, note
+func (s *SmartContract) noticeDefault(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	return s.changeDefaultStatus(APIstub, args[0], DEFAULT_NOTICE, args[1], nil)
+}
+
+// args: assetKey, grace period length in days
+func (s *SmartContract) startGracePeriod(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	days, err := strconv.Atoi(args[1])
+	if err != nil || days < 0 {
+		return ccutil.InvalidInput("days", "Grace period must be a non-negative number of days").Response()
+	}
+	return s.changeDefaultStatus(APIstub, args[0], GRACE_PERIOD, "", func(asset *LeaseAsset, txTime time.Time) error {
+		asset.GraceEnds = txTime.AddDate(0, 0, days).Format(time.RFC3339)
+		return nil
+	})
+}
+
+// args: assetKey, note
+func (s *SmartContract) orderRepossession(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	return s.changeDefaultStatus(APIstub, args[0], REPOSSESSION_ORDERED, args[1], func(asset *LeaseAsset, txTime time.Time) error {
+		graceEnds, err := time.Parse(time.RFC3339, asset.GraceEnds)
+		if err != nil {
+			return ccutil.Conflict(fmt.Sprintf("Asset has no valid grace period end date: %s", asset.GraceEnds))
+		}
+		if txTime.Before(graceEnds) {
+			return ccutil.Conflict(fmt.Sprintf("Grace period lasts until %s", asset.GraceEnds))
+		}
+		return nil
+	})
+}
+
+// args: assetKey, note
+func (s *SmartContract) recordRepossession(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	return s.changeDefaultStatus(APIstub, args[0], REPOSSESSED, args[1], nil)
+}
+
+// args: assetKey, note
+func (s *SmartContract) remarketAsset(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	return s.changeDefaultStatus(APIstub, args[0], REMARKETED, args[1], nil)
+}
+
+// args: assetKey, note
+func (s *SmartContract) returnAsset(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	return s.changeDefaultStatus(APIstub, args[0], RETURNED, args[1], func(asset *LeaseAsset, txTime time.Time) error {
+		asset.GraceEnds = ""
+		return nil
+	})
+}
+
+// Moves the asset to the given workflow status, checking the transition and the caller, and records the step
+func (s *SmartContract) changeDefaultStatus(APIstub shim.ChaincodeStubInterface, key string, status string, note string, update func(*LeaseAsset, time.Time) error) sc.Response {
+	fmt.Println("running changeDefaultStatus: " + status)
+
+	asset, err := getAsset(APIstub, key)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	if err = assertLeaser(APIstub, asset); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	current := asset.Status
+	if current == "" {
+		current = ACTIVE
+	}
+	allowed := false
+	for _, from := range defaultTransitions[status] {
+		if from == current {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return ccutil.Conflict("Asset in status " + current + " can't be moved to " + status).Response()
+	}
+
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if update != nil {
+		if err = update(&asset, txTime); err != nil {
+			return ccutil.ErrorResponse(err)
+		}
 	}
 
-	assetAsBytes, _ := APIstub.GetState(args[0])
+	asset.Status = status
+	asset.DefaultSteps = append(asset.DefaultSteps, DefaultStep{Status: status, Date: txTime.Format(time.RFC3339), TxId: APIstub.GetTxID(), Note: note})
+
+	assetAsBytes, err := putAsset(APIstub, key, asset)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(assetAsBytes)
+}
+
+// Reads the asset stored under key
+func getAsset(APIstub shim.ChaincodeStubInterface, key string) (LeaseAsset, error) {
 	asset := LeaseAsset{}
+	err := schemas.Load(APIstub, "asset", &asset, key)
+	return asset, err
+}
 
-	json.Unmarshal(assetAsBytes, &asset)
-	asset.Leaser = args[1]
+// Writes the asset under key, stamping who changed it and when, and returns the stored JSON.
+// An asset without createdBy is stamped as created by this transaction.
+func putAsset(APIstub shim.ChaincodeStubInterface, key string, asset LeaseAsset) ([]byte, error) {
+	creator, err := ccutil.CreatorIdentity(APIstub)
+	if err != nil {
+		return nil, err
+	}
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return nil, err
+	}
+	asset.UpdatedBy = creator
+	asset.UpdatedAt = txTime.Format(time.RFC3339)
+	if asset.CreatedBy == "" {
+		asset.CreatedBy = asset.UpdatedBy
+		asset.CreatedAt = asset.UpdatedAt
+	}
 
-	assetAsBytes, _ = json.Marshal(asset)
-	APIstub.PutState(args[0], assetAsBytes)
+	return schemas.Save(APIstub, "asset", asset, key)
+}
 
-	return shim.Success(nil)
+// Checks that the caller belongs to the organisation leasing the asset.
+// Organisation MSP IDs are the leaser name, optionally followed by "MSP" (e.g. SEB or SEBMSP).
+func assertLeaser(APIstub shim.ChaincodeStubInterface, asset LeaseAsset) error {
+	organisation, err := ccutil.CallerOrganisation(APIstub)
+	if err != nil {
+		return err
+	}
+	if organisation != asset.Leaser {
+		return ccutil.Forbidden(fmt.Sprintf("Only the leaser %s may change this asset", asset.Leaser))
+	}
+	return nil
+}
+
+// Checks with the vehicle register that the vehicle may be leased or change hands.
+// Returns the registered vehicle, or nil when the VIN isn't in the register.
+func checkVehicle(APIstub shim.ChaincodeStubInterface, vin string) (*RegisteredVehicle, error) {
+	response := APIstub.InvokeChaincode(VEHICLE_REGISTER_CHAINCODE, [][]byte{[]byte("queryVehicle"), []byte(vin)}, "")
+	if response.Status != shim.OK {
+		return nil, ccutil.DependencyFailed("Unable to check the vehicle "+vin, response)
+	}
+	if len(response.Payload) == 0 {
+		return nil, nil
+	}
+	vehicle := RegisteredVehicle{}
+	if err := json.Unmarshal(response.Payload, &vehicle); err != nil {
+		return nil, ccutil.Internal("Unable to unmarshal vehicle data received from the ledger")
+	}
+	if vehicle.Stolen {
+		return nil, ccutil.Conflict(fmt.Sprintf("Vehicle %s is reported stolen", vin))
+	}
+	return &vehicle, nil
 }
 
-// The main function is only relevant in unit test mode. Only included here for completeness.
-func main() {
+// Checks that a new lease asset may be made of the vehicle: it isn't deregistered and its inspection hasn't lapsed
+func checkLeasable(APIstub shim.ChaincodeStubInterface, vin string) error {
+	vehicle, err := checkVehicle(APIstub, vin)
+	if err != nil {
+		return err
+	}
+	if vehicle != nil && vehicle.Deregistration != nil {
+		return ccutil.Conflict("Vehicle " + vin + " is deregistered (" + vehicle.Deregistration.Type + ")")
+	}
+	return checkInspection(APIstub, vehicle)
+}
 
-	// Create a new Smart Contract
-	err := shim.Start(new(SmartContract))
+// Checks that the vehicle's technical inspection hasn't lapsed as of the transaction date
+func checkInspection(APIstub shim.ChaincodeStubInterface, vehicle *RegisteredVehicle) error {
+	if vehicle == nil || vehicle.Inspection == nil {
+		return nil
+	}
+	txTime, err := ccutil.TxTime(APIstub)
 	if err != nil {
-		fmt.Printf("Error creating new Smart Contract: %s", err)
+		return err
 	}
+	return ccutil.CheckInspectionDue(vehicle.Vin, vehicle.Inspection.NextDueDate, txTime)
 }
@@ -0,0 +1,206 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Portfolio transfer for the "lyl" Smart Contract: moves many lease assets
+ * from one leaser to another in a single transaction
+ */
+
+package lyl
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/littlemyy/hlexample/ccutil"
+)
+
+// Define the portfolio transfer structure. Either AssetKeys or Selector picks the assets to move.
+type PortfolioTransfer struct {
+	TransferId string             `json:"transferId" metadata:"readOnly"`
+	From       string             `json:"from"`
+	To         string             `json:"to"`
+	Date       string             `json:"date" metadata:"readOnly"`
+	AssetKeys  []string           `json:"assetKeys,omitempty"`
+	Selector   *PortfolioSelector `json:"selector,omitempty"`
+}
+
+// Selects the source leaser's assets by their properties, empty fields match everything.
+// Without a status, assets whose lease has ended (see terminalStatuses) aren't selected.
+type PortfolioSelector struct {
+	Make   string `json:"make,omitempty"`
+	Model  string `json:"model,omitempty"`
+	Status string `json:"status,omitempty"`
+}
+
+/*
+ * Called by the source leaser. args: transfer JSON, e.g.
+ * {"from":"Swedbank","to":"SEB","assetKeys":["AST5VQ2MRDK7HXW3BNA","ASTJ4ZC6PLQ2N7YTE5K"]} or
+ * {"from":"Swedbank","to":"SEB","selector":{"make":"Fiat"}}
+ * Every asset must belong to the source leaser and none of their vehicles may be reported stolen,
+ * otherwise nothing is moved.
+ */
+func (s *SmartContract) transferPortfolio(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	transfer := PortfolioTransfer{}
+	if err := json.Unmarshal([]byte(args[0]), &transfer); err != nil {
+		return ccutil.InvalidInput("", "Unable to unmarshal input JSON data: "+fmt.Sprint(err)).Response()
+	}
+	transfer.From = strings.TrimSpace(transfer.From)
+	transfer.To = strings.TrimSpace(transfer.To)
+	if transfer.From == "" || transfer.To == "" {
+		return ccutil.InvalidInput("", "Source and target leasers are mandatory").Response()
+	}
+	if transfer.From == transfer.To {
+		return ccutil.InvalidInput("", "Source and target leasers are the same").Response()
+	}
+	if (len(transfer.AssetKeys) == 0) == (transfer.Selector == nil) {
+		return ccutil.InvalidInput("assetKeys", "Either assetKeys or selector must be given").Response()
+	}
+	if err := assertLeaser(APIstub, LeaseAsset{Leaser: transfer.From}); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	assets := map[string]LeaseAsset{}
+	if transfer.Selector != nil {
+		selected, err := selectPortfolio(APIstub, transfer.From, *transfer.Selector)
+		if err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+		assets = selected
+	} else {
+		for _, key := range transfer.AssetKeys {
+			if _, seen := assets[key]; seen {
+				return ccutil.InvalidInput("assetKeys", "Asset "+key+" is listed twice").Response()
+			}
+			asset, err := getAsset(APIstub, key)
+			if err != nil {
+				return ccutil.ErrorResponse(err)
+			}
+			if asset.Leaser != transfer.From {
+				return ccutil.InvalidInput("assetKeys", "Asset "+key+" does not belong to "+transfer.From).Response()
+			}
+			assets[key] = asset
+		}
+	}
+	if len(assets) == 0 {
+		return ccutil.InvalidInput("selector", "No assets selected for the transfer").Response()
+	}
+
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	transfer.TransferId = APIstub.GetTxID()
+	transfer.Date = txTime.Format(time.RFC3339)
+	transfer.AssetKeys = make([]string, 0, len(assets))
+	for key := range assets {
+		transfer.AssetKeys = append(transfer.AssetKeys, key)
+	}
+	// map order is random, keep the writes identical on every endorsing peer
+	sort.Strings(transfer.AssetKeys)
+
+	for _, key := range transfer.AssetKeys {
+		if vin := assets[key].Vin; vin != "" {
+			if _, err = checkVehicle(APIstub, vin); err != nil {
+				return ccutil.ErrorResponse(err)
+			}
+		}
+	}
+
+	for _, key := range transfer.AssetKeys {
+		asset := assets[key]
+		moveAsset(APIstub, &asset, transfer.To, txTime, transfer.TransferId)
+		if _, err = putAsset(APIstub, key, asset); err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+	}
+
+	transferAsBytes, err := schemas.Save(APIstub, "portfolioTransfer", transfer, transfer.TransferId)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(transferAsBytes)
+}
+
+// args: transferId
+func (s *SmartContract) queryPortfolioTransfer(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	transferAsBytes, err := schemas.Get(APIstub, "portfolioTransfer", args[0])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if transferAsBytes == nil {
+		return ccutil.NotFound("Couldn't find the portfolio transfer " + args[0]).Response()
+	}
+
+	return shim.Success(transferAsBytes)
+}
+
+// Finds the leaser's assets matching the selector
+func selectPortfolio(APIstub shim.ChaincodeStubInterface, leaser string, selector PortfolioSelector) (map[string]LeaseAsset, error) {
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey("asset", []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	assets := map[string]LeaseAsset{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		asset := LeaseAsset{}
+		if json.Unmarshal(queryResponse.Value, &asset) != nil || asset.Leaser != leaser {
+			continue
+		}
+		status := asset.Status
+		if status == "" {
+			status = ACTIVE
+		}
+		if (selector.Make != "" && asset.Make != selector.Make) ||
+			(selector.Model != "" && asset.Model != selector.Model) ||
+			(selector.Status != "" && status != selector.Status) ||
+			(selector.Status == "" && isTerminal(status)) {
+			continue
+		}
+		_, attributes, err := APIstub.SplitCompositeKey(queryResponse.Key)
+		if err != nil || len(attributes) != 1 {
+			return nil, ccutil.Internal("Invalid asset key " + queryResponse.Key)
+		}
+		assets[attributes[0]] = asset
+	}
+	return assets, nil
+}
+
+func isTerminal(status string) bool {
+	for _, terminal := range terminalStatuses {
+		if status == terminal {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package lyl_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/littlemyy/hlexample/contracts"
+	"github.com/littlemyy/hlexample/lyl"
+)
+
+func TestPortfolioTransfer(t *testing.T) {
+	s := newScenario(t, "2025-01-15T09:00:00Z")
+	running := []string{s.createAsset(seb, "S1", "Panda", "SEB", ""), s.createAsset(seb, "S2", "Tipo", "SEB", "")}
+	boughtOut := s.createAsset(seb, "S3", "Panda", "SEB", "")
+	s.ok(nil, seb, contracts.LYL, "setLeaseContract", boughtOut, leaseContract)
+	quote := lyl.BuyoutQuote{}
+	s.ok(&quote, seb, contracts.LYL, "quoteBuyout", boughtOut, "10")
+	s.ok(nil, seb, contracts.LYL, "executeBuyout", boughtOut, quote.QuoteId)
+	s.createAsset(luminor, "L1", "Panda", "Luminor", "")
+
+	s.fails(403, luminor, contracts.LYL, "transferPortfolio", `{"from":"SEB","to":"Luminor","selector":{"make":"VW"}}`)
+	s.fails(400, seb, contracts.LYL, "transferPortfolio", `{"from":"SEB","to":"Luminor","selector":{"model":"Golf"}}`)
+
+	transfer := lyl.PortfolioTransfer{}
+	s.ok(&transfer, seb, contracts.LYL, "transferPortfolio", `{"from":"SEB","to":"Luminor","selector":{"make":"VW"}}`)
+	sort.Strings(running)
+	if !reflect.DeepEqual(transfer.AssetKeys, running) {
+		t.Errorf("got the assets %v, want %v without the bought out %s", transfer.AssetKeys, running, boughtOut)
+	}
+	for _, key := range running {
+		asset := s.asset(key)
+		last := asset.LeaserHistory[len(asset.LeaserHistory)-1]
+		if asset.Leaser != "Luminor" || last.From != "SEB" || last.TransferId != transfer.TransferId {
+			t.Errorf("got the asset %+v, want it moved by the transfer %s", asset, transfer.TransferId)
+		}
+	}
+	if asset := s.asset(boughtOut); asset.Leaser != "SEB" {
+		t.Errorf("got the bought out asset moved to %s", asset.Leaser)
+	}
+
+	transfer = lyl.PortfolioTransfer{}
+	s.ok(&transfer, seb, contracts.LYL, "transferPortfolio", `{"from":"SEB","to":"Luminor","selector":{"status":"bought_out"}}`)
+	if len(transfer.AssetKeys) != 1 || transfer.AssetKeys[0] != boughtOut {
+		t.Errorf("got the assets %v, want the bought out %s", transfer.AssetKeys, boughtOut)
+	}
+	stored := lyl.PortfolioTransfer{}
+	s.ok(&stored, seb, contracts.LYL, "queryPortfolioTransfer", transfer.TransferId)
+	if !reflect.DeepEqual(stored, transfer) {
+		t.Errorf("got the stored transfer %+v, want %+v", stored, transfer)
+	}
+}
+
+func TestPortfolioTransferOfAStolenVehicle(t *testing.T) {
+	s := newScenario(t, "2025-01-15T09:00:00Z")
+	s.registerVehicle("WVW0001", "123ABC")
+	clean := s.createAsset(seb, "S1", "Golf", "SEB", "")
+	stolen := s.createAsset(seb, "S2", "Golf", "SEB", "WVW0001")
+	s.ok(nil, registryAdmin, contracts.VEHICLE_REGISTER, "reportStolen", "WVW0001", "Taken from the parking lot")
+
+	s.fails(409, seb, contracts.LYL, "transferPortfolio", `{"from":"SEB","to":"Luminor","assetKeys":["`+clean+`","`+stolen+`"]}`)
+	if asset := s.asset(clean); asset.Leaser != "SEB" {
+		t.Errorf("got the asset moved to %s, want nothing moved", asset.Leaser)
+	}
+	s.fails(400, seb, contracts.LYL, "transferPortfolio", `{"from":"SEB","to":"Luminor","assetKeys":["`+clean+`","`+clean+`"]}`)
+}
+
+func TestChangeLeaser(t *testing.T) {
+	s := newScenario(t, "2025-01-15T09:00:00Z")
+	key := s.createAsset(seb, "S1", "Golf", "SEB", "")
+
+	s.fails(403, luminor, contracts.LYL, "changeLeaser", key, "Luminor")
+	s.ok(nil, seb, contracts.LYL, "changeLeaser", key, "Luminor")
+	if asset := s.asset(key); asset.Leaser != "Luminor" || len(asset.LeaserHistory) != 1 {
+		t.Errorf("got the asset %+v, want it moved to Luminor", asset)
+	}
+}
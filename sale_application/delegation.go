@@ -0,0 +1,262 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Power of attorney: a party (the principal) lets an agent, such as a dealer or
+ * leasing staff, call some of the functions on the principal's behalf
+ */
+
+package sale_application
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/littlemyy/hlexample/ccutil"
+)
+
+// Define the delegation structure. Principal and agent are personal or registry codes.
+type Delegation struct {
+	DelegationId string   `json:"delegationId" metadata:"readOnly"`
+	Principal    string   `json:"principal"`
+	Agent        string   `json:"agent"`
+	Scope        []string `json:"scope"`      //functions the agent may call for the principal
+	ValidFrom    string   `json:"validFrom"`  //YYYY-MM-DD
+	ValidUntil   string   `json:"validUntil"` //YYYY-MM-DD, last valid day
+	RevokedAt    string   `json:"revokedAt,omitempty" metadata:"readOnly"`
+}
+
+// An action an agent took on the application under a delegation
+type DelegatedAction struct {
+	Function     string `json:"function"`
+	Principal    string `json:"principal"`
+	Agent        string `json:"agent"`
+	DelegationId string `json:"delegationId"`
+	Date         string `json:"date"`
+	TxId         string `json:"txId"`
+}
+
+// Functions that can be delegated
+var delegableFunctions = []string{"makeApplication", "approveApplication", "acceptApplication", "rejectApplication", "cancelApplication", "finishApplication"}
+
+/*
+ * function is called by the principal to give an agent power of attorney
+ * args: delegation JSON e.g. {"principal":"49104231234","agent":"10234567","scope":["makeApplication"],"validFrom":"2019-05-01","validUntil":"2019-12-31"}
+ */
+func (t *ApplicationContract) grantDelegation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	fmt.Println("running grantDelegation()")
+	var delegation Delegation
+	err := json.Unmarshal([]byte(args[0]), &delegation)
+	if err != nil {
+		return ccutil.InvalidInput("", "Unable to unmarshal input JSON data: "+fmt.Sprint(err)).Response()
+	}
+	err = validateDelegation(delegation)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	callerIds, err := getCallerPartyIds(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if !callerIds[delegation.Principal] {
+		return ccutil.Forbidden("Only the principal may grant a delegation").Response()
+	}
+
+	delegation.DelegationId = APIstub.GetTxID()
+	delegation.RevokedAt = ""
+	delegationAsBytes, err := putDelegation(APIstub, delegation)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(delegationAsBytes)
+}
+
+// function is called by the principal to revoke a delegation. args: principal, delegationId
+func (t *ApplicationContract) revokeDelegation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	fmt.Println("running revokeDelegation()")
+	callerIds, err := getCallerPartyIds(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if !callerIds[args[0]] {
+		return ccutil.Forbidden("Only the principal may revoke a delegation").Response()
+	}
+
+	var delegation Delegation
+	err = schemas.Load(APIstub, "delegation", &delegation, args[0], args[1])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if delegation.RevokedAt != "" {
+		return ccutil.Conflict("Delegation was already revoked on " + delegation.RevokedAt).Response()
+	}
+
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	delegation.RevokedAt = txTime.Format(time.RFC3339)
+	delegationAsBytes, err := putDelegation(APIstub, delegation)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(delegationAsBytes)
+}
+
+// function returns a JSON array with the principal's delegations. args: principal
+func (t *ApplicationContract) getDelegations(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	fmt.Println("running getDelegations()")
+	delegations, err := readDelegations(APIstub, args[0])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	delegationsAsBytes, err := json.Marshal(delegations)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	return shim.Success(delegationsAsBytes)
+}
+
+/*
+ * Function checks whether the caller may call the function for the party.
+ * Returns nil when the caller is the party itself, or the delegation the caller acts under.
+ */
+func actingFor(APIstub shim.ChaincodeStubInterface, function string, party string, callerIds map[string]bool, txTime time.Time) (*Delegation, error) {
+	if callerIds[party] {
+		return nil, nil
+	}
+	delegations, err := readDelegations(APIstub, party)
+	if err != nil {
+		return nil, err
+	}
+	today := txTime.Format(ccutil.DATE_FORMAT)
+	for _, delegation := range delegations {
+		if !callerIds[delegation.Agent] || delegation.RevokedAt != "" || today < delegation.ValidFrom || today > delegation.ValidUntil {
+			continue
+		}
+		for _, allowed := range delegation.Scope {
+			if allowed == function {
+				return &delegation, nil
+			}
+		}
+	}
+	return nil, ccutil.Forbidden("Caller may not call " + function + " for " + party)
+}
+
+/*
+ * Function checks that the caller is one of the application's parties in the roles, or an agent of one
+ * who may call the function. Returns nil when the caller is a party itself, or the delegation the caller acts under.
+ */
+func actingForParty(APIstub shim.ChaincodeStubInterface, function string, saleApplication SaleApplication, roles []string, txTime time.Time) (*Delegation, error) {
+	callerIds, err := getCallerPartyIds(APIstub)
+	if err != nil {
+		return nil, err
+	}
+	parties := []Party{}
+	for _, role := range roles {
+		parties = append(parties, getParties(saleApplication, role)...)
+	}
+	for _, party := range parties {
+		if callerIds[partyId(party)] {
+			return nil, nil
+		}
+	}
+	for _, party := range parties {
+		if partyId(party) == "" {
+			continue
+		}
+		delegation, err := actingFor(APIstub, function, partyId(party), callerIds, txTime)
+		if err == nil {
+			return delegation, nil
+		}
+		if e, ok := err.(*ccutil.Error); !ok || e.Code != ccutil.FORBIDDEN {
+			return nil, err
+		}
+	}
+	return nil, ccutil.Forbidden("Caller is not a " + strings.Join(roles, " or ") + ", or their agent, of the application")
+}
+
+// Function returns the record of an action taken by the agent under the delegation
+func delegatedAction(APIstub shim.ChaincodeStubInterface, function string, delegation Delegation, txTime time.Time) DelegatedAction {
+	return DelegatedAction{Function: function, Principal: delegation.Principal, Agent: delegation.Agent, DelegationId: delegation.DelegationId, Date: txTime.Format(time.RFC3339), TxId: APIstub.GetTxID()}
+}
+
+func readDelegations(APIstub shim.ChaincodeStubInterface, principal string) ([]Delegation, error) {
+	records, err := schemas.List(APIstub, "delegation", principal)
+	if err != nil {
+		return nil, err
+	}
+
+	delegations := []Delegation{}
+	for _, delegationAsBytes := range records {
+		var delegation Delegation
+		err = json.Unmarshal(delegationAsBytes, &delegation)
+		if err != nil {
+			return nil, ccutil.Internal("Unable to unmarshal delegation data received from the ledger")
+		}
+		delegations = append(delegations, delegation)
+	}
+	return delegations, nil
+}
+
+func putDelegation(APIstub shim.ChaincodeStubInterface, delegation Delegation) ([]byte, error) {
+	return schemas.Save(APIstub, "delegation", delegation, delegation.Principal, delegation.DelegationId)
+}
+
+func validateDelegation(delegation Delegation) error {
+	if strings.TrimSpace(delegation.Principal) == "" || strings.TrimSpace(delegation.Agent) == "" {
+		return ccutil.InvalidInput("", "principal and agent are mandatory")
+	}
+	if delegation.Principal == delegation.Agent {
+		return ccutil.InvalidInput("principal", "principal can't be its own agent")
+	}
+	if len(delegation.Scope) == 0 {
+		return ccutil.InvalidInput("scope", "scope must list at least one function")
+	}
+	for _, function := range delegation.Scope {
+		known := false
+		for _, delegable := range delegableFunctions {
+			if function == delegable {
+				known = true
+			}
+		}
+		if !known {
+			return ccutil.InvalidInput("scope", "scope may only list "+strings.Join(delegableFunctions, ", "))
+		}
+	}
+	validFrom, err := time.Parse(ccutil.DATE_FORMAT, delegation.ValidFrom)
+	if err != nil {
+		return ccutil.InvalidInput("validFrom", "validFrom must be in YYYY-MM-DD format")
+	}
+	validUntil, err := time.Parse(ccutil.DATE_FORMAT, delegation.ValidUntil)
+	if err != nil {
+		return ccutil.InvalidInput("validUntil", "validUntil must be in YYYY-MM-DD format")
+	}
+	if validUntil.Before(validFrom) {
+		return ccutil.InvalidInput("validUntil", "validUntil can't be before validFrom")
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package sale_application_test
+
+import (
+	"testing"
+
+	"github.com/littlemyy/hlexample/sale_application"
+)
+
+const seller = "49104231234"
+const buyer = "47712121234"
+const dealer = "10234567"
+
+const application = `{"seller":{"personalCode":"` + seller + `"},"buyer":{"personalCode":"` + buyer + `"},"price":"9000.00"}`
+
+func TestDelegatedApplication(t *testing.T) {
+	s := newScenario(t, "2025-01-10T09:00:00Z")
+
+	s.fails(403, company(dealer), "makeApplication", application)
+	s.fails(403, company(dealer), "grantDelegation", `{"principal":"`+seller+`","agent":"`+dealer+`","scope":["makeApplication"],"validFrom":"2025-01-01","validUntil":"2025-01-31"}`)
+	delegation := sale_application.Delegation{}
+	s.ok(&delegation, person(seller), "grantDelegation", `{"principal":"`+seller+`","agent":"`+dealer+`","scope":["makeApplication"],"validFrom":"2025-01-01","validUntil":"2025-01-31"}`)
+
+	made := sale_application.SaleApplication{}
+	s.ok(&made, company(dealer), "makeApplication", application)
+	if len(made.DelegatedActions) != 1 {
+		t.Fatalf("got the delegated actions %+v, want the dealer's", made.DelegatedActions)
+	}
+	action := made.DelegatedActions[0]
+	if action.Function != "makeApplication" || action.Principal != seller || action.Agent != dealer || action.DelegationId != delegation.DelegationId {
+		t.Errorf("got the delegated action %+v", action)
+	}
+	s.fails(403, company(dealer), "cancelApplication", `{"applicationId":"`+*made.ApplicationId+`"}`, "cancelled")
+
+	s.at("2025-02-01T09:00:00Z")
+	s.fails(403, company(dealer), "makeApplication", application)
+}
+
+func TestRevokedDelegation(t *testing.T) {
+	s := newScenario(t, "2025-01-10T09:00:00Z")
+	delegation := sale_application.Delegation{}
+	s.ok(&delegation, person(seller), "grantDelegation", `{"principal":"`+seller+`","agent":"`+dealer+`","scope":["makeApplication"],"validFrom":"2025-01-01","validUntil":"2025-12-31"}`)
+
+	s.fails(403, company(dealer), "revokeDelegation", seller, delegation.DelegationId)
+	s.ok(nil, person(seller), "revokeDelegation", seller, delegation.DelegationId)
+	s.fails(409, person(seller), "revokeDelegation", seller, delegation.DelegationId)
+	s.fails(403, company(dealer), "makeApplication", application)
+
+	delegations := []sale_application.Delegation{}
+	s.ok(&delegations, person(buyer), "getDelegations", seller)
+	if len(delegations) != 1 || delegations[0].RevokedAt != "2025-01-10T09:00:00Z" {
+		t.Errorf("got the delegations %+v, want the revoked one", delegations)
+	}
+}
+
+func TestDelegationValidation(t *testing.T) {
+	s := newScenario(t, "2025-01-10T09:00:00Z")
+	for _, delegation := range []string{
+		`{"principal":"` + seller + `","agent":"` + seller + `","scope":["makeApplication"],"validFrom":"2025-01-01","validUntil":"2025-12-31"}`,
+		`{"principal":"` + seller + `","agent":"` + dealer + `","scope":[],"validFrom":"2025-01-01","validUntil":"2025-12-31"}`,
+		`{"principal":"` + seller + `","agent":"` + dealer + `","scope":["grantDelegation"],"validFrom":"2025-01-01","validUntil":"2025-12-31"}`,
+		`{"principal":"` + seller + `","agent":"` + dealer + `","scope":["makeApplication"],"validFrom":"2025-1-1","validUntil":"2025-12-31"}`,
+		`{"principal":"` + seller + `","agent":"` + dealer + `","scope":["makeApplication"],"validFrom":"2025-12-31","validUntil":"2025-01-01"}`,
+	} {
+		s.fails(400, person(seller), "grantDelegation", delegation)
+	}
+}
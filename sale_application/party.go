@@ -0,0 +1,259 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Sellers and buyers of a sale application. Parties are natural persons or legal persons
+ * (companies), and a vehicle may be sold or bought by several co-owners.
+ */
+
+package sale_application
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/littlemyy/hlexample/ccutil"
+)
+
+// Define the party structure: a natural person identified by personal code,
+// or a legal person identified by company registry code
+type Party struct {
+	Type         *string `json:"type,omitempty"`
+	FirstName    *string `json:"firstName,omitempty"`
+	LastName     *string `json:"lastName,omitempty"`
+	PersonalCode *string `json:"personalCode,omitempty"`
+	Name         *string `json:"name,omitempty"`
+	RegistryCode *string `json:"registryCode,omitempty"`
+	VatNumber    *string `json:"vatNumber,omitempty"`
+	Share        *string `json:"share,omitempty"` //ownership share in percent, e.g. "50" or "33.33"
+}
+
+// Approval of the sale by one of its sellers or buyers
+type PartyApproval struct {
+	PartyId string `json:"partyId"`
+	Role    string `json:"role"`
+	Agent   string `json:"agent,omitempty"` //set when an agent approved under a delegation
+	Date    string `json:"date"`
+	TxId    string `json:"txId"`
+}
+
+const NATURAL_PERSON string = "natural"
+const LEGAL_PERSON string = "legal"
+
+const SELLER string = "seller"
+const BUYER string = "buyer"
+
+// Certificate attributes identifying the party calling the chaincode
+const PERSONAL_CODE_ATTRIBUTE string = "personalCode"
+const REGISTRY_CODE_ATTRIBUTE string = "registryCode"
+
+// function is called by a seller or buyer to approve the application
+func (t *ApplicationContract) approveApplication(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	fmt.Println("running approveApplication()")
+
+	saleApplication, err := t.getApplication(APIstub, args)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if saleApplication.Status == nil || *saleApplication.Status != WAITING {
+		return ccutil.Conflict("Only waiting applications can be approved").Response()
+	}
+
+	callerIds, err := getCallerPartyIds(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	approved := false
+	for _, role := range []string{SELLER, BUYER} {
+		for _, party := range getParties(saleApplication, role) {
+			id := partyId(party)
+			if hasApproved(saleApplication, id, role) {
+				continue
+			}
+			delegation, err := actingFor(APIstub, "approveApplication", id, callerIds, txTime)
+			if err != nil {
+				continue
+			}
+			approval := PartyApproval{PartyId: id, Role: role, Date: txTime.Format(time.RFC3339), TxId: APIstub.GetTxID()}
+			if delegation != nil {
+				approval.Agent = delegation.Agent
+				saleApplication.DelegatedActions = append(saleApplication.DelegatedActions, delegatedAction(APIstub, "approveApplication", *delegation, txTime))
+			}
+			saleApplication.PartyApprovals = append(saleApplication.PartyApprovals, approval)
+			approved = true
+		}
+	}
+	if !approved {
+		return ccutil.Forbidden("Caller is not a seller or buyer, or their agent, waiting to approve the application").Response()
+	}
+
+	_, err = t.putApplication(APIstub, saleApplication)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(nil)
+}
+
+// Returns the sellers or the buyers of the application
+func getParties(saleApplication SaleApplication, role string) []Party {
+	if role == SELLER {
+		return getSellers(saleApplication)
+	}
+	return getBuyers(saleApplication)
+}
+
+// Returns the sellers of the application, a single seller may be given as a person
+func getSellers(saleApplication SaleApplication) []Party {
+	if len(saleApplication.Sellers) > 0 || saleApplication.Seller == nil {
+		return saleApplication.Sellers
+	}
+	return []Party{personAsParty(*saleApplication.Seller)}
+}
+
+// Returns the buyers of the application, a single buyer may be given as a person
+func getBuyers(saleApplication SaleApplication) []Party {
+	if len(saleApplication.Buyers) > 0 || saleApplication.Buyer == nil {
+		return saleApplication.Buyers
+	}
+	return []Party{personAsParty(*saleApplication.Buyer)}
+}
+
+func personAsParty(person Person) Party {
+	partyType := NATURAL_PERSON
+	return Party{Type: &partyType, FirstName: person.FirstName, LastName: person.LastName, PersonalCode: person.PersonalCode}
+}
+
+// Natural persons are identified by their personal code, legal persons by their registry code
+func partyId(party Party) string {
+	if party.Type != nil && *party.Type == LEGAL_PERSON {
+		if party.RegistryCode != nil {
+			return *party.RegistryCode
+		}
+		return ""
+	}
+	if party.PersonalCode != nil {
+		return *party.PersonalCode
+	}
+	return ""
+}
+
+func hasApproved(saleApplication SaleApplication, id string, role string) bool {
+	for _, approval := range saleApplication.PartyApprovals {
+		if approval.PartyId == id && approval.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Function validates the sellers and buyers of a new application
+func validateParties(saleApplication SaleApplication) error {
+	if saleApplication.Seller != nil && len(saleApplication.Sellers) > 0 {
+		return ccutil.InvalidInput("sellers", "Give either seller or sellers")
+	}
+	if saleApplication.Buyer != nil && len(saleApplication.Buyers) > 0 {
+		return ccutil.InvalidInput("buyers", "Give either buyer or buyers")
+	}
+	for _, role := range []string{SELLER, BUYER} {
+		seen := map[string]bool{}
+		for _, party := range getParties(saleApplication, role) {
+			if party.Type == nil || (*party.Type != NATURAL_PERSON && *party.Type != LEGAL_PERSON) {
+				return ccutil.InvalidInput("type", "Party type must be "+NATURAL_PERSON+" or "+LEGAL_PERSON)
+			}
+			if *party.Type == LEGAL_PERSON && (party.Name == nil || strings.TrimSpace(*party.Name) == "") {
+				return ccutil.InvalidInput("name", "name is mandatory for a legal person")
+			}
+			id := strings.TrimSpace(partyId(party))
+			if id == "" {
+				return ccutil.InvalidInput("", "Every "+role+" must have a personalCode or, for a legal person, a registryCode")
+			}
+			if seen[id] {
+				return ccutil.InvalidInput("", "The "+role+" "+id+" is listed twice")
+			}
+			seen[id] = true
+		}
+	}
+	return nil
+}
+
+// Function checks that the sellers are exactly the owners of the vehicle in the vehicle register
+func checkOwners(saleApplication SaleApplication, vehicle *RegisteredVehicle) error {
+	if vehicle == nil || len(vehicle.Owners) == 0 {
+		return nil
+	}
+	sellers := map[string]bool{}
+	for _, seller := range getSellers(saleApplication) {
+		sellers[partyId(seller)] = true
+	}
+	for _, owner := range vehicle.Owners {
+		if !sellers[partyId(owner)] {
+			return ccutil.Conflict("Owner " + partyId(owner) + " of the vehicle must be one of the sellers")
+		}
+		delete(sellers, partyId(owner))
+	}
+	for _, seller := range getSellers(saleApplication) {
+		if sellers[partyId(seller)] {
+			return ccutil.Conflict("Seller " + partyId(seller) + " does not own the vehicle")
+		}
+	}
+	return nil
+}
+
+// Function checks that every seller and buyer has approved a sale with several sellers or buyers
+func checkPartyApprovals(saleApplication SaleApplication) error {
+	if len(getSellers(saleApplication)) <= 1 && len(getBuyers(saleApplication)) <= 1 {
+		return nil
+	}
+	for _, role := range []string{SELLER, BUYER} {
+		for _, party := range getParties(saleApplication, role) {
+			if !hasApproved(saleApplication, partyId(party), role) {
+				return ccutil.Conflict("The " + role + " " + partyId(party) + " has not approved the sale")
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the personal and registry codes the caller's certificate carries
+func getCallerPartyIds(APIstub shim.ChaincodeStubInterface) (map[string]bool, error) {
+	ids := map[string]bool{}
+	for _, attribute := range []string{PERSONAL_CODE_ATTRIBUTE, REGISTRY_CODE_ATTRIBUTE} {
+		value, found, err := cid.GetAttributeValue(APIstub, attribute)
+		if err != nil {
+			return nil, ccutil.Internal("Unable to identify the caller: " + fmt.Sprint(err))
+		}
+		if found && value != "" {
+			ids[value] = true
+		}
+	}
+	if len(ids) == 0 {
+		return nil, ccutil.Forbidden("Caller's certificate carries no personal or registry code")
+	}
+	return ids, nil
+}
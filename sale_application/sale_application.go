@@ -24,14 +24,16 @@
 
 
 /*
-peer chaincode invoke -o orderer.lyl-network.com:7050  --tls --cafile /opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/ordererOrganizations/lyl-network.com/orderers/orderer.lyl-network.com/msp/tlscacerts/tlsca.lyl-network.com-cert.pem  -C $CHANNEL_NAME -n sacc -c '{"Args":["makeApplication","{\"applicationId\": \"LEP0000001\",\"seller\": {\"firstName\": \"Riita\",\"lastName\": \"Ratas\",\"personalCode\": \"123456789\"},\"buyer\": {\"firstName\": \"Mari\",\"lastName\": \"Maasikas\",\"personalCode\": \"123456779\"},\"vehicle\": {\"vin\":\"78347837483784\",\"mark\":\"Audi\",\"model\":\"A8\",\"registrationPlate\":\"123ABC\"},\"price\":\"30000.00\",\"status\":\"\"}"]}'
+The functions and the JSON they take are listed by: peer chaincode query -C $CHANNEL_NAME -n sacc -c '{"Args":["getMetadata"]}'
+
+peer chaincode invoke -o orderer.lyl-network.com:7050  --tls --cafile /opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/ordererOrganizations/lyl-network.com/orderers/orderer.lyl-network.com/msp/tlscacerts/tlsca.lyl-network.com-cert.pem  -C $CHANNEL_NAME -n sacc -c '{"Args":["makeApplication","{\"seller\": {\"firstName\": \"Riita\",\"lastName\": \"Ratas\",\"personalCode\": \"123456789\"},\"buyer\": {\"firstName\": \"Mari\",\"lastName\": \"Maasikas\",\"personalCode\": \"123456779\"},\"vehicle\": {\"vin\":\"78347837483784\",\"mark\":\"Audi\",\"model\":\"A8\",\"registrationPlate\":\"123ABC\"},\"price\":\"30000.00\",\"status\":\"\"}"]}'
 
 peer chaincode invoke -o orderer.lyl-network.com:7050  --tls --cafile /opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/ordererOrganizations/lyl-network.com/orderers/orderer.lyl-network.com/msp/tlscacerts/tlsca.lyl-network.com-cert.pem  -C $CHANNEL_NAME -n sacc -c '{"Args":["readApplication","{\"applicationId\": \"LEP0000001\"}"]}'
 
 
 */
 
-package main
+package sale_application
 
 /* Imports
  * 4 utility libraries for formatting, handling bytes, reading and writing JSON, and string manipulation
@@ -42,12 +44,13 @@ import (
 	"encoding/json"
 	"fmt"
 	//"strconv"
-  "errors"
 	"strings"
+	"time"
 	//"reflect"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/littlemyy/hlexample/ccutil"
+	"github.com/littlemyy/hlexample/fixtures"
 	sc "github.com/hyperledger/fabric/protos/peer"
-	//"github.com/icrowley/fake"
 )
 
 // Define the Application Contract structure
@@ -75,7 +78,59 @@ type SaleApplication struct {
 	Buyer  *Person `json:"buyer,omitempty"`
   Vehicle *Vehicle `json:"vehicle,omitempty"`
 	Price  *string `json:"price,omitempty"`
-	Status *string `json:"status,omitempty"`
+	Status *string `json:"status,omitempty" metadata:"readOnly"`
+	LeaseAssetKey *string `json:"leaseAssetKey,omitempty"` //set when reselling a repossessed lease asset
+	LienApprovals []LienApproval `json:"lienApprovals,omitempty" metadata:"readOnly"`
+	Odometer *OdometerReading `json:"odometer,omitempty" metadata:"readOnly"` //latest verified reading when the application was made
+	Sellers []Party `json:"sellers,omitempty"` //co-owners selling together, instead of seller
+	Buyers []Party `json:"buyers,omitempty"` //co-owners buying together, instead of buyer
+	PartyApprovals []PartyApproval `json:"partyApprovals,omitempty" metadata:"readOnly"`
+	DelegatedActions []DelegatedAction `json:"delegatedActions,omitempty" metadata:"readOnly"`
+	//set by putApplication on every write
+	CreatedBy *string `json:"createdBy,omitempty" metadata:"readOnly"`
+	CreatedAt *string `json:"createdAt,omitempty" metadata:"readOnly"`
+	UpdatedBy *string `json:"updatedBy,omitempty" metadata:"readOnly"`
+	UpdatedAt *string `json:"updatedAt,omitempty" metadata:"readOnly"`
+}
+
+// Odometer reading as kept by the vehicle register
+type OdometerReading struct {
+	Km int `json:"km"`
+	Source string `json:"source"`
+	ReadingDate string `json:"readingDate"`
+	RecordedBy string `json:"recordedBy"`
+	TxId string `json:"txId"`
+}
+
+// Approval of the sale by the holder of a lien on the vehicle
+type LienApproval struct {
+	Holder string `json:"holder"`
+	Date string `json:"date"`
+	TxId string `json:"txId"`
+}
+
+// Vehicle as kept by the vehicle register
+type RegisteredVehicle struct {
+	Vin string `json:"vin"`
+	RegistrationPlate string `json:"registrationPlate,omitempty"`
+	Stolen bool `json:"stolen"`
+	Odometer *OdometerReading `json:"odometer,omitempty"`
+	Inspection *struct {
+		NextDueDate string `json:"nextDueDate"`
+	} `json:"inspection,omitempty"`
+	Deregistration *struct {
+		Type string `json:"type"`
+	} `json:"deregistration,omitempty"`
+	Owners []Party `json:"owners,omitempty"`
+}
+
+// Lien on a vehicle as kept by the vehicle register
+type Lien struct {
+	LienId string `json:"lienId"`
+	Holder string `json:"holder"`
+	HolderCode string `json:"holderCode,omitempty"` //registry code of the lienholder
+	Amount string `json:"amount"`
+	ReleaseDate string `json:"releaseDate,omitempty"`
 }
 
 const ACCEPTED string ="accepted"
@@ -84,6 +139,29 @@ const CANCELLED string ="cancelled"
 const WAITING string="waiting"
 const FINISHED string="finished"
 
+// Allowed application status changes: new status -> statuses it may follow
+var statusTransitions = map[string][]string{
+	ACCEPTED:  {WAITING},
+	REJECTED:  {WAITING},
+	CANCELLED: {WAITING, ACCEPTED},
+	FINISHED:  {ACCEPTED},
+}
+
+// Parties who may move an application to the status, themselves or through an agent
+var statusParties = map[string][]string{
+	ACCEPTED:  {BUYER},
+	REJECTED:  {BUYER},
+	CANCELLED: {SELLER},
+	FINISHED:  {SELLER, BUYER},
+}
+
+// Lease assets are kept by the "lyl" chaincode on the same channel
+const LYL_CHAINCODE string="lyl"
+// Vehicles are kept by the "vehicle_register" chaincode on the same channel
+const VEHICLE_REGISTER_CHAINCODE string="vehicle_register"
+// Status of a repossessed lease asset its leaser has put up for resale
+const REMARKETED string="remarketed"
+
 /*
  * The Init method is called when the Application Contract "sale application" is instantiated by the blockchain network
  * Best practice is to have any Ledger initialization in separate function -- see initLedger()
@@ -98,94 +176,117 @@ func (t *ApplicationContract) Init(APIstub shim.ChaincodeStubInterface) sc.Respo
  * The calling application program has also specified the particular smart contract function to be called, with arguments
  */
 func (t *ApplicationContract) Invoke(APIstub shim.ChaincodeStubInterface) sc.Response {
+	return t.routes().Invoke(APIstub)
+}
 
-	// Retrieve the requested Smart Contract function and arguments
-	function, args := APIstub.GetFunctionAndParameters()
-	// Route to the appropriate handler function to interact with the ledger appropriately
-	if function == "makeTestData" {
-		return t.makeTestData(APIstub)
-	} else if function == "makeApplication" {
-		return t.makeApplication(APIstub, args)
-	} else if function == "acceptApplication" {
-		return t.acceptApplication(APIstub, args)
-	} else if function == "rejectApplication" {
-		return t.rejectApplication(APIstub, args)
-	} else if function == "cancelApplication" {
-		return t.cancelApplication(APIstub, args)
-	} else if function == "getBuyerApplications" { //list of sale applications
-		return t.getBuyerApplications(APIstub, args)
-	} else if function =="getSellerApplications" {
-		return t.getSellerApplications(APIstub, args)
-	} else if function =="getInApplications" {
-		return t.getInApplications(APIstub, args)
-	} else if function =="getOutApplications" {
-		return t.getOutApplications(APIstub, args)
-	} else if function =="readApplication" {
-		return t.readApplication(APIstub, args)
-	}
-
-	fmt.Println("query did not find func: " + function)
-  return shim.Error("Received unknown function query: " + function)
-}
-
-/*func (s *ApplicationContract) makeTestData2(APIstub shim.ChaincodeStubInterface) sc.Response {
-	var seller_first_name string
-	var seller_last_name string
-	var seller_peronal_code string
-  var seller Person
-	var buyer Person
-	var buyer_first_name string
-	var buyer_last_name string
-	var buyer_personal_code string
-	var vehicle Vehicle
-  var vehicle_vin string
-	var vehicle_mark string
-  var vehicle_model string
-	var vehicle_registration_plate string
-	var price string
-	var status string
-
-	applicationsIn := []SaleApplication
-
-	j := 0
-
-	for j < 50 {
-		seller_first_name = fake.FirstName()
-		seller_last_name = fake.lastName()
-		seller_peronal_code = "123456791011"
-		seller = Person{FirstName:&seller_first_name,LastName:&seller_last_name,PersonalCode:&seller_personal_code}
-
-		buyer_first_name = fake.FirstName()
-		buyer_last_name = fake.lastName()
-		buyer_personal_code ="123456791011"
-		buyer = Person{FirstName:&buyer_first_name,LastName:&buyer_last_name,PersonalCode:&buyer_personal_code}
-
-		vehicle_vin ="12345678"
-		vehicle_mark =fake.Brand()
-		vehicle_model =fake.Model()
-		vehicle_registration_plate="123ABS"
-		price ="100000.00"
-		status=WAITING
-
-		vehicle = Vehicle{Vin:&vehicle_vin,Mark:&vehicle_mark,Model:&vehicle_model,RegistrationPlate:&vehicle_registration_plate}
+// Name and version published by getMetadata
+const CONTRACT_NAME string = "sale_application"
+const CONTRACT_VERSION string = "1.0"
 
-		applicationsIn[i]:= SaleApplication{ApplicationId:&applicationId, Seller:&seller, Buyer:&buyer, Vehicle:&vehicle, Price:&price, Status:&status},
+// Generated application ids start with the prefix, see ccutil.NewID
+const APPLICATION_ID_PREFIX string = "LEP"
 
-	}
-
-	i := 0
-	for i < len(applicationsIn) {
-		fmt.Println("i is ", i)
-		applicationAsBytes, _ := json.Marshal(applicationsIn[i])
-		APIstub.PutState(*applicationsIn[i].ApplicationId, applicationAsBytes)
-		fmt.Println("Added", applicationsIn[i])
-		i = i + 1
-	}
+// Stored records with their current schema versions, simple keys under ""
+var schemas = ccutil.Schemas{
+	"":            {MovedTo: "application"},
+	"application": {DocType: "saleApplication", Version: 1, Type: SaleApplication{}},
+	"delegation":  {DocType: "delegation", Version: 1, Type: Delegation{}},
+}
 
-	return shim.Success(nil)
-}*/
+/*
+ * The contract's functions with their arguments. Invoke routes every call through this table.
+ */
+func (t *ApplicationContract) routes() *ccutil.Router {
+	return ccutil.NewRouter().
+		WithMetadata(CONTRACT_NAME, CONTRACT_VERSION).
+		WithSnapshots(CONTRACT_NAME, CONTRACT_VERSION, schemas).
+		WithSchemas(schemas).
+		Add(ccutil.Route{Function: "makeTestData", Handler: t.makeTestData,
+			Description: "Writes the sample applications"}).
+		Add(ccutil.Route{Function: "generateTestData", Handler: t.generateTestData,
+			Description: "Writes generated sale applications in every status, the same seed and count give matching data in every contract",
+			DevOnly: true,
+			Args: []ccutil.Arg{
+				{Name: "seed", Type: ccutil.STRING_ARG, Description: "Seed of the generator, an integer"},
+				{Name: "count", Type: ccutil.STRING_ARG, Optional: true, Description: "Number of applications, 1 to 500, 10 by default"},
+			}}).
+		Add(ccutil.Route{Function: "makeApplication", Handler: t.makeApplication,
+			Description: "Makes a sale application on behalf of the sellers under a generated applicationId",
+			Returns: SaleApplication{},
+			Args: []ccutil.Arg{
+				{Name: "application", Type: ccutil.JSON_ARG, Description: "Sale application without applicationId", Schema: SaleApplication{}, ReadOnly: []string{"applicationId"}},
+				{Name: "idempotencyKey", Type: ccutil.STRING_ARG, Optional: true, Description: "Caller's key of the request, a resubmitted call with the same key returns the application the first call made"},
+			}}).
+		Add(ccutil.Route{Function: "acceptApplication", Handler: t.acceptApplication,
+			Description: "Accepts the application as a buyer, or their agent",
+			Args: []ccutil.Arg{
+				{Name: "application", Type: ccutil.JSON_ARG, Description: "Application with applicationId", Schema: SaleApplication{}},
+				{Name: "status", Type: ccutil.STRING_ARG, Description: "Ignored, the function sets the status"},
+			}}).
+		Add(ccutil.Route{Function: "rejectApplication", Handler: t.rejectApplication,
+			Description: "Rejects the application as a buyer, or their agent",
+			Args: []ccutil.Arg{
+				{Name: "application", Type: ccutil.JSON_ARG, Description: "Application with applicationId", Schema: SaleApplication{}},
+				{Name: "status", Type: ccutil.STRING_ARG, Description: "Ignored, the function sets the status"},
+			}}).
+		Add(ccutil.Route{Function: "cancelApplication", Handler: t.cancelApplication,
+			Description: "Cancels the application as a seller, or their agent",
+			Args: []ccutil.Arg{
+				{Name: "application", Type: ccutil.JSON_ARG, Description: "Application with applicationId", Schema: SaleApplication{}},
+				{Name: "status", Type: ccutil.STRING_ARG, Description: "Ignored, the function sets the status"},
+			}}).
+		Add(ccutil.Route{Function: "getBuyerApplications", Handler: t.getBuyerApplications,
+			Description: "Not implemented yet, returns an empty payload. Meant to return the buyer's applications"}).
+		Add(ccutil.Route{Function: "getSellerApplications", Handler: t.getSellerApplications,
+			Description: "Not implemented yet, returns an empty payload. Meant to return the seller's applications"}).
+		Add(ccutil.Route{Function: "getInApplications", Handler: t.getInApplications,
+			Description: "Not implemented yet, returns an empty payload. Meant to return the applications of the selling leasing company"}).
+		Add(ccutil.Route{Function: "getOutApplications", Handler: t.getOutApplications,
+			Description: "Not implemented yet, returns an empty payload. Meant to return the applications of the buying leasing company"}).
+		Add(ccutil.Route{Function: "readApplication", Handler: t.readApplication,
+			Description: "Returns the application",
+			Returns: SaleApplication{},
+			Args: []ccutil.Arg{
+				{Name: "application", Type: ccutil.JSON_ARG, Description: "Application with applicationId", Schema: SaleApplication{}},
+			}}).
+		Add(ccutil.Route{Function: "finishApplication", Handler: t.finishApplication,
+			Description: "Finishes the sale as a seller or buyer, or their agent",
+			Args: []ccutil.Arg{
+				{Name: "application", Type: ccutil.JSON_ARG, Description: "Application with applicationId", Schema: SaleApplication{}},
+				{Name: "status", Type: ccutil.STRING_ARG, Description: "Ignored, the function sets the status"},
+			}}).
+		Add(ccutil.Route{Function: "approveLienholderSale", Handler: t.approveLienholderSale,
+			Description: "Approves the sale as the holder of a lien on the vehicle",
+			Args: []ccutil.Arg{
+				{Name: "application", Type: ccutil.JSON_ARG, Description: "Application with applicationId", Schema: SaleApplication{}},
+			}}).
+		Add(ccutil.Route{Function: "approveApplication", Handler: t.approveApplication,
+			Description: "Approves the sale as a seller or buyer, or their agent",
+			Args: []ccutil.Arg{
+				{Name: "application", Type: ccutil.JSON_ARG, Description: "Application with applicationId", Schema: SaleApplication{}},
+			}}).
+		Add(ccutil.Route{Function: "grantDelegation", Handler: t.grantDelegation,
+			Description: "Gives an agent power of attorney",
+			Returns: Delegation{},
+			Args: []ccutil.Arg{
+				{Name: "delegation", Type: ccutil.JSON_ARG, Description: "Delegation", Schema: Delegation{}},
+			}}).
+		Add(ccutil.Route{Function: "revokeDelegation", Handler: t.revokeDelegation,
+			Description: "Revokes a delegation",
+			Returns: Delegation{},
+			Args: []ccutil.Arg{
+				{Name: "principal", Type: ccutil.STRING_ARG, Description: "Personal or registry code of the principal"},
+				{Name: "delegationId", Type: ccutil.STRING_ARG, Description: "Delegation id"},
+			}}).
+		Add(ccutil.Route{Function: "getDelegations", Handler: t.getDelegations,
+			Description: "Returns the principal's delegations",
+			Returns: []Delegation{},
+			Args: []ccutil.Arg{
+				{Name: "principal", Type: ccutil.STRING_ARG, Description: "Personal or registry code of the principal"},
+			}})
+}
 
-func (s *ApplicationContract) makeTestData(APIstub shim.ChaincodeStubInterface) sc.Response {
+func (s *ApplicationContract) makeTestData(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 	var applicationId string = "100000"
 	var seller_first_name string ="Ulvi"
 	var seller_last_name string ="Sädem"
@@ -219,8 +320,10 @@ func (s *ApplicationContract) makeTestData(APIstub shim.ChaincodeStubInterface)
 	i := 0
 	for i < len(applicationsIn) {
 		fmt.Println("i is ", i)
-		applicationAsBytes, _ := json.Marshal(applicationsIn[i])
-		APIstub.PutState(*applicationsIn[i].ApplicationId, applicationAsBytes)
+		_, err := s.putApplication(APIstub, applicationsIn[i])
+		if err != nil {
+			return ccutil.ErrorResponse(err)
+		}
 		fmt.Println("Added", applicationsIn[i])
 		i = i + 1
 	}
@@ -228,6 +331,27 @@ func (s *ApplicationContract) makeTestData(APIstub shim.ChaincodeStubInterface)
 	return shim.Success(nil)
 }
 
+// Writes generated sale applications between the generated persons, see package fixtures. args: seed, optionally count
+func (s *ApplicationContract) generateTestData(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	generated, err := fixtures.FromArgs(args)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	for _, generatedApplication := range generated.Applications {
+		application := generatedApplication
+		seller := Person{FirstName: &application.Seller.FirstName, LastName: &application.Seller.LastName, PersonalCode: &application.Seller.PersonalCode}
+		buyer := Person{FirstName: &application.Buyer.FirstName, LastName: &application.Buyer.LastName, PersonalCode: &application.Buyer.PersonalCode}
+		vehicle := Vehicle{Vin: &application.Vehicle.Vin, Mark: &application.Vehicle.Mark, Model: &application.Vehicle.Model, RegistrationPlate: &application.Vehicle.RegistrationPlate}
+		_, err := s.putApplication(APIstub, SaleApplication{ApplicationId: &application.ApplicationId, Seller: &seller, Buyer: &buyer, Vehicle: &vehicle, Price: &application.Price, Status: &application.Status})
+		if err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+	}
+
+	return shim.Success(nil)
+}
+
 
 // Function is called to validate input
 func (t *ApplicationContract) validateInput(args []string) (applicationIn SaleApplication, err error) {
@@ -236,7 +360,7 @@ func (t *ApplicationContract) validateInput(args []string) (applicationIn SaleAp
   fmt.Println("validateInput")
 	// Assumes that we have json input
 	if len(args) !=1 {
-		err = errors.New("Incorrect number of arguments. Expecting a json string with mandatory applicationId")
+		err = ccutil.InvalidInput("", "Incorrect number of arguments. Expecting a json string with mandatory applicationId")
 		return saleApplication, err
 
 	}
@@ -248,18 +372,18 @@ func (t *ApplicationContract) validateInput(args []string) (applicationIn SaleAp
 	err = json.Unmarshal(stateJSON,&applicationIn)
 
 	if err!=nil {
-		err = errors.New("Unable to unmarshal input JSON data"+fmt.Sprint(err))
+		err = ccutil.InvalidInput("", "Unable to unmarshal input JSON data: "+fmt.Sprint(err))
 		return saleApplication, err
 		}
 
 	if applicationIn.ApplicationId !=nil {
 		applicationId = strings.TrimSpace(*applicationIn.ApplicationId)
 		if applicationId=="" {
-			err = errors.New("ApplicationId not passed")
+			err = ccutil.InvalidInput("applicationId", "ApplicationId not passed")
 			return saleApplication, err
 		}
 	} else {
-		err = errors.New("Application ID is mandatory in the input JSON data")
+		err = ccutil.InvalidInput("applicationId", "Application ID is mandatory in the input JSON data")
 		return saleApplication, err
 	}
 	applicationIn.ApplicationId = &applicationId
@@ -277,18 +401,21 @@ func (t *ApplicationContract) readApplication(APIstub shim.ChaincodeStubInterfac
 
 	applicationIn,err:=t.validateInput(args)
 	if err!=nil {
-		return shim.Error("Couldn't find the application")
+		return ccutil.ErrorResponse(err)
 	}
 
 	applicationID = *applicationIn.ApplicationId
-	applicationAsBytes, err := APIstub.GetState(applicationID)
-	if err!=nil || len(applicationAsBytes)==0{
-		return shim.Error("Unable to get application state from the ledger")
+	applicationAsBytes, err := schemas.Get(APIstub, "application", applicationID)
+	if err!=nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if len(applicationAsBytes)==0 {
+		return ccutil.NotFound("Couldn't find the application " + applicationID).Response()
 	}
 
 	err = json.Unmarshal(applicationAsBytes, &saleApplication)
 	if err!=nil {
-		return shim.Error("Unable to unmarshal application data received from the ledger")
+		return ccutil.Internal("Unable to unmarshal application data received from the ledger").Response()
 	}
 	fmt.Println("Application status " + *saleApplication.Status)
 	return shim.Success(applicationAsBytes)
@@ -306,9 +433,21 @@ func (t *ApplicationContract) makeApplication(APIstub shim.ChaincodeStubInterfac
 
 	fmt.Println("running makeApplication()")
 
-	applicationIn,err:=t.validateInput(args)
-	if err!=nil {
-		return shim.Error(fmt.Sprint(err))
+	//the application id is generated, from the transaction id or from the caller's idempotency key
+	applicationIn := SaleApplication{}
+	err = json.Unmarshal([]byte(args[0]), &applicationIn)
+	if err != nil {
+		return ccutil.InvalidInput("application", "Unable to unmarshal input JSON data: "+fmt.Sprint(err)).Response()
+	}
+	if applicationIn.ApplicationId != nil {
+		return ccutil.InvalidInput("applicationId", "The application id is generated by the contract and can't be passed").Response()
+	}
+	applicationId = ccutil.NewID(APIstub, APPLICATION_ID_PREFIX, 0)
+	if len(args) > 1 && args[1] != "" {
+		applicationId, err = ccutil.IdempotentID(APIstub, APPLICATION_ID_PREFIX, args[1])
+		if err != nil {
+			return ccutil.ErrorResponse(err)
+		}
 	}
 	/*if len(args) !=1 {
 		err = errors.New("Incorrect number of arguments. Expecting a json string with mandatory applicationId")
@@ -322,13 +461,15 @@ func (t *ApplicationContract) makeApplication(APIstub shim.ChaincodeStubInterfac
 	err = json.Unmarshal(stateJSON,&applicationIn)
 	*/
 
-  applicationId = *applicationIn.ApplicationId
-	applicationAsBytes, err := APIstub.GetState(applicationId)
-	if err != nil || len(applicationAsBytes)==0 {
-		applicationStub = applicationIn //The record that goes into stub is the one that came in
-	} else {
-		fmt.Println("else case: update")
+	applicationAsBytes, err := schemas.Get(APIstub, "application", applicationId)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
 	}
+	if applicationAsBytes != nil {
+		//a resubmitted call, the application its first submission made is returned as it is
+		return shim.Success(applicationAsBytes)
+	}
+	applicationStub = applicationIn //The record that goes into stub is the one that came in
 
 	/* Possible business rules
 		- Vehicle must be provided
@@ -336,22 +477,84 @@ func (t *ApplicationContract) makeApplication(APIstub shim.ChaincodeStubInterfac
 		- Seller has to have rights to initiate the sale
 		- Sama auto kohta ei tohi olla teist taotlust
 	*/
-
-  *applicationStub.Status = WAITING
-	applicationJSON, err := json.Marshal(applicationStub)
+	err = validateParties(applicationIn)
 	if err != nil {
-		return shim.Error("Marshal failed for contract state" + fmt.Sprint(err))
+		return ccutil.ErrorResponse(err)
+	}
+	//approvals are given after the application is made, and the reading comes from the vehicle register only
+	applicationStub.LienApprovals = nil
+	applicationStub.PartyApprovals = nil
+	applicationStub.DelegatedActions = nil
+	applicationStub.Odometer = nil
+
+	//the caller must be one of the sellers or act for one under a delegation
+	callerIds, err := getCallerPartyIds(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	acting := false
+	for _, seller := range getSellers(applicationIn) {
+		if callerIds[partyId(seller)] {
+			acting = true
+		}
+	}
+	for _, seller := range getSellers(applicationIn) {
+		if acting {
+			break
+		}
+		delegation, err := actingFor(APIstub, "makeApplication", partyId(seller), callerIds, txTime)
+		if err == nil {
+			applicationStub.DelegatedActions = append(applicationStub.DelegatedActions, delegatedAction(APIstub, "makeApplication", *delegation, txTime))
+			acting = true
+		}
+	}
+	if !acting {
+		return ccutil.Forbidden("Caller is not a seller or an agent of a seller").Response()
 	}
-	//get existing state from the stub
+
+	if applicationIn.Vehicle != nil && applicationIn.Vehicle.Vin != nil {
+		vehicle, err := t.checkVehicle(APIstub, *applicationIn.Vehicle.Vin)
+		if err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+		err = checkOwners(applicationIn, vehicle)
+		if err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+		if vehicle != nil {
+			applicationStub.Odometer = vehicle.Odometer
+			plate := applicationIn.Vehicle.RegistrationPlate
+			if plate != nil && vehicle.RegistrationPlate != "" && !samePlate(*plate, vehicle.RegistrationPlate) {
+				return ccutil.Conflict("Vehicle " + vehicle.Vin + " is registered with plate " + vehicle.RegistrationPlate).Response()
+			}
+		}
+	}
+	if applicationIn.LeaseAssetKey != nil {
+		err = t.checkResaleAsset(APIstub, *applicationIn.LeaseAssetKey)
+		if err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+	}
+
+	status := WAITING
+	applicationStub.Status = &status
+	//who made the application and when is stamped by putApplication, never taken from the input
+	applicationStub.ApplicationId = &applicationId
+	applicationStub.CreatedBy = nil
+	applicationStub.CreatedAt = nil
 
 	//Write the new state to the ledger
-	err = APIstub.PutState(applicationId, applicationJSON)
+	applicationAsBytes, err = t.putApplication(APIstub, applicationStub)
 	if err != nil {
-		return shim.Error("Put ledger state failed: "+ fmt.Sprint(err))
+		return ccutil.ErrorResponse(err)
 	}
 
 
-	return shim.Success(nil)
+	return shim.Success(applicationAsBytes)
 	/*if len(args) != 1 {
 		return shim.Error("Incorrect number of arguments. Expecting 1")
 	}*/
@@ -361,15 +564,125 @@ func (t *ApplicationContract) makeApplication(APIstub shim.ChaincodeStubInterfac
 }
 
 
-// function is called to change application status
-func (t *ApplicationContract) changeApplicationStatus(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+// Function checks with the vehicle register that the vehicle may be sold.
+// Returns the registered vehicle, or nil when the VIN isn't in the register.
+func (t *ApplicationContract) checkVehicle(APIstub shim.ChaincodeStubInterface, vin string) (*RegisteredVehicle, error) {
+	response := APIstub.InvokeChaincode(VEHICLE_REGISTER_CHAINCODE, [][]byte{[]byte("queryVehicle"), []byte(vin)}, "")
+	if response.Status != shim.OK {
+		return nil, ccutil.DependencyFailed("Unable to check the vehicle "+vin, response)
+	}
+	if len(response.Payload) == 0 {
+		return nil, nil
+	}
+	var vehicle RegisteredVehicle
+	err := json.Unmarshal(response.Payload, &vehicle)
+	if err != nil {
+		return nil, ccutil.Internal("Unable to unmarshal vehicle data received from the ledger")
+	}
+	if vehicle.Stolen {
+		return nil, ccutil.Conflict("Vehicle " + vin + " is reported stolen")
+	}
+	if vehicle.Deregistration != nil {
+		return nil, ccutil.Conflict("Vehicle " + vin + " is deregistered (" + vehicle.Deregistration.Type + ")")
+	}
+	if vehicle.Inspection != nil {
+		txTime, err := ccutil.TxTime(APIstub)
+		if err != nil {
+			return nil, err
+		}
+		if err = ccutil.CheckInspectionDue(vin, vehicle.Inspection.NextDueDate, txTime); err != nil {
+			return nil, err
+		}
+	}
+	return &vehicle, nil
+}
+
+// Plates are compared the way the vehicle register keeps them: upper case without spaces or dashes
+func samePlate(a string, b string) bool {
+	normalize := strings.NewReplacer(" ", "", "-", "")
+	return strings.ToUpper(normalize.Replace(a)) == strings.ToUpper(normalize.Replace(b))
+}
+
+// Function checks that the lease asset has been repossessed and put up for resale by its leaser
+func (t *ApplicationContract) checkResaleAsset(APIstub shim.ChaincodeStubInterface, assetKey string) error {
+	response := APIstub.InvokeChaincode(LYL_CHAINCODE, [][]byte{[]byte("queryAsset"), []byte(assetKey)}, "")
+	if response.Status != shim.OK {
+		return ccutil.DependencyFailed("Unable to check the lease asset "+assetKey, response)
+	}
+	if len(response.Payload) == 0 {
+		return ccutil.NotFound("Couldn't find the lease asset " + assetKey)
+	}
+	var asset struct {
+		Status string `json:"status"`
+	}
+	err := json.Unmarshal(response.Payload, &asset)
+	if err != nil {
+		return ccutil.Internal("Unable to unmarshal lease asset data received from the ledger")
+	}
+	if asset.Status != REMARKETED {
+		return ccutil.Conflict("Lease asset " + assetKey + " is not listed for resale")
+	}
+	return nil
+}
+
+// function is called to change application status, function names the calling function for the delegations
+// args: json string with mandatory applicationId, new status
+func (t *ApplicationContract) changeApplicationStatus(APIstub shim.ChaincodeStubInterface, args []string, function string) sc.Response {
 	fmt.Println("running changeApplicationStatus: " + args[1])
 	/* Possible business rules
+		- Status changes follow statusTransitions
+		- Only the parties in statusParties, or their agents, change the status
+		- A vehicle with an unreleased third party lien can't be sold without the lienholder's approval
 	*/
+	status := args[1]
 
-	
+	saleApplication, err := t.getApplication(APIstub, args[:1])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
 
+	current := ""
+	if saleApplication.Status != nil {
+		current = *saleApplication.Status
+	}
+	allowed := false
+	for _, from := range statusTransitions[status] {
+		if from == current {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return ccutil.Conflict("Application in status " + current + " can't be moved to " + status).Response()
+	}
 
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	delegation, err := actingForParty(APIstub, function, saleApplication, statusParties[status], txTime)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if delegation != nil {
+		saleApplication.DelegatedActions = append(saleApplication.DelegatedActions, delegatedAction(APIstub, function, *delegation, txTime))
+	}
+
+	if status == ACCEPTED || status == FINISHED {
+		err = checkPartyApprovals(saleApplication)
+		if err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+		err = t.checkLiens(APIstub, saleApplication)
+		if err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+	}
+
+	saleApplication.Status = &status
+	_, err = t.putApplication(APIstub, saleApplication)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
 
 	return shim.Success(nil)
 }
@@ -377,50 +690,161 @@ func (t *ApplicationContract) changeApplicationStatus(APIstub shim.ChaincodeStub
 // function is called to change application status to Accepted
 func (t *ApplicationContract) acceptApplication(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
   fmt.Println("running acceptApplication()")
-
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
-	}
   args[1]=ACCEPTED
-	t.changeApplicationStatus(APIstub,args)
-	/* Possible business rules
-		- ApplicationID must be provided
-		- New status is within allowed statuses
-
-	*/
-	/* if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
-	}*/
-
-	return shim.Success(nil)
+	return t.changeApplicationStatus(APIstub,args,"acceptApplication")
 }
 
 // function is called to change application status to Rejected
 func (t *ApplicationContract) rejectApplication(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 	fmt.Println("running rejectApplication()")
 	args[1]=REJECTED
-	t.changeApplicationStatus(APIstub,args)
-
-	/* if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
-	}*/
-
-	return shim.Success(nil)
+	return t.changeApplicationStatus(APIstub,args,"rejectApplication")
 }
 
 // function is called to change application status to Cancelled
 func (t *ApplicationContract) cancelApplication(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 	fmt.Println("running cancelApplication()")
   args[1]=CANCELLED
-	t.changeApplicationStatus(APIstub, args)
+	return t.changeApplicationStatus(APIstub, args, "cancelApplication")
+}
 
-	/* if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
-	}*/
+// function is called to change application status to Finished
+func (t *ApplicationContract) finishApplication(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	fmt.Println("running finishApplication()")
+	args[1]=FINISHED
+	return t.changeApplicationStatus(APIstub, args, "finishApplication")
+}
+
+// function is called by a lienholder organisation to approve the sale of the vehicle it holds a lien on
+func (t *ApplicationContract) approveLienholderSale(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	fmt.Println("running approveLienholderSale()")
+
+	saleApplication, err := t.getApplication(APIstub, args)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	holder, err := ccutil.CallerOrganisation(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	liens, err := t.getUnreleasedLiens(APIstub, saleApplication)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	holdsLien := false
+	for _, lien := range liens {
+		if lien.Holder == holder {
+			holdsLien = true
+		}
+	}
+	if !holdsLien {
+		return ccutil.Forbidden(holder + " holds no unreleased lien on the vehicle").Response()
+	}
+	for _, approval := range saleApplication.LienApprovals {
+		if approval.Holder == holder {
+			return ccutil.Conflict(holder + " has already approved the sale").Response()
+		}
+	}
+
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	saleApplication.LienApprovals = append(saleApplication.LienApprovals, LienApproval{Holder: holder, Date: txTime.Format(time.RFC3339), TxId: APIstub.GetTxID()})
+	_, err = t.putApplication(APIstub, saleApplication)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
 
 	return shim.Success(nil)
 }
 
+// Function checks that every unreleased lien held by someone else than the seller has been approved by its holder.
+// Sellers are known by their personal or registry codes, so a lien is the seller's when its holder's registry code is.
+func (t *ApplicationContract) checkLiens(APIstub shim.ChaincodeStubInterface, saleApplication SaleApplication) error {
+	liens, err := t.getUnreleasedLiens(APIstub, saleApplication)
+	if err != nil {
+		return err
+	}
+	sellers := map[string]bool{}
+	for _, seller := range getSellers(saleApplication) {
+		sellers[partyId(seller)] = true
+	}
+	for _, lien := range liens {
+		if lien.HolderCode != "" && sellers[lien.HolderCode] {
+			continue
+		}
+		approved := false
+		for _, approval := range saleApplication.LienApprovals {
+			if approval.Holder == lien.Holder {
+				approved = true
+			}
+		}
+		if !approved {
+			return ccutil.Conflict("Vehicle has an unreleased lien held by " + lien.Holder + ", the lienholder must approve the sale")
+		}
+	}
+	return nil
+}
+
+// Function returns the liens registered on the application's vehicle that are not released yet
+func (t *ApplicationContract) getUnreleasedLiens(APIstub shim.ChaincodeStubInterface, saleApplication SaleApplication) ([]Lien, error) {
+	liens := []Lien{}
+	if saleApplication.Vehicle == nil || saleApplication.Vehicle.Vin == nil {
+		return liens, nil
+	}
+	response := APIstub.InvokeChaincode(VEHICLE_REGISTER_CHAINCODE, [][]byte{[]byte("queryLiens"), []byte(*saleApplication.Vehicle.Vin)}, "")
+	if response.Status != shim.OK {
+		return nil, ccutil.DependencyFailed("Unable to check liens on the vehicle", response)
+	}
+	registered := []Lien{}
+	err := json.Unmarshal(response.Payload, &registered)
+	if err != nil {
+		return nil, ccutil.Internal("Unable to unmarshal lien data received from the ledger")
+	}
+	for _, lien := range registered {
+		if lien.ReleaseDate == "" {
+			liens = append(liens, lien)
+		}
+	}
+	return liens, nil
+}
+
+// Function reads the application identified by the json input
+func (t *ApplicationContract) getApplication(APIstub shim.ChaincodeStubInterface, args []string) (SaleApplication, error) {
+	var saleApplication SaleApplication
+
+	applicationIn, err := t.validateInput(args)
+	if err != nil {
+		return saleApplication, err
+	}
+	err = schemas.Load(APIstub, "application", &saleApplication, *applicationIn.ApplicationId)
+	return saleApplication, err
+}
+
+// Function writes the application to the ledger, stamping who changed it and when, and returns the stored JSON.
+// An application without createdBy is stamped as created by this transaction.
+func (t *ApplicationContract) putApplication(APIstub shim.ChaincodeStubInterface, saleApplication SaleApplication) ([]byte, error) {
+	creator, err := ccutil.CreatorIdentity(APIstub)
+	if err != nil {
+		return nil, err
+	}
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return nil, err
+	}
+	updatedAt := txTime.Format(time.RFC3339)
+	saleApplication.UpdatedBy = &creator
+	saleApplication.UpdatedAt = &updatedAt
+	if saleApplication.CreatedBy == nil {
+		saleApplication.CreatedBy = &creator
+		saleApplication.CreatedAt = &updatedAt
+	}
+
+	return schemas.Save(APIstub, "application", saleApplication, *saleApplication.ApplicationId)
+}
+
 /* function returns applications made for concrete buyer */
 func (t *ApplicationContract) getBuyerApplications(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
@@ -472,13 +896,3 @@ func (t *ApplicationContract) getOutApplications(APIstub shim.ChaincodeStubInter
 	return shim.Success(nil)
 
 }
-
-// The main function is only relevant in unit test mode. Only included here for completeness.
-func main() {
-
-	// Create a new Smart Contract
-	err := shim.Start(new(ApplicationContract))
-	if err != nil {
-		fmt.Printf("Error creating new Application Contract: %s", err)
-	}
-}
@@ -0,0 +1,94 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Scenario tests run the contracts on an in-memory devledger, at the time the test sets.
+ */
+
+package sale_application_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/littlemyy/hlexample/contracts"
+	"github.com/littlemyy/hlexample/devledger"
+)
+
+// person returns the identity of a natural person with the personal code
+func person(personalCode string) devledger.Identity {
+	return devledger.Identity{MspId: "ARKMSP", User: personalCode, Attrs: map[string]string{"personalCode": personalCode}}
+}
+
+// company returns the identity of a legal person's staff with the registry code
+func company(registryCode string) devledger.Identity {
+	return devledger.Identity{MspId: "ARKMSP", User: registryCode, Attrs: map[string]string{"registryCode": registryCode}}
+}
+
+type scenario struct {
+	t      *testing.T
+	ledger *devledger.Ledger
+	now    time.Time
+}
+
+func newScenario(t *testing.T, now string) *scenario {
+	s := &scenario{t: t, ledger: contracts.Register(devledger.New())}
+	s.at(now)
+	s.ledger.Now = func() time.Time { return s.now }
+	return s
+}
+
+// at sets the time of the next transactions, RFC3339
+func (s *scenario) at(now string) {
+	var err error
+	if s.now, err = time.Parse(time.RFC3339, now); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func (s *scenario) invoke(identity devledger.Identity, args ...string) *devledger.Result {
+	result, err := s.ledger.Invoke(identity, contracts.SALE_APPLICATION, args...)
+	if err != nil {
+		s.t.Fatalf("%v: %s", args, err)
+	}
+	return result
+}
+
+// ok invokes the function, fails the test unless it succeeds, and unmarshals the payload into out if given
+func (s *scenario) ok(out interface{}, identity devledger.Identity, args ...string) {
+	result := s.invoke(identity, args...)
+	if result.Response.Status != 200 {
+		s.t.Fatalf("%v: %d %s", args, result.Response.Status, result.Response.Message)
+	}
+	if out != nil {
+		if err := json.Unmarshal(result.Response.Payload, out); err != nil {
+			s.t.Fatalf("%v: %s", args, err)
+		}
+	}
+}
+
+// fails invokes the function and checks it fails with the status
+func (s *scenario) fails(status int32, identity devledger.Identity, args ...string) {
+	s.t.Helper()
+	result := s.invoke(identity, args...)
+	if result.Response.Status != status {
+		s.t.Errorf("%v: got %d %s, want %d", args, result.Response.Status, result.Response.Message, status)
+	}
+}
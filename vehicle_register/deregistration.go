@@ -0,0 +1,140 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Deregistration of vehicles leaving the fleet: scrapped, exported abroad or written off.
+ * A deregistered vehicle is read-only in the register.
+ */
+
+package vehicle_register
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/littlemyy/hlexample/ccutil"
+)
+
+// Define the deregistration structure
+type Deregistration struct {
+	Type                   string `json:"type" metadata:"readOnly"`
+	ReasonCode             string `json:"reasonCode"`
+	DestinationCountry     string `json:"destinationCountry,omitempty"`     //exports only, ISO 3166 alpha-2 code
+	DestructionCertificate string `json:"destructionCertificate,omitempty"` //scrapping only, certificate-of-destruction reference
+	Date                   string `json:"date" metadata:"readOnly"`
+	RecordedBy             string `json:"recordedBy" metadata:"readOnly"`
+	TxId                   string `json:"txId" metadata:"readOnly"`
+}
+
+// Deregistration types
+const SCRAPPED string = "scrapped"
+const EXPORTED string = "exported"
+const WRITTEN_OFF string = "written_off"
+
+// Name of the event announcing a deregistration
+const DEREGISTRATION_EVENT string = "VehicleDeregistered"
+
+// Called by a registry admin. args: vin, JSON e.g. {"reasonCode":"end_of_life","destructionCertificate":"COD-2019-0042"}
+func (s *SmartContract) scrapVehicle(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	return s.deregisterVehicle(APIstub, args[0], SCRAPPED, args[1])
+}
+
+// Called by a registry admin. args: vin, JSON e.g. {"reasonCode":"sold_abroad","destinationCountry":"LV"}
+func (s *SmartContract) exportVehicle(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	return s.deregisterVehicle(APIstub, args[0], EXPORTED, args[1])
+}
+
+// Called by a registry admin. args: vin, JSON e.g. {"reasonCode":"accident"}
+func (s *SmartContract) writeOffVehicle(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	return s.deregisterVehicle(APIstub, args[0], WRITTEN_OFF, args[1])
+}
+
+// Records the deregistration, frees the vehicle's plate and announces the change
+func (s *SmartContract) deregisterVehicle(APIstub shim.ChaincodeStubInterface, vin string, deregistrationType string, deregistrationJSON string) sc.Response {
+	fmt.Println("running deregisterVehicle: " + deregistrationType)
+
+	deregistration := Deregistration{}
+	if err := json.Unmarshal([]byte(deregistrationJSON), &deregistration); err != nil {
+		return ccutil.InvalidInput("", "Unable to unmarshal input JSON data: "+fmt.Sprint(err)).Response()
+	}
+	deregistration.Type = deregistrationType
+	if err := validateDeregistration(deregistration); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	vehicle, found, err := getVehicleForUpdate(APIstub, strings.TrimSpace(vin))
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if !found {
+		return ccutil.NotFound("Vehicle " + vin + " is not in the register").Response()
+	}
+
+	recordedBy, err := ccutil.CallerOrganisation(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	deregistration.Date = txTime.Format(time.RFC3339)
+	deregistration.RecordedBy = recordedBy
+	deregistration.TxId = APIstub.GetTxID()
+
+	if vehicle.RegistrationPlate != "" {
+		if err = releasePlate(APIstub, &vehicle, txTime); err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+	}
+	vehicle.Deregistration = &deregistration
+
+	vehicleAsBytes, err := putVehicle(APIstub, vehicle)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if err = APIstub.SetEvent(DEREGISTRATION_EVENT, vehicleAsBytes); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(vehicleAsBytes)
+}
+
+func validateDeregistration(deregistration Deregistration) error {
+	if strings.TrimSpace(deregistration.ReasonCode) == "" {
+		return ccutil.InvalidInput("reasonCode", "reasonCode is mandatory")
+	}
+	if deregistration.Type == EXPORTED && len(strings.TrimSpace(deregistration.DestinationCountry)) != 2 {
+		return ccutil.InvalidInput("destinationCountry", "destinationCountry must be a two letter country code")
+	}
+	if deregistration.Type != EXPORTED && deregistration.DestinationCountry != "" {
+		return ccutil.InvalidInput("destinationCountry", "destinationCountry is only given for exports")
+	}
+	if deregistration.Type == SCRAPPED && strings.TrimSpace(deregistration.DestructionCertificate) == "" {
+		return ccutil.InvalidInput("destructionCertificate", "destructionCertificate is mandatory when scrapping")
+	}
+	if deregistration.Type != SCRAPPED && deregistration.DestructionCertificate != "" {
+		return ccutil.InvalidInput("destructionCertificate", "destructionCertificate is only given when scrapping")
+	}
+	return nil
+}
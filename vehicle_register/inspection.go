@@ -0,0 +1,172 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Periodic technical inspections of the vehicle register
+ */
+
+package vehicle_register
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/littlemyy/hlexample/ccutil"
+)
+
+// Define the technical inspection structure
+type Inspection struct {
+	Vin         string   `json:"vin" metadata:"readOnly"`
+	Station     string   `json:"station"`
+	Date        string   `json:"date"` //YYYY-MM-DD
+	Result      string   `json:"result"`
+	Defects     []string `json:"defects,omitempty"`
+	NextDueDate string   `json:"nextDueDate"` //YYYY-MM-DD
+	Km          int      `json:"km"`
+	RecordedBy  string   `json:"recordedBy" metadata:"readOnly"`
+	TxId        string   `json:"txId" metadata:"readOnly"`
+}
+
+// Inspection results
+const INSPECTION_PASSED string = "passed"
+const INSPECTION_CONDITIONAL string = "conditional"
+const INSPECTION_FAILED string = "failed"
+
+var inspectionResults = []string{INSPECTION_PASSED, INSPECTION_CONDITIONAL, INSPECTION_FAILED}
+
+// Role of the inspection stations
+const INSPECTION_STATION_ROLE string = "inspection_station"
+
+/*
+ * Called by an inspection station. args: vin, inspection JSON e.g.
+ * {"station":"Tallinn Kadaka","date":"2019-05-01","result":"passed","defects":[],"nextDueDate":"2020-05-01","km":123456}
+ * The inspection's odometer reading goes into the odometer log as well.
+ */
+func (s *SmartContract) recordInspection(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	inspection := Inspection{}
+	if err := json.Unmarshal([]byte(args[1]), &inspection); err != nil {
+		return ccutil.InvalidInput("", "Unable to unmarshal input JSON data: "+fmt.Sprint(err)).Response()
+	}
+	recordedBy, err := ccutil.CallerOrganisation(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	inspection.Vin = strings.TrimSpace(args[0])
+	inspection.RecordedBy = recordedBy
+	inspection.TxId = APIstub.GetTxID()
+	if err = validateInspection(inspection, txTime); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	if _, err = schemas.Save(APIstub, "inspection", inspection, inspection.Vin, inspection.Date, inspection.TxId); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	vehicle, found, err := getVehicleForUpdate(APIstub, inspection.Vin)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if !found {
+		vehicle = Vehicle{Vin: inspection.Vin}
+	}
+
+	reading := OdometerReading{Vin: inspection.Vin, Km: inspection.Km, Source: ODOMETER_INSPECTION, ReadingDate: inspection.Date,
+		RecordedBy: recordedBy, RecordedAt: txTime.Format(time.RFC3339), TxId: inspection.TxId}
+	if err = addOdometerReading(APIstub, &vehicle, reading); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	if vehicle.Inspection == nil || vehicle.Inspection.Date <= inspection.Date {
+		vehicle.Inspection = &inspection
+	}
+	vehicleAsBytes, err := putVehicle(APIstub, vehicle)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(vehicleAsBytes)
+}
+
+// Returns a JSON array with the vehicle's inspections ordered by date. args: vin
+func (s *SmartContract) queryInspections(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	records, err := schemas.List(APIstub, "inspection", args[0])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	inspections := []Inspection{}
+	for _, inspectionAsBytes := range records {
+		inspection := Inspection{}
+		if err = json.Unmarshal(inspectionAsBytes, &inspection); err != nil {
+			return ccutil.Internal("Unable to unmarshal inspection data received from the ledger").Response()
+		}
+		inspections = append(inspections, inspection)
+	}
+
+	inspectionsAsBytes, err := json.Marshal(inspections)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	return shim.Success(inspectionsAsBytes)
+}
+
+func validateInspection(inspection Inspection, txTime time.Time) error {
+	if inspection.Vin == "" {
+		return ccutil.InvalidInput("vin", "VIN is mandatory")
+	}
+	if strings.TrimSpace(inspection.Station) == "" {
+		return ccutil.InvalidInput("station", "station is mandatory")
+	}
+	knownResult := false
+	for _, result := range inspectionResults {
+		if inspection.Result == result {
+			knownResult = true
+		}
+	}
+	if !knownResult {
+		return ccutil.InvalidInput("result", fmt.Sprintf("result must be one of %s", strings.Join(inspectionResults, ", ")))
+	}
+	date, err := time.Parse(ccutil.DATE_FORMAT, inspection.Date)
+	if err != nil {
+		return ccutil.InvalidInput("date", "date must be in YYYY-MM-DD format")
+	}
+	if date.After(txTime) {
+		return ccutil.InvalidInput("date", "date can't be in the future")
+	}
+	nextDueDate, err := time.Parse(ccutil.DATE_FORMAT, inspection.NextDueDate)
+	if err != nil {
+		return ccutil.InvalidInput("nextDueDate", "nextDueDate must be in YYYY-MM-DD format")
+	}
+	if !nextDueDate.After(date) {
+		return ccutil.InvalidInput("nextDueDate", "nextDueDate must be after the inspection date")
+	}
+	if inspection.Km < 0 {
+		return ccutil.InvalidInput("km", "km must not be negative")
+	}
+	return nil
+}
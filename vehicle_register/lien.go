@@ -0,0 +1,158 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Liens and encumbrances on vehicles. A vehicle with an unreleased lien can't be
+ * sold without the lienholder's approval, see the sale application contract.
+ */
+
+package vehicle_register
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/littlemyy/hlexample/ccutil"
+)
+
+// Define the lien structure. Amount is a decimal string like "30000.00".
+type Lien struct {
+	LienId         string `json:"lienId"`
+	Vin            string `json:"vin"`
+	Holder         string `json:"holder"`
+	HolderCode     string `json:"holderCode,omitempty"` //registry code of the lienholder, from its certificate
+	Amount         string `json:"amount"`
+	RegisteredDate string `json:"registeredDate"`
+	ReleaseDate    string `json:"releaseDate,omitempty"`
+}
+
+// Role of the banks and lessors that may register liens
+const LIENHOLDER_ROLE string = "lienholder"
+
+// A secured amount is a positive decimal like 30000.00
+var amountPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// Certificate attribute with the registry code of a legal person, as in the sale application contract
+const REGISTRY_CODE_ATTRIBUTE string = "registryCode"
+
+// Called by the lienholder organisation. args: vin, amount
+func (s *SmartContract) registerLien(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	vin := strings.TrimSpace(args[0])
+	if vin == "" {
+		return ccutil.InvalidInput("vin", "VIN is mandatory").Response()
+	}
+	amount := strings.TrimSpace(args[1])
+	if amount == "" {
+		return ccutil.InvalidInput("amount", "Amount is mandatory").Response()
+	}
+	if !amountPattern.MatchString(amount) || strings.Trim(amount, "0.") == "" {
+		return ccutil.InvalidInput("amount", "Amount must be a positive decimal like 30000.00").Response()
+	}
+
+	if _, _, err := getVehicleForUpdate(APIstub, vin); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	holder, err := ccutil.CallerOrganisation(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	// the sale application contract matches the holder with the sellers by this code
+	holderCode, _, err := cid.GetAttributeValue(APIstub, REGISTRY_CODE_ATTRIBUTE)
+	if err != nil {
+		return ccutil.Internal(fmt.Sprintf("Unable to identify the caller: %s", err)).Response()
+	}
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	lien := Lien{LienId: APIstub.GetTxID(), Vin: vin, Holder: holder, HolderCode: holderCode, Amount: amount, RegisteredDate: txTime.Format(time.RFC3339)}
+	lienAsBytes, err := putLien(APIstub, lien)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(lienAsBytes)
+}
+
+// Called by the lienholder organisation. args: vin, lienId
+func (s *SmartContract) releaseLien(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	lien := Lien{}
+	if err := schemas.Load(APIstub, "lien", &lien, args[0], args[1]); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if lien.ReleaseDate != "" {
+		return ccutil.Conflict("Lien was already released on " + lien.ReleaseDate).Response()
+	}
+
+	holder, err := ccutil.CallerOrganisation(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if holder != lien.Holder {
+		return ccutil.Forbidden("Only the lienholder " + lien.Holder + " may release the lien").Response()
+	}
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	lien.ReleaseDate = txTime.Format(time.RFC3339)
+	lienAsBytes, err := putLien(APIstub, lien)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(lienAsBytes)
+}
+
+// Returns a JSON array with all liens, released or not, registered on the vehicle. args: vin
+func (s *SmartContract) queryLiens(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	records, err := schemas.List(APIstub, "lien", args[0])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	liens := []Lien{}
+	for _, lienAsBytes := range records {
+		lien := Lien{}
+		if err = json.Unmarshal(lienAsBytes, &lien); err != nil {
+			return ccutil.Internal("Unable to unmarshal lien data received from the ledger").Response()
+		}
+		liens = append(liens, lien)
+	}
+
+	liensAsBytes, err := json.Marshal(liens)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	return shim.Success(liensAsBytes)
+}
+
+func putLien(APIstub shim.ChaincodeStubInterface, lien Lien) ([]byte, error) {
+	return schemas.Save(APIstub, "lien", lien, lien.Vin, lien.LienId)
+}
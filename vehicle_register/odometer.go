@@ -0,0 +1,196 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Odometer reading log of the vehicle register. A reading lower than one taken
+ * earlier, or higher than one taken later, is kept but flagged as a suspected rollback.
+ */
+
+package vehicle_register
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/littlemyy/hlexample/ccutil"
+)
+
+// Define the odometer reading structure
+type OdometerReading struct {
+	Vin               string `json:"vin" metadata:"readOnly"`
+	Km                int    `json:"km"`
+	Source            string `json:"source"`
+	ReadingDate       string `json:"readingDate"` //YYYY-MM-DD
+	RecordedBy        string `json:"recordedBy" metadata:"readOnly"`
+	RecordedAt        string `json:"recordedAt" metadata:"readOnly"`
+	TxId              string `json:"txId" metadata:"readOnly"`
+	Verified          bool   `json:"verified" metadata:"readOnly"`
+	RollbackSuspected bool   `json:"rollbackSuspected,omitempty" metadata:"readOnly"`
+}
+
+// Odometer reading sources
+const ODOMETER_INSPECTION string = "inspection"
+const ODOMETER_SALE string = "sale"
+const ODOMETER_LEASE_RETURN string = "lease_return"
+const ODOMETER_SERVICE string = "service"
+
+var odometerSources = []string{ODOMETER_INSPECTION, ODOMETER_SALE, ODOMETER_LEASE_RETURN, ODOMETER_SERVICE}
+
+// Name of the event announcing a suspected odometer rollback
+const ODOMETER_ROLLBACK_EVENT string = "OdometerRollbackSuspected"
+
+/*
+ * Called by an inspection station or the registry, whose readings are trusted as verified.
+ * args: vin, reading JSON e.g. {"km":123456,"source":"service","readingDate":"2019-05-01"}
+ */
+func (s *SmartContract) recordOdometerReading(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	reading := OdometerReading{}
+	if err := json.Unmarshal([]byte(args[1]), &reading); err != nil {
+		return ccutil.InvalidInput("", "Unable to unmarshal input JSON data: "+fmt.Sprint(err)).Response()
+	}
+	recordedBy, err := ccutil.CallerOrganisation(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	reading.Vin = strings.TrimSpace(args[0])
+	reading.RecordedBy = recordedBy
+	reading.RecordedAt = txTime.Format(time.RFC3339)
+	reading.TxId = APIstub.GetTxID()
+	if err = validateOdometerReading(reading, txTime); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	vehicle, found, err := getVehicleForUpdate(APIstub, reading.Vin)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if !found {
+		return ccutil.NotFound("Vehicle " + reading.Vin + " is not in the register").Response()
+	}
+	if err = addOdometerReading(APIstub, &vehicle, reading); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	vehicleAsBytes, err := putVehicle(APIstub, vehicle)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(vehicleAsBytes)
+}
+
+// Returns a JSON array with the vehicle's odometer readings ordered by reading date. args: vin
+func (s *SmartContract) queryOdometerReadings(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	readings, err := getOdometerReadings(APIstub, args[0])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	readingsAsBytes, err := json.Marshal(readings)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	return shim.Success(readingsAsBytes)
+}
+
+// Checks the reading against the log, stores it and keeps the latest verified reading on the vehicle.
+// The caller writes the vehicle.
+func addOdometerReading(APIstub shim.ChaincodeStubInterface, vehicle *Vehicle, reading OdometerReading) error {
+	readings, err := getOdometerReadings(APIstub, reading.Vin)
+	if err != nil {
+		return err
+	}
+	reading.Verified = true
+	for _, earlier := range readings {
+		if !earlier.Verified {
+			continue
+		}
+		if (earlier.ReadingDate <= reading.ReadingDate && earlier.Km > reading.Km) ||
+			(earlier.ReadingDate >= reading.ReadingDate && earlier.Km < reading.Km) {
+			reading.Verified = false
+			reading.RollbackSuspected = true
+		}
+	}
+
+	readingAsBytes, err := schemas.Save(APIstub, "odometer", reading, reading.Vin, reading.ReadingDate, reading.TxId)
+	if err != nil {
+		return err
+	}
+
+	if reading.RollbackSuspected {
+		vehicle.OdometerRollbackSuspected = true
+		return APIstub.SetEvent(ODOMETER_ROLLBACK_EVENT, readingAsBytes)
+	}
+	if vehicle.Odometer == nil || vehicle.Odometer.ReadingDate <= reading.ReadingDate {
+		vehicle.Odometer = &reading
+	}
+	return nil
+}
+
+// Reads the vehicle's odometer readings ordered by reading date
+func getOdometerReadings(APIstub shim.ChaincodeStubInterface, vin string) ([]OdometerReading, error) {
+	records, err := schemas.List(APIstub, "odometer", vin)
+	if err != nil {
+		return nil, err
+	}
+
+	readings := []OdometerReading{}
+	for _, readingAsBytes := range records {
+		reading := OdometerReading{}
+		if err = json.Unmarshal(readingAsBytes, &reading); err != nil {
+			return nil, ccutil.Internal("Unable to unmarshal odometer reading received from the ledger")
+		}
+		readings = append(readings, reading)
+	}
+	return readings, nil
+}
+
+func validateOdometerReading(reading OdometerReading, txTime time.Time) error {
+	if reading.Vin == "" {
+		return ccutil.InvalidInput("vin", "VIN is mandatory")
+	}
+	if reading.Km < 0 {
+		return ccutil.InvalidInput("km", "km must not be negative")
+	}
+	knownSource := false
+	for _, source := range odometerSources {
+		if reading.Source == source {
+			knownSource = true
+		}
+	}
+	if !knownSource {
+		return ccutil.InvalidInput("source", fmt.Sprintf("source must be one of %s", strings.Join(odometerSources, ", ")))
+	}
+	readingDate, err := time.Parse(ccutil.DATE_FORMAT, reading.ReadingDate)
+	if err != nil {
+		return ccutil.InvalidInput("readingDate", "readingDate must be in YYYY-MM-DD format")
+	}
+	if readingDate.After(txTime) {
+		return ccutil.InvalidInput("readingDate", "readingDate can't be in the future")
+	}
+	return nil
+}
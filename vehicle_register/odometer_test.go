@@ -0,0 +1,70 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package vehicle_register_test
+
+import (
+	"testing"
+
+	"github.com/littlemyy/hlexample/vehicle_register"
+)
+
+func TestOdometerReadings(t *testing.T) {
+	s := newScenario(t, "2025-06-01T09:00:00Z")
+	s.registerVehicle("WVW0001", "123ABC")
+
+	s.ok(nil, inspectionStation, "recordOdometerReading", "WVW0001", `{"km":50000,"source":"service","readingDate":"2025-01-10"}`)
+	s.ok(nil, registryAdmin, "recordOdometerReading", "WVW0001", `{"km":60000,"source":"sale","readingDate":"2025-03-10"}`)
+	if vehicle := s.vehicle("WVW0001"); vehicle.Odometer == nil || vehicle.Odometer.Km != 60000 || !vehicle.Odometer.Verified {
+		t.Errorf("got the latest reading %+v, want the verified 60000 km", vehicle.Odometer)
+	}
+
+	result := s.ok(nil, inspectionStation, "recordOdometerReading", "WVW0001", `{"km":40000,"source":"service","readingDate":"2025-05-10"}`)
+	if result.Event == nil || result.Event.EventName != vehicle_register.ODOMETER_ROLLBACK_EVENT {
+		t.Errorf("got the event %v, want %s", result.Event, vehicle_register.ODOMETER_ROLLBACK_EVENT)
+	}
+	vehicle := s.vehicle("WVW0001")
+	if !vehicle.OdometerRollbackSuspected || vehicle.Odometer.Km != 60000 {
+		t.Errorf("got %+v, want the rollback flagged and the 60000 km reading kept", vehicle)
+	}
+
+	readings := []vehicle_register.OdometerReading{}
+	s.ok(&readings, garage, "queryOdometerReadings", "WVW0001")
+	if len(readings) != 3 || readings[2].Verified || !readings[2].RollbackSuspected || readings[0].RecordedBy != "Kadaka" {
+		t.Errorf("got the readings %+v", readings)
+	}
+}
+
+func TestOdometerReadingsAreRestricted(t *testing.T) {
+	s := newScenario(t, "2025-06-01T09:00:00Z")
+	s.registerVehicle("WVW0001", "123ABC")
+
+	s.fails(403, garage, "recordOdometerReading", "WVW0001", `{"km":1000,"source":"service","readingDate":"2025-01-10"}`)
+	s.fails(404, inspectionStation, "recordOdometerReading", "WVW0404", `{"km":1000,"source":"service","readingDate":"2025-01-10"}`)
+	s.fails(400, inspectionStation, "recordOdometerReading", "WVW0001", `{"km":1000,"source":"service","readingDate":"2025-07-01"}`)
+	s.fails(400, inspectionStation, "recordOdometerReading", "WVW0001", `{"km":-1,"source":"service","readingDate":"2025-01-10"}`)
+	s.fails(400, inspectionStation, "recordOdometerReading", "WVW0001", `{"km":1000,"source":"guess","readingDate":"2025-01-10"}`)
+
+	if result := s.ok(nil, registryAdmin, "queryVehicle", "WVW0404"); len(result.Response.Payload) != 0 {
+		t.Errorf("got the vehicle %s, want none", result.Response.Payload)
+	}
+	if vehicle := s.vehicle("WVW0001"); vehicle.Odometer != nil {
+		t.Errorf("got the reading %+v, want none", vehicle.Odometer)
+	}
+}
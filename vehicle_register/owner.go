@@ -0,0 +1,154 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Owners of the vehicles in the register. A vehicle may be owned by natural or legal
+ * persons, jointly with ownership shares.
+ */
+
+package vehicle_register
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/littlemyy/hlexample/ccutil"
+)
+
+// Define the party structure: a natural person identified by personal code,
+// or a legal person identified by company registry code
+type Party struct {
+	Type         string `json:"type"`
+	FirstName    string `json:"firstName,omitempty"`
+	LastName     string `json:"lastName,omitempty"`
+	PersonalCode string `json:"personalCode,omitempty"`
+	Name         string `json:"name,omitempty"`
+	RegistryCode string `json:"registryCode,omitempty"`
+	VatNumber    string `json:"vatNumber,omitempty"`
+	Share        string `json:"share,omitempty"` //ownership share in percent, e.g. "50" or "33.33"
+}
+
+// Party types
+const NATURAL_PERSON string = "natural"
+const LEGAL_PERSON string = "legal"
+
+// Called by a registry admin. args: vin, JSON array of owners whose shares add up to 100
+func (s *SmartContract) setVehicleOwners(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	owners := []Party{}
+	if err := json.Unmarshal([]byte(args[1]), &owners); err != nil {
+		return ccutil.InvalidInput("", "Unable to unmarshal input JSON data: "+fmt.Sprint(err)).Response()
+	}
+	if len(owners) == 1 && owners[0].Share == "" {
+		owners[0].Share = "100"
+	}
+	if err := validateOwners(owners); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	vehicle, found, err := getVehicleForUpdate(APIstub, strings.TrimSpace(args[0]))
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if !found {
+		return ccutil.NotFound("Vehicle " + args[0] + " is not in the register").Response()
+	}
+	vehicle.Owners = owners
+
+	vehicleAsBytes, err := putVehicle(APIstub, vehicle)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(vehicleAsBytes)
+}
+
+func validateOwners(owners []Party) error {
+	if len(owners) == 0 {
+		return ccutil.InvalidInput("owners", "At least one owner is mandatory")
+	}
+	seen := map[string]bool{}
+	var total int64
+	for _, owner := range owners {
+		if err := validateParty(owner); err != nil {
+			return err
+		}
+		if seen[partyId(owner)] {
+			return ccutil.InvalidInput("owners", fmt.Sprintf("Owner %s is listed twice", partyId(owner)))
+		}
+		seen[partyId(owner)] = true
+		share, err := parseShare(owner.Share)
+		if err != nil {
+			return err
+		}
+		total += share
+	}
+	if total != 10000 {
+		return ccutil.InvalidInput("share", "Ownership shares must add up to 100")
+	}
+	return nil
+}
+
+func validateParty(party Party) error {
+	switch party.Type {
+	case NATURAL_PERSON:
+		if strings.TrimSpace(party.PersonalCode) == "" {
+			return ccutil.InvalidInput("personalCode", "personalCode is mandatory for a natural person")
+		}
+	case LEGAL_PERSON:
+		if strings.TrimSpace(party.RegistryCode) == "" || strings.TrimSpace(party.Name) == "" {
+			return ccutil.InvalidInput("", "name and registryCode are mandatory for a legal person")
+		}
+	default:
+		return ccutil.InvalidInput("type", fmt.Sprintf("Party type must be %s or %s", NATURAL_PERSON, LEGAL_PERSON))
+	}
+	return nil
+}
+
+// Natural persons are identified by their personal code, legal persons by their registry code
+func partyId(party Party) string {
+	if party.Type == LEGAL_PERSON {
+		return party.RegistryCode
+	}
+	return party.PersonalCode
+}
+
+// Parses a percent share with at most two decimals into hundredths of a percent
+func parseShare(share string) (int64, error) {
+	parts := strings.SplitN(strings.TrimSpace(share), ".", 2)
+	if len(parts) == 2 {
+		if len(parts[1]) == 0 || len(parts[1]) > 2 {
+			return 0, ccutil.InvalidInput("share", fmt.Sprintf("Invalid share %s", share))
+		}
+		parts[1] = (parts[1] + "0")[:2]
+	} else {
+		parts = append(parts, "00")
+	}
+	value, err := strconv.ParseUint(parts[0]+parts[1], 10, 32)
+	if err != nil {
+		return 0, ccutil.InvalidInput("share", fmt.Sprintf("Invalid share %s", share))
+	}
+	if value == 0 || value > 10000 {
+		return 0, ccutil.InvalidInput("share", fmt.Sprintf("Share %s must be between 0 and 100", share))
+	}
+	return int64(value), nil
+}
@@ -0,0 +1,282 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Registration plates of the vehicle register. Every plate has a record with the VIN
+ * it is currently assigned to and the history of its assignments, so a plate always
+ * resolves to at most one active vehicle.
+ */
+
+package vehicle_register
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/littlemyy/hlexample/ccutil"
+)
+
+// Define the registration plate structure
+type Plate struct {
+	Plate   string            `json:"plate"`
+	Vin     string            `json:"vin,omitempty"` //empty while the plate is unassigned
+	History []PlateAssignment `json:"history"`
+}
+
+// One assignment of a plate to a vehicle
+type PlateAssignment struct {
+	Vin  string `json:"vin"`
+	From string `json:"from"`
+	To   string `json:"to,omitempty"`
+	TxId string `json:"txId"`
+}
+
+/*
+ * Called by a registry admin. args: vehicle JSON e.g.
+ * {"vin":"78347837483784","mark":"Audi","model":"A8","registrationPlate":"123ABC"}
+ * Completes a vehicle already known by its VIN (e.g. from a stolen report) as long as it has no plate.
+ */
+func (s *SmartContract) registerVehicle(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	vehicleIn := Vehicle{}
+	if err := json.Unmarshal([]byte(args[0]), &vehicleIn); err != nil {
+		return ccutil.InvalidInput("", "Unable to unmarshal input JSON data: "+fmt.Sprint(err)).Response()
+	}
+	vin := strings.TrimSpace(vehicleIn.Vin)
+	if vin == "" {
+		return ccutil.InvalidInput("vin", "VIN is mandatory").Response()
+	}
+
+	vehicle, found, err := getVehicleForUpdate(APIstub, vin)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if !found {
+		vehicle = Vehicle{Vin: vin}
+	}
+	if vehicle.RegistrationPlate != "" {
+		return ccutil.Conflict("Vehicle " + vin + " is already registered with plate " + vehicle.RegistrationPlate + ", use reassignPlate to change it").Response()
+	}
+	vehicle.Mark = vehicleIn.Mark
+	vehicle.Model = vehicleIn.Model
+
+	if plate := normalizePlate(vehicleIn.RegistrationPlate); plate != "" {
+		txTime, err := ccutil.TxTime(APIstub)
+		if err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+		if err = assignPlate(APIstub, &vehicle, plate, txTime); err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+	}
+
+	vehicleAsBytes, err := putVehicle(APIstub, vehicle)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(vehicleAsBytes)
+}
+
+/*
+ * Moves a personalised plate to another vehicle. Called by a registry admin.
+ * args: plate, vin of the receiving vehicle and optionally a replacement plate for the vehicle giving the plate up
+ * The receiving vehicle's own plate, if any, becomes unassigned.
+ */
+func (s *SmartContract) reassignPlate(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	plate := normalizePlate(args[0])
+	vin := strings.TrimSpace(args[1])
+
+	record, found, err := getPlate(APIstub, plate)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if !found || record.Vin == "" {
+		return ccutil.NotFound("Plate " + plate + " is not assigned to any vehicle").Response()
+	}
+	if record.Vin == vin {
+		return ccutil.Conflict("Plate " + plate + " is already assigned to " + vin).Response()
+	}
+
+	target, found, err := getVehicleForUpdate(APIstub, vin)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if !found {
+		return ccutil.NotFound("Vehicle " + vin + " is not in the register").Response()
+	}
+	source, _, err := getVehicleForUpdate(APIstub, record.Vin)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	replacement := ""
+	if len(args) == 3 {
+		replacement = normalizePlate(args[2])
+		if replacement == plate {
+			return ccutil.InvalidInput("replacementPlate", "Replacement plate is the plate being reassigned").Response()
+		}
+	}
+
+	// plate records are read from the committed state, so each one is read and written once here
+	now := txTime.Format(time.RFC3339)
+	source.RegistrationPlate = ""
+	if replacement != "" && replacement == target.RegistrationPlate {
+		// the vehicles swap their plates
+		swapped, _, err := getPlate(APIstub, replacement)
+		if err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+		if swapped.Vin != target.Vin {
+			return ccutil.Conflict("Plate " + replacement + " is not assigned to " + target.Vin).Response()
+		}
+		swapped.History[len(swapped.History)-1].To = now
+		swapped.History = append(swapped.History, PlateAssignment{Vin: source.Vin, From: now, TxId: APIstub.GetTxID()})
+		swapped.Vin = source.Vin
+		source.RegistrationPlate = replacement
+		if err = putPlate(APIstub, swapped); err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+	} else {
+		if target.RegistrationPlate != "" {
+			if err = releasePlate(APIstub, &target, txTime); err != nil {
+				return ccutil.ErrorResponse(err)
+			}
+		}
+		if replacement != "" {
+			if err = assignPlate(APIstub, &source, replacement, txTime); err != nil {
+				return ccutil.ErrorResponse(err)
+			}
+		}
+	}
+
+	target.RegistrationPlate = plate
+	record.History[len(record.History)-1].To = now
+	record.History = append(record.History, PlateAssignment{Vin: vin, From: now, TxId: APIstub.GetTxID()})
+	record.Vin = vin
+	if err = putPlate(APIstub, record); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	if _, err = putVehicle(APIstub, source); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	vehicleAsBytes, err := putVehicle(APIstub, target)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(vehicleAsBytes)
+}
+
+// Returns the vehicle the plate is currently assigned to. args: plate
+func (s *SmartContract) queryVehicleByPlate(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	record, found, err := getPlate(APIstub, normalizePlate(args[0]))
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if !found || record.Vin == "" {
+		return ccutil.NotFound("Plate " + args[0] + " is not assigned to any vehicle").Response()
+	}
+	return s.queryVehicle(APIstub, []string{record.Vin})
+}
+
+// Returns the plate with its assignment history. args: plate
+func (s *SmartContract) queryPlateHistory(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	plateAsBytes, err := schemas.Get(APIstub, "plate", normalizePlate(args[0]))
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if plateAsBytes == nil {
+		return ccutil.NotFound("Couldn't find the plate " + args[0]).Response()
+	}
+	return shim.Success(plateAsBytes)
+}
+
+// Assigns a free plate to the vehicle. The caller writes the vehicle.
+func assignPlate(APIstub shim.ChaincodeStubInterface, vehicle *Vehicle, plate string, txTime time.Time) error {
+	record, found, err := getPlate(APIstub, plate)
+	if err != nil {
+		return err
+	}
+	if !found {
+		record = Plate{Plate: plate}
+	}
+	if record.Vin != "" {
+		return ccutil.Conflict(fmt.Sprintf("Plate %s is already assigned to %s", plate, record.Vin))
+	}
+	record.Vin = vehicle.Vin
+	record.History = append(record.History, PlateAssignment{Vin: vehicle.Vin, From: txTime.Format(time.RFC3339), TxId: APIstub.GetTxID()})
+	vehicle.RegistrationPlate = plate
+	return putPlate(APIstub, record)
+}
+
+// Takes the vehicle's plate off it, leaving the plate free. The caller writes the vehicle.
+func releasePlate(APIstub shim.ChaincodeStubInterface, vehicle *Vehicle, txTime time.Time) error {
+	record, found, err := getPlate(APIstub, vehicle.RegistrationPlate)
+	if err != nil {
+		return err
+	}
+	vehicle.RegistrationPlate = ""
+	if !found || record.Vin != vehicle.Vin {
+		return nil
+	}
+	record.Vin = ""
+	record.History[len(record.History)-1].To = txTime.Format(time.RFC3339)
+	return putPlate(APIstub, record)
+}
+
+func getPlate(APIstub shim.ChaincodeStubInterface, plate string) (record Plate, found bool, err error) {
+	if plate == "" {
+		return record, false, ccutil.InvalidInput("plate", "Plate is mandatory")
+	}
+	plateAsBytes, err := schemas.Get(APIstub, "plate", plate)
+	if err != nil {
+		return record, false, err
+	}
+	if plateAsBytes == nil {
+		return record, false, nil
+	}
+	if err = json.Unmarshal(plateAsBytes, &record); err != nil {
+		return record, false, ccutil.Internal("Unable to unmarshal plate data received from the ledger")
+	}
+	return record, true, nil
+}
+
+func putPlate(APIstub shim.ChaincodeStubInterface, record Plate) error {
+	_, err := schemas.Save(APIstub, "plate", record, record.Plate)
+	return err
+}
+
+// Plates are kept upper case without spaces or dashes, so "123 abc" and "123ABC" are the same plate
+func normalizePlate(plate string) string {
+	plate = strings.ToUpper(plate)
+	plate = strings.Replace(plate, " ", "", -1)
+	return strings.Replace(plate, "-", "", -1)
+}
@@ -0,0 +1,97 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package vehicle_register_test
+
+import (
+	"testing"
+
+	"github.com/littlemyy/hlexample/vehicle_register"
+)
+
+func TestRegisterVehicleWithPlate(t *testing.T) {
+	s := newScenario(t, "2025-01-10T09:00:00Z")
+	if vehicle := s.registerVehicle("WVW0001", "123 abc"); vehicle.RegistrationPlate != "123ABC" {
+		t.Errorf("got the plate %s, want 123ABC", vehicle.RegistrationPlate)
+	}
+
+	s.fails(409, registryAdmin, "registerVehicle", `{"vin":"WVW0002","registrationPlate":"123-ABC"}`)
+	s.fails(409, registryAdmin, "registerVehicle", `{"vin":"WVW0001","registrationPlate":"456DEF"}`)
+	s.fails(403, garage, "registerVehicle", `{"vin":"WVW0003","registrationPlate":"789GHI"}`)
+
+	vehicle := vehicle_register.Vehicle{}
+	s.ok(&vehicle, garage, "queryVehicleByPlate", "123-abc")
+	if vehicle.Vin != "WVW0001" {
+		t.Errorf("got the vehicle %s, want WVW0001", vehicle.Vin)
+	}
+	s.fails(404, garage, "queryVehicleByPlate", "000AAA")
+}
+
+func TestReassignPlate(t *testing.T) {
+	s := newScenario(t, "2025-01-10T09:00:00Z")
+	s.registerVehicle("WVW0001", "PERSON1")
+	s.registerVehicle("WVW0002", "222BBB")
+
+	s.at("2025-02-01T09:00:00Z")
+	s.fails(403, garage, "reassignPlate", "PERSON1", "WVW0002")
+	s.fails(404, registryAdmin, "reassignPlate", "PERSON1", "WVW0404")
+	s.fails(409, registryAdmin, "reassignPlate", "PERSON1", "WVW0001")
+	s.fails(400, registryAdmin, "reassignPlate", "PERSON1", "WVW0002", "PERSON1")
+	s.ok(nil, registryAdmin, "reassignPlate", "PERSON1", "WVW0002", "111AAA")
+
+	if vehicle := s.vehicle("WVW0002"); vehicle.RegistrationPlate != "PERSON1" {
+		t.Errorf("got the plate %s on WVW0002, want PERSON1", vehicle.RegistrationPlate)
+	}
+	if vehicle := s.vehicle("WVW0001"); vehicle.RegistrationPlate != "111AAA" {
+		t.Errorf("got the plate %s on WVW0001, want the replacement 111AAA", vehicle.RegistrationPlate)
+	}
+
+	plate := vehicle_register.Plate{}
+	s.ok(&plate, garage, "queryPlateHistory", "PERSON1")
+	if plate.Vin != "WVW0002" || len(plate.History) != 2 ||
+		plate.History[0] != (vehicle_register.PlateAssignment{Vin: "WVW0001", From: "2025-01-10T09:00:00Z", To: "2025-02-01T09:00:00Z", TxId: plate.History[0].TxId}) ||
+		plate.History[1].Vin != "WVW0002" || plate.History[1].To != "" {
+		t.Errorf("got the plate %+v", plate)
+	}
+	released := vehicle_register.Plate{}
+	s.ok(&released, garage, "queryPlateHistory", "222BBB")
+	if released.Vin != "" || released.History[0].To != "2025-02-01T09:00:00Z" {
+		t.Errorf("got the plate %+v, want it unassigned", released)
+	}
+	s.fails(404, garage, "queryPlateHistory", "000AAA")
+}
+
+func TestSwapPlates(t *testing.T) {
+	s := newScenario(t, "2025-01-10T09:00:00Z")
+	s.registerVehicle("WVW0001", "PERSON1")
+	s.registerVehicle("WVW0002", "222BBB")
+
+	s.ok(nil, registryAdmin, "reassignPlate", "PERSON1", "WVW0002", "222BBB")
+	if vehicle := s.vehicle("WVW0001"); vehicle.RegistrationPlate != "222BBB" {
+		t.Errorf("got the plate %s on WVW0001, want 222BBB", vehicle.RegistrationPlate)
+	}
+	if vehicle := s.vehicle("WVW0002"); vehicle.RegistrationPlate != "PERSON1" {
+		t.Errorf("got the plate %s on WVW0002, want PERSON1", vehicle.RegistrationPlate)
+	}
+	vehicle := vehicle_register.Vehicle{}
+	s.ok(&vehicle, garage, "queryVehicleByPlate", "222BBB")
+	if vehicle.Vin != "WVW0001" {
+		t.Errorf("got the plate 222BBB on %s, want WVW0001", vehicle.Vin)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Scenario tests run the contracts on an in-memory devledger, at the time the test sets.
+ */
+
+package vehicle_register_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/littlemyy/hlexample/contracts"
+	"github.com/littlemyy/hlexample/devledger"
+	"github.com/littlemyy/hlexample/vehicle_register"
+)
+
+var registryAdmin = devledger.Identity{MspId: "ARKMSP", User: "carol", Attrs: map[string]string{"role": "registry_admin"}}
+var inspectionStation = devledger.Identity{MspId: "KadakaMSP", User: "dave", Attrs: map[string]string{"role": "inspection_station"}}
+var garage = devledger.Identity{MspId: "GarageMSP", User: "erin"}
+
+type scenario struct {
+	t      *testing.T
+	ledger *devledger.Ledger
+	now    time.Time
+}
+
+func newScenario(t *testing.T, now string) *scenario {
+	s := &scenario{t: t, ledger: contracts.Register(devledger.New())}
+	s.at(now)
+	s.ledger.Now = func() time.Time { return s.now }
+	return s
+}
+
+// at sets the time of the next transactions, RFC3339
+func (s *scenario) at(now string) {
+	var err error
+	if s.now, err = time.Parse(time.RFC3339, now); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func (s *scenario) invoke(identity devledger.Identity, args ...string) *devledger.Result {
+	result, err := s.ledger.Invoke(identity, contracts.VEHICLE_REGISTER, args...)
+	if err != nil {
+		s.t.Fatalf("%v: %s", args, err)
+	}
+	return result
+}
+
+// ok invokes the function, fails the test unless it succeeds, and unmarshals the payload into out if given
+func (s *scenario) ok(out interface{}, identity devledger.Identity, args ...string) *devledger.Result {
+	result := s.invoke(identity, args...)
+	if result.Response.Status != 200 {
+		s.t.Fatalf("%v: %d %s", args, result.Response.Status, result.Response.Message)
+	}
+	if out != nil {
+		if err := json.Unmarshal(result.Response.Payload, out); err != nil {
+			s.t.Fatalf("%v: %s", args, err)
+		}
+	}
+	return result
+}
+
+// fails invokes the function and checks it fails with the status
+func (s *scenario) fails(status int32, identity devledger.Identity, args ...string) {
+	s.t.Helper()
+	result := s.invoke(identity, args...)
+	if result.Response.Status != status {
+		s.t.Errorf("%v: got %d %s, want %d", args, result.Response.Status, result.Response.Message, status)
+	}
+}
+
+// registerVehicle registers the VIN with the plate
+func (s *scenario) registerVehicle(vin string, plate string) vehicle_register.Vehicle {
+	vehicle := vehicle_register.Vehicle{}
+	s.ok(&vehicle, registryAdmin, "registerVehicle", `{"vin":"`+vin+`","mark":"VW","model":"Golf","registrationPlate":"`+plate+`"}`)
+	return vehicle
+}
+
+func (s *scenario) vehicle(vin string) vehicle_register.Vehicle {
+	vehicle := vehicle_register.Vehicle{}
+	s.ok(&vehicle, registryAdmin, "queryVehicle", vin)
+	return vehicle
+}
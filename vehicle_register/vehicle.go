@@ -0,0 +1,210 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Vehicle records of the vehicle register, keyed by VIN
+ */
+
+package vehicle_register
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/littlemyy/hlexample/ccutil"
+	"github.com/littlemyy/hlexample/fixtures"
+)
+
+// Define the vehicle structure. Structure tags match the vehicle in the sale application contract.
+type Vehicle struct {
+	Vin                       string             `json:"vin"`
+	Mark                      string             `json:"mark,omitempty"`
+	Model                     string             `json:"model,omitempty"`
+	RegistrationPlate         string             `json:"registrationPlate,omitempty"`
+	Stolen                    bool               `json:"stolen" metadata:"readOnly"`
+	StolenFlags               []StolenFlagChange `json:"stolenFlags,omitempty" metadata:"readOnly"`
+	Odometer                  *OdometerReading   `json:"odometer,omitempty" metadata:"readOnly"` //latest verified reading
+	OdometerRollbackSuspected bool               `json:"odometerRollbackSuspected,omitempty" metadata:"readOnly"`
+	Inspection                *Inspection        `json:"inspection,omitempty" metadata:"readOnly"` //latest technical inspection
+	Deregistration            *Deregistration    `json:"deregistration,omitempty" metadata:"readOnly"`
+	Owners                    []Party            `json:"owners,omitempty" metadata:"readOnly"`
+}
+
+// One stolen or recovered report
+type StolenFlagChange struct {
+	Stolen     bool   `json:"stolen"`
+	Date       string `json:"date"`
+	ReportedBy string `json:"reportedBy"`
+	TxId       string `json:"txId"`
+	Note       string `json:"note,omitempty"`
+}
+
+// Roles known to the register, carried in the caller's role certificate attribute
+const POLICE_ROLE string = "police"
+const REGISTRY_ADMIN_ROLE string = "registry_admin"
+
+// Name of the event announcing a change of the stolen flag
+const STOLEN_FLAG_EVENT string = "VehicleStolenFlagChanged"
+
+// Returns the vehicle, or an empty payload when the VIN isn't in the register. args: vin
+func (s *SmartContract) queryVehicle(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	vehicleAsBytes, err := schemas.Get(APIstub, "vehicle", args[0])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	return shim.Success(vehicleAsBytes)
+}
+
+// Called by police or a registry admin. args: vin, note
+func (s *SmartContract) reportStolen(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	return s.changeStolenFlag(APIstub, args[0], true, args[1])
+}
+
+// Called by police or a registry admin. args: vin, note
+func (s *SmartContract) reportRecovered(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	return s.changeStolenFlag(APIstub, args[0], false, args[1])
+}
+
+// Sets or clears the stolen flag, records the report and announces the change
+func (s *SmartContract) changeStolenFlag(APIstub shim.ChaincodeStubInterface, vin string, stolen bool, note string) sc.Response {
+	fmt.Println("running changeStolenFlag: " + vin)
+
+	vin = strings.TrimSpace(vin)
+	if vin == "" {
+		return ccutil.InvalidInput("vin", "VIN is mandatory").Response()
+	}
+	role, err := ccutil.AssertRole(APIstub, POLICE_ROLE, REGISTRY_ADMIN_ROLE)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	vehicle, found, err := getVehicleForUpdate(APIstub, vin)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if !found {
+		if !stolen {
+			return ccutil.Conflict("Vehicle " + vin + " is not reported stolen").Response()
+		}
+		// a stolen VIN is flagged even if the vehicle isn't in the register yet
+		vehicle = Vehicle{Vin: vin}
+	}
+	if vehicle.Stolen == stolen {
+		if stolen {
+			return ccutil.Conflict("Vehicle " + vin + " is already reported stolen").Response()
+		}
+		return ccutil.Conflict("Vehicle " + vin + " is not reported stolen").Response()
+	}
+
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	change := StolenFlagChange{Stolen: stolen, Date: txTime.Format(time.RFC3339), ReportedBy: role, TxId: APIstub.GetTxID(), Note: note}
+	vehicle.Stolen = stolen
+	vehicle.StolenFlags = append(vehicle.StolenFlags, change)
+
+	vehicleAsBytes, err := putVehicle(APIstub, vehicle)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	eventAsBytes, err := json.Marshal(struct {
+		Vin string `json:"vin"`
+		StolenFlagChange
+	}{vin, change})
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	if err = APIstub.SetEvent(STOLEN_FLAG_EVENT, eventAsBytes); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	return shim.Success(vehicleAsBytes)
+}
+
+// Reads the vehicle, found is false when the VIN isn't in the register
+func getVehicle(APIstub shim.ChaincodeStubInterface, vin string) (vehicle Vehicle, found bool, err error) {
+	vehicleAsBytes, err := schemas.Get(APIstub, "vehicle", vin)
+	if err != nil {
+		return vehicle, false, err
+	}
+	if vehicleAsBytes == nil {
+		return vehicle, false, nil
+	}
+	if err = json.Unmarshal(vehicleAsBytes, &vehicle); err != nil {
+		return vehicle, false, ccutil.Internal("Unable to unmarshal vehicle data received from the ledger")
+	}
+	return vehicle, true, nil
+}
+
+// Reads a vehicle that is going to be changed, deregistered vehicles are read-only
+func getVehicleForUpdate(APIstub shim.ChaincodeStubInterface, vin string) (vehicle Vehicle, found bool, err error) {
+	vehicle, found, err = getVehicle(APIstub, vin)
+	if err == nil && vehicle.Deregistration != nil {
+		err = ccutil.Conflict(fmt.Sprintf("Vehicle %s was deregistered (%s) on %s", vin, vehicle.Deregistration.Type, vehicle.Deregistration.Date))
+	}
+	return vehicle, found, err
+}
+
+// Writes the vehicle and returns the stored JSON
+func putVehicle(APIstub shim.ChaincodeStubInterface, vehicle Vehicle) ([]byte, error) {
+	return schemas.Save(APIstub, "vehicle", vehicle, vehicle.Vin)
+}
+
+/*
+ * Registers generated vehicles with their plates and owners, see package fixtures. Vehicles
+ * already in the register are left as they are. args: seed, optionally count
+ */
+func (s *SmartContract) generateTestData(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	generated, err := fixtures.FromArgs(args)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+	txTime, err := ccutil.TxTime(APIstub)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
+
+	for _, generatedVehicle := range generated.Vehicles {
+		_, found, err := getVehicle(APIstub, generatedVehicle.Vin)
+		if err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+		if found {
+			continue
+		}
+		owner := generatedVehicle.Owner
+		vehicle := Vehicle{Vin: generatedVehicle.Vin, Mark: generatedVehicle.Mark, Model: generatedVehicle.Model,
+			Owners: []Party{{Type: NATURAL_PERSON, FirstName: owner.FirstName, LastName: owner.LastName, PersonalCode: owner.PersonalCode, Share: "100"}}}
+		if err = assignPlate(APIstub, &vehicle, generatedVehicle.RegistrationPlate, txTime); err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+		if _, err = putVehicle(APIstub, vehicle); err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+	}
+
+	return shim.Success(nil)
+}
@@ -22,19 +22,19 @@
  * Writing Your First Blockchain Application
  */
 
-package main
+package vehicle_register
 
 /* Imports
- * 4 utility libraries for formatting, handling bytes, reading and writing JSON, and string manipulation
+ * 3 utility libraries for formatting, handling bytes, and reading and writing JSON
  * 2 specific Hyperledger Fabric specific libraries for Smart Contracts
  */
 import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"strconv"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/littlemyy/hlexample/ccutil"
 	sc "github.com/hyperledger/fabric/protos/peer"
 )
 
@@ -50,6 +50,12 @@ type LeaseAsset struct {
 	Leaser  string `json:"leaser"`
 }
 
+// An asset with its key, as createAsset and initLedger return it
+type KeyedAsset struct {
+	Key    string          `json:"Key"`
+	Record json.RawMessage `json:"Record"`
+}
+
 /*
  * The Init method is called when the Smart Contract "lyl" is instantiated by the blockchain network
  * Best practice is to have any Ledger initialization in separate function -- see initLedger()
@@ -63,36 +69,211 @@ func (s *SmartContract) Init(APIstub shim.ChaincodeStubInterface) sc.Response {
  * The calling application program has also specified the particular smart contract function to be called, with arguments
  */
 func (s *SmartContract) Invoke(APIstub shim.ChaincodeStubInterface) sc.Response {
+	return s.routes().Invoke(APIstub)
+}
 
-	// Retrieve the requested Smart Contract function and arguments
-	function, args := APIstub.GetFunctionAndParameters()
-	// Route to the appropriate handler function to interact with the ledger appropriately
-	if function == "queryAsset" {
-		return s.queryAsset(APIstub, args)
-	} else if function == "initLedger" {
-		return s.initLedger(APIstub)
-	} else if function == "createAsset" {
-		return s.createAsset(APIstub, args)
-	} else if function == "queryAllAssets" {
-		return s.queryAllAssets(APIstub)
-	} else if function == "changeLeaser" {
-		return s.changeLeaser(APIstub, args)
-	}
+// Name and version published by getMetadata
+const CONTRACT_NAME string = "vehicle_register"
+const CONTRACT_VERSION string = "1.0"
+
+// Generated asset keys start with the prefix, see ccutil.NewID
+const ASSET_ID_PREFIX string = "AST"
+
+// Stored records with their current schema versions, simple keys under ""
+var schemas = ccutil.Schemas{
+	"":           {MovedTo: "asset"},
+	"asset":      {DocType: "leaseAsset", Version: 1, Type: LeaseAsset{}},
+	"vehicle":    {DocType: "vehicle", Version: 1, Type: Vehicle{}},
+	"plate":      {DocType: "plate", Version: 1, Type: Plate{}},
+	"lien":       {DocType: "lien", Version: 1, Type: Lien{}},
+	"odometer":   {DocType: "odometerReading", Version: 1, Type: OdometerReading{}},
+	"inspection": {DocType: "inspection", Version: 1, Type: Inspection{}},
+}
 
-	return shim.Error("Invalid Smart Contract function name.")
+/*
+ * The contract's functions with their arguments. Invoke routes every call through this table.
+ */
+func (s *SmartContract) routes() *ccutil.Router {
+	return ccutil.NewRouter().
+		WithMetadata(CONTRACT_NAME, CONTRACT_VERSION).
+		WithSnapshots(CONTRACT_NAME, CONTRACT_VERSION, schemas).
+		WithSchemas(schemas).
+		Add(ccutil.Route{Function: "queryAsset", Handler: s.queryAsset,
+			Description: "Returns the lease asset",
+			Returns: LeaseAsset{},
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+			}}).
+		Add(ccutil.Route{Function: "initLedger", Handler: s.initLedger,
+			Description: "Writes the sample lease assets under generated keys",
+			Returns: []KeyedAsset{}}).
+		Add(ccutil.Route{Function: "generateTestData", Handler: s.generateTestData,
+			Description: "Registers generated vehicles with their plates and owners, the same seed and count give matching data in every contract",
+			DevOnly: true,
+			Args: []ccutil.Arg{
+				{Name: "seed", Type: ccutil.STRING_ARG, Description: "Seed of the generator, an integer"},
+				{Name: "count", Type: ccutil.STRING_ARG, Optional: true, Description: "Number of vehicles, 1 to 500, 10 by default"},
+			}}).
+		Add(ccutil.Route{Function: "createAsset", Handler: s.createAsset,
+			Description: "Creates a lease asset under a generated key",
+			Returns: KeyedAsset{},
+			Args: []ccutil.Arg{
+				{Name: "serial", Type: ccutil.STRING_ARG, Description: "Serial number"},
+				{Name: "make", Type: ccutil.STRING_ARG, Description: "Make"},
+				{Name: "model", Type: ccutil.STRING_ARG, Description: "Model"},
+				{Name: "leaser", Type: ccutil.STRING_ARG, Description: "Leasing company owning the asset"},
+			}}).
+		Add(ccutil.Route{Function: "queryAllAssets", Handler: s.queryAllAssets,
+			Description: "Returns all lease assets"}).
+		Add(ccutil.Route{Function: "changeLeaser", Handler: s.changeLeaser,
+			Description: "Moves the asset to another leaser",
+			Args: []ccutil.Arg{
+				{Name: "assetKey", Type: ccutil.STRING_ARG, Description: "Key of the lease asset"},
+				{Name: "leaser", Type: ccutil.STRING_ARG, Description: "New leaser"},
+			}}).
+		Add(ccutil.Route{Function: "registerLien", Handler: s.registerLien,
+			Description: "Registers a lien of the calling organisation on the vehicle",
+			Returns: Lien{},
+			Args: []ccutil.Arg{
+				{Name: "vin", Type: ccutil.STRING_ARG, Description: "Vehicle's VIN"},
+				{Name: "amount", Type: ccutil.STRING_ARG, Description: "Secured amount, a positive decimal"},
+			},
+			Roles: []string{LIENHOLDER_ROLE}}).
+		Add(ccutil.Route{Function: "releaseLien", Handler: s.releaseLien,
+			Description: "Releases a lien held by the calling organisation",
+			Returns: Lien{},
+			Args: []ccutil.Arg{
+				{Name: "vin", Type: ccutil.STRING_ARG, Description: "Vehicle's VIN"},
+				{Name: "lienId", Type: ccutil.STRING_ARG, Description: "Lien id"},
+			}}).
+		Add(ccutil.Route{Function: "queryLiens", Handler: s.queryLiens,
+			Description: "Returns all liens registered on the vehicle",
+			Returns: []Lien{},
+			Args: []ccutil.Arg{
+				{Name: "vin", Type: ccutil.STRING_ARG, Description: "Vehicle's VIN"},
+			}}).
+		Add(ccutil.Route{Function: "queryVehicle", Handler: s.queryVehicle,
+			Description: "Returns the vehicle, or an empty payload when the VIN is not in the register",
+			Returns: Vehicle{},
+			Args: []ccutil.Arg{
+				{Name: "vin", Type: ccutil.STRING_ARG, Description: "Vehicle's VIN"},
+			}}).
+		Add(ccutil.Route{Function: "reportStolen", Handler: s.reportStolen,
+			Description: "Flags the vehicle as stolen",
+			Returns: Vehicle{},
+			Args: []ccutil.Arg{
+				{Name: "vin", Type: ccutil.STRING_ARG, Description: "Vehicle's VIN"},
+				{Name: "note", Type: ccutil.STRING_ARG, Description: "Note recorded with the report"},
+			},
+			Roles: []string{POLICE_ROLE, REGISTRY_ADMIN_ROLE}}).
+		Add(ccutil.Route{Function: "reportRecovered", Handler: s.reportRecovered,
+			Description: "Clears the stolen flag of the vehicle",
+			Returns: Vehicle{},
+			Args: []ccutil.Arg{
+				{Name: "vin", Type: ccutil.STRING_ARG, Description: "Vehicle's VIN"},
+				{Name: "note", Type: ccutil.STRING_ARG, Description: "Note recorded with the report"},
+			},
+			Roles: []string{POLICE_ROLE, REGISTRY_ADMIN_ROLE}}).
+		Add(ccutil.Route{Function: "recordOdometerReading", Handler: s.recordOdometerReading,
+			Description: "Records an odometer reading of the vehicle",
+			Returns: Vehicle{},
+			Args: []ccutil.Arg{
+				{Name: "vin", Type: ccutil.STRING_ARG, Description: "Vehicle's VIN"},
+				{Name: "reading", Type: ccutil.JSON_ARG, Description: "Odometer reading", Schema: OdometerReading{}},
+			},
+			Roles: []string{INSPECTION_STATION_ROLE, REGISTRY_ADMIN_ROLE}}).
+		Add(ccutil.Route{Function: "queryOdometerReadings", Handler: s.queryOdometerReadings,
+			Description: "Returns the odometer readings of the vehicle",
+			Returns: []OdometerReading{},
+			Args: []ccutil.Arg{
+				{Name: "vin", Type: ccutil.STRING_ARG, Description: "Vehicle's VIN"},
+			}}).
+		Add(ccutil.Route{Function: "recordInspection", Handler: s.recordInspection,
+			Description: "Records a technical inspection of the vehicle",
+			Returns: Vehicle{},
+			Args: []ccutil.Arg{
+				{Name: "vin", Type: ccutil.STRING_ARG, Description: "Vehicle's VIN"},
+				{Name: "inspection", Type: ccutil.JSON_ARG, Description: "Inspection", Schema: Inspection{}},
+			},
+			Roles: []string{INSPECTION_STATION_ROLE}}).
+		Add(ccutil.Route{Function: "queryInspections", Handler: s.queryInspections,
+			Description: "Returns the technical inspections of the vehicle",
+			Returns: []Inspection{},
+			Args: []ccutil.Arg{
+				{Name: "vin", Type: ccutil.STRING_ARG, Description: "Vehicle's VIN"},
+			}}).
+		Add(ccutil.Route{Function: "registerVehicle", Handler: s.registerVehicle,
+			Description: "Registers the vehicle with its plate",
+			Returns: Vehicle{},
+			Args: []ccutil.Arg{
+				{Name: "vehicle", Type: ccutil.JSON_ARG, Description: "Vehicle with vin, mark, model and registrationPlate", Schema: Vehicle{}},
+			},
+			Roles: []string{REGISTRY_ADMIN_ROLE}}).
+		Add(ccutil.Route{Function: "reassignPlate", Handler: s.reassignPlate,
+			Description: "Moves a personalised plate to another vehicle",
+			Returns: Vehicle{},
+			Args: []ccutil.Arg{
+				{Name: "plate", Type: ccutil.STRING_ARG, Description: "Plate being moved"},
+				{Name: "vin", Type: ccutil.STRING_ARG, Description: "VIN of the receiving vehicle"},
+				{Name: "replacementPlate", Type: ccutil.STRING_ARG, Optional: true, Description: "New plate for the vehicle giving the plate up"},
+			},
+			Roles: []string{REGISTRY_ADMIN_ROLE}}).
+		Add(ccutil.Route{Function: "queryVehicleByPlate", Handler: s.queryVehicleByPlate,
+			Description: "Returns the vehicle the plate is assigned to",
+			Returns: Vehicle{},
+			Args: []ccutil.Arg{
+				{Name: "plate", Type: ccutil.STRING_ARG, Description: "Registration plate"},
+			}}).
+		Add(ccutil.Route{Function: "queryPlateHistory", Handler: s.queryPlateHistory,
+			Description: "Returns the plate with its assignment history",
+			Returns: Plate{},
+			Args: []ccutil.Arg{
+				{Name: "plate", Type: ccutil.STRING_ARG, Description: "Registration plate"},
+			}}).
+		Add(ccutil.Route{Function: "scrapVehicle", Handler: s.scrapVehicle,
+			Description: "Deregisters the vehicle as scrapped",
+			Returns: Vehicle{},
+			Args: []ccutil.Arg{
+				{Name: "vin", Type: ccutil.STRING_ARG, Description: "Vehicle's VIN"},
+				{Name: "deregistration", Type: ccutil.JSON_ARG, Description: "Deregistration with reasonCode and destructionCertificate", Schema: Deregistration{}},
+			},
+			Roles: []string{REGISTRY_ADMIN_ROLE}}).
+		Add(ccutil.Route{Function: "exportVehicle", Handler: s.exportVehicle,
+			Description: "Deregisters the vehicle as exported",
+			Returns: Vehicle{},
+			Args: []ccutil.Arg{
+				{Name: "vin", Type: ccutil.STRING_ARG, Description: "Vehicle's VIN"},
+				{Name: "deregistration", Type: ccutil.JSON_ARG, Description: "Deregistration with reasonCode and destinationCountry", Schema: Deregistration{}},
+			},
+			Roles: []string{REGISTRY_ADMIN_ROLE}}).
+		Add(ccutil.Route{Function: "writeOffVehicle", Handler: s.writeOffVehicle,
+			Description: "Deregisters the vehicle as written off",
+			Returns: Vehicle{},
+			Args: []ccutil.Arg{
+				{Name: "vin", Type: ccutil.STRING_ARG, Description: "Vehicle's VIN"},
+				{Name: "deregistration", Type: ccutil.JSON_ARG, Description: "Deregistration with reasonCode", Schema: Deregistration{}},
+			},
+			Roles: []string{REGISTRY_ADMIN_ROLE}}).
+		Add(ccutil.Route{Function: "setVehicleOwners", Handler: s.setVehicleOwners,
+			Description: "Sets the owners of the vehicle",
+			Returns: Vehicle{},
+			Args: []ccutil.Arg{
+				{Name: "vin", Type: ccutil.STRING_ARG, Description: "Vehicle's VIN"},
+				{Name: "owners", Type: ccutil.JSON_ARG, Description: "Owners whose shares add up to 100", Schema: []Party{}},
+			},
+			Roles: []string{REGISTRY_ADMIN_ROLE}})
 }
 
 func (s *SmartContract) queryAsset(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	assetAsBytes, err := schemas.Get(APIstub, "asset", args[0])
+	if err != nil {
+		return ccutil.ErrorResponse(err)
 	}
-
-	assetAsBytes, _ := APIstub.GetState(args[0])
 	return shim.Success(assetAsBytes)
 }
 
-func (s *SmartContract) initLedger(APIstub shim.ChaincodeStubInterface) sc.Response {
+func (s *SmartContract) initLedger(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 	assets := []LeaseAsset{
 		LeaseAsset{Serial:"2KJvxs2J", Make: "Toyota", Model: "Prius", Leaser: "SEB"},
 		LeaseAsset{Serial:"YmkeuMPk", Make: "Ford", Model: "Mustang", Leaser: "Luminor"},
@@ -106,40 +287,49 @@ func (s *SmartContract) initLedger(APIstub shim.ChaincodeStubInterface) sc.Respo
 		LeaseAsset{Serial:"br9EeEhp", Make: "Holden", Model: "Barina", Leaser: "Swedbank"},
 	}
 
+	created := []KeyedAsset{}
 	i := 0
 	for i < len(assets) {
 		fmt.Println("i is ", i)
-		assetAsBytes, _ := json.Marshal(assets[i])
-		APIstub.PutState("ASSET"+strconv.Itoa(i), assetAsBytes)
+		key := ccutil.NewID(APIstub, ASSET_ID_PREFIX, i)
+		assetAsBytes, err := schemas.Save(APIstub, "asset", assets[i], key)
+		if err != nil {
+			return ccutil.ErrorResponse(err)
+		}
+		created = append(created, KeyedAsset{Key: key, Record: assetAsBytes})
 		fmt.Println("Added", assets[i])
 		i = i + 1
 	}
 
-	return shim.Success(nil)
+	createdAsBytes, err := json.Marshal(created)
+	if err != nil {
+		return ccutil.Internal(fmt.Sprintf("Marshal failed for assets: %s", err)).Response()
+	}
+	return shim.Success(createdAsBytes)
 }
 
 func (s *SmartContract) createAsset(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 4 {
-		return shim.Error("Incorrect number of arguments. Expecting 5")
-	}
-
-	var asset = LeaseAsset{Serial: args[1], Make: args[2], Model: args[3], Leaser: args[4]}
+	var asset = LeaseAsset{Serial: args[0], Make: args[1], Model: args[2], Leaser: args[3]}
 
-	assetAsBytes, _ := json.Marshal(asset)
-	APIstub.PutState(args[0], assetAsBytes)
+	key := ccutil.NewID(APIstub, ASSET_ID_PREFIX, 0)
+	assetAsBytes, err := schemas.Save(APIstub, "asset", asset, key)
+	if err != nil {
+		return ccutil.ErrorResponse(err)
+	}
 
-	return shim.Success(nil)
+	keyedAsBytes, err := json.Marshal(KeyedAsset{Key: key, Record: assetAsBytes})
+	if err != nil {
+		return ccutil.Internal(fmt.Sprintf("Marshal failed for asset: %s", err)).Response()
+	}
+	return shim.Success(keyedAsBytes)
 }
 
-func (s *SmartContract) queryAllAssets(APIstub shim.ChaincodeStubInterface) sc.Response {
+func (s *SmartContract) queryAllAssets(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	startKey := "ASSET0"
-	endKey := "ASSET999"
-
-	resultsIterator, err := APIstub.GetStateByRange(startKey, endKey)
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey("asset", []string{})
 	if err != nil {
-		return shim.Error(err.Error())
+		return ccutil.ErrorResponse(err)
 	}
 	defer resultsIterator.Close()
 
@@ -151,7 +341,11 @@ func (s *SmartContract) queryAllAssets(APIstub shim.ChaincodeStubInterface) sc.R
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
-			return shim.Error(err.Error())
+			return ccutil.ErrorResponse(err)
+		}
+		_, attributes, err := APIstub.SplitCompositeKey(queryResponse.Key)
+		if err != nil || len(attributes) != 1 {
+			return ccutil.Internal("Invalid asset key " + queryResponse.Key).Response()
 		}
 		// Add a comma before array members, suppress it for the first array member
 		if bArrayMemberAlreadyWritten == true {
@@ -159,7 +353,7 @@ func (s *SmartContract) queryAllAssets(APIstub shim.ChaincodeStubInterface) sc.R
 		}
 		buffer.WriteString("{\"Key\":")
 		buffer.WriteString("\"")
-		buffer.WriteString(queryResponse.Key)
+		buffer.WriteString(attributes[0])
 		buffer.WriteString("\"")
 
 		buffer.WriteString(", \"Record\":")
@@ -177,28 +371,15 @@ func (s *SmartContract) queryAllAssets(APIstub shim.ChaincodeStubInterface) sc.R
 
 func (s *SmartContract) changeLeaser(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
-	}
-
-	assetAsBytes, _ := APIstub.GetState(args[0])
 	asset := LeaseAsset{}
-
-	json.Unmarshal(assetAsBytes, &asset)
+	if err := schemas.Load(APIstub, "asset", &asset, args[0]); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
 	asset.Leaser = args[1]
 
-	assetAsBytes, _ = json.Marshal(asset)
-	APIstub.PutState(args[0], assetAsBytes)
+	if _, err := schemas.Save(APIstub, "asset", asset, args[0]); err != nil {
+		return ccutil.ErrorResponse(err)
+	}
 
 	return shim.Success(nil)
 }
-
-// The main function is only relevant in unit test mode. Only included here for completeness.
-func main() {
-
-	// Create a new Smart Contract
-	err := shim.Start(new(SmartContract))
-	if err != nil {
-		fmt.Printf("Error creating new Smart Contract: %s", err)
-	}
-}